@@ -3,22 +3,33 @@ package main
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"time"
 
 	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
 	"github.com/MishkaRogachev/command-queue-executor/pkg/producer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 // Config holds the configuration settings for the client application
 type Config struct {
 	TimeoutMs          int    `json:"timeout_ms"`
-	FeedType           string `json:"feed_type"`              // "file" or "random"
-	CommandFile        string `json:"command_file,omitempty"` // For file feed
-	RandomMax          int    `json:"random_max,omitempty"`   // For random feed
+	FeedType           string `json:"feed_type"`                // "file" or "random"
+	CommandFile        string `json:"command_file,omitempty"`   // For file feed
+	RandomMax          int    `json:"random_max,omitempty"`     // For random feed
+	BurstSize          int    `json:"burst_size,omitempty"`     // Random feed sends requests in bursts of this size if set
+	BurstPauseMs       int    `json:"burst_pause_ms,omitempty"` // Idle pause between bursts
+	Transport          string `json:"transport,omitempty"`      // "rabbitmq" (default), "tcp" or "grpc"
+	TCPAddress         string `json:"tcp_address,omitempty"`    // Address of the TCP server
+	GRPCAddress        string `json:"grpc_address,omitempty"`   // Address of the gRPC server
 	RoutingKey         string `json:"routing_key"`
 	MaxPendingRequests int    `json:"max_pending_requests"`
+	BatchSize          int    `json:"batch_size,omitempty"`          // Requests packed into one message, no batching if not set
+	BatchLingerMs      int    `json:"batch_linger_ms,omitempty"`     // How long an incomplete batch waits for more requests
+	PersistentRequests bool   `json:"persistent_requests,omitempty"` // Requests survive broker restarts if the server queue is durable
 }
 
 // loadConfig loads the configuration from a file
@@ -38,6 +49,22 @@ func loadConfig(filePath string) (Config, error) {
 	return config, nil
 }
 
+// newClient creates the message queue client of the configured transport
+func newClient(config Config) (mq.ClientMQ, error) {
+	switch config.Transport {
+	case "", "rabbitmq":
+		return mq.NewClientRabbitMQWithOptions(mq.GetRabbitMQURL(), config.RoutingKey, mq.RabbitMQOptions{
+			Persistent: config.PersistentRequests,
+		})
+	case "tcp":
+		return mq.NewClientTCP(config.TCPAddress)
+	case "grpc":
+		return mq.NewClientGRPC(config.GRPCAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	default:
+		return nil, fmt.Errorf("invalid transport %q, must be 'rabbitmq', 'tcp' or 'grpc'", config.Transport)
+	}
+}
+
 func main() {
 	configPath := flag.String("config", "cmd/client/config_file.json", "Path to the configuration file")
 	flag.Parse()
@@ -48,14 +75,14 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Initialize RabbitMQ client
-	client, err := mq.NewClientRabbitMQ(mq.GetRabbitMQURL(), config.RoutingKey)
+	// Initialize the message queue client
+	client, err := newClient(config)
 	if err != nil {
-		log.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+		log.Fatalf("Failed to initialize client: %v", err)
 	}
 	defer func() {
 		if err := client.Close(); err != nil {
-			log.Printf("Error closing RabbitMQ client: %v", err)
+			log.Printf("Error closing client: %v", err)
 		}
 	}()
 
@@ -67,6 +94,10 @@ func main() {
 
 	// Configure the producer based on feed type
 	timeout := time.Duration(config.TimeoutMs) * time.Millisecond
+	var options []producer.Option
+	if config.BatchSize > 1 {
+		options = append(options, producer.WithBatching(config.BatchSize, time.Duration(config.BatchLingerMs)*time.Millisecond))
+	}
 	var prod *producer.Producer
 
 	switch config.FeedType {
@@ -80,11 +111,22 @@ func main() {
 		}
 		defer fileFeed.Close()
 
-		prod = producer.NewProducer(client, responseHandlerDebug, fileFeed, timeout, config.MaxPendingRequests)
+		prod = producer.NewProducer(client, responseHandlerDebug, fileFeed, timeout, config.MaxPendingRequests, options...)
 
 	case "random":
-		randomFeed := producer.NewRandomRequestFeed(config.RandomMax)
-		prod = producer.NewProducer(client, responseHandlerDebug, randomFeed, timeout, config.MaxPendingRequests)
+		var feedOptions []producer.RandomFeedOption
+		if config.BurstSize > 0 {
+			feedOptions = append(feedOptions, producer.WithBursts(config.BurstSize, time.Duration(config.BurstPauseMs)*time.Millisecond))
+		}
+		randomFeed := producer.NewRandomRequestFeed(config.RandomMax, feedOptions...)
+		// Let the feed continue paged GetAll requests with cursors from the responses
+		responseHandler := func(response string) error {
+			if err := responseHandlerDebug(response); err != nil {
+				return err
+			}
+			return randomFeed.HandleResponse(response)
+		}
+		prod = producer.NewProducer(client, responseHandler, randomFeed, timeout, config.MaxPendingRequests, options...)
 
 	default:
 		log.Fatalf("Invalid FeedType: %s. Must be 'file' or 'random'.", config.FeedType)
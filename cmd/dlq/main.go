@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+)
+
+const usage = `Usage: dlq [flags] <command>
+
+Commands:
+  list                     List dead letters of the server queue
+  inspect <correlation-id> Print a dead letter with its metadata
+  replay <correlation-id>  Send a dead letter to the server queue again and remove it once replied
+
+Flags:
+`
+
+// findDeadLetter looks up a dead letter without removing it from the queue
+func findDeadLetter(dlq *mq.DeadLetterQueueRabbitMQ, corrID string) (mq.DeadLetter, error) {
+	letters, err := dlq.List()
+	if err != nil {
+		return mq.DeadLetter{}, err
+	}
+	for _, letter := range letters {
+		if letter.CorrelationID == corrID {
+			return letter, nil
+		}
+	}
+	return mq.DeadLetter{}, fmt.Errorf("%w: %s", mq.ErrDeadLetterNotFound, corrID)
+}
+
+func list(dlq *mq.DeadLetterQueueRabbitMQ) error {
+	letters, err := dlq.List()
+	if err != nil {
+		return err
+	}
+
+	for _, letter := range letters {
+		data := letter.Data
+		if len(data) > 60 {
+			data = data[:60] + "..."
+		}
+		fmt.Printf("%s  %s  %-24q  %s\n", letter.CorrelationID, letter.Time.Format(time.RFC3339), letter.Reason, data)
+	}
+	fmt.Printf("%d dead letters\n", len(letters))
+	return nil
+}
+
+func inspect(dlq *mq.DeadLetterQueueRabbitMQ, corrID string) error {
+	letter, err := findDeadLetter(dlq, corrID)
+	if err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(letter, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+// replay sends the dead letter as a new request, it's removed from the queue only if all replies are received
+func replay(dlq *mq.DeadLetterQueueRabbitMQ, routingKey string, options mq.RabbitMQOptions, corrID string, timeout time.Duration) error {
+	letter, err := findDeadLetter(dlq, corrID)
+	if err != nil {
+		return err
+	}
+
+	client, err := mq.NewClientRabbitMQWithOptions(mq.GetRabbitMQURL(), routingKey, options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var replyChans []<-chan mq.Reply
+	if letter.Batch {
+		requests, err := mq.DecodeBatch(letter.Data)
+		if err != nil {
+			return err
+		}
+		replyChans, err = client.RequestBatch(ctx, requests)
+		if err != nil {
+			return err
+		}
+	} else {
+		replyChan, err := client.RequestContext(ctx, letter.Data)
+		if err != nil {
+			return err
+		}
+		replyChans = append(replyChans, replyChan)
+	}
+
+	for _, replyChan := range replyChans {
+		reply := <-replyChan
+		if reply.Err != nil {
+			return fmt.Errorf("replay failed, the dead letter is kept: %w", reply.Err)
+		}
+		fmt.Println(reply.Data)
+	}
+
+	_, err = dlq.Remove(corrID)
+	return err
+}
+
+func main() {
+	routingKey := flag.String("routing-key", "rpc_queue", "Server queue whose dead letters are managed")
+	timeoutMs := flag.Int("timeout-ms", 5000, "How long replay waits for the reply")
+	durable := flag.Bool("durable", false, "The server queue is durable, replayed requests are persistent")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := mq.RabbitMQOptions{Durable: *durable, Persistent: *durable}
+	dlq, err := mq.NewDeadLetterQueueRabbitMQWithOptions(mq.GetRabbitMQURL(), *routingKey, options)
+	if err != nil {
+		log.Fatalf("Failed to open dead-letter queue: %v", err)
+	}
+	defer dlq.Close()
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		err = list(dlq)
+	case args[0] == "inspect" && len(args) == 2:
+		err = inspect(dlq, args[1])
+	case args[0] == "replay" && len(args) == 2:
+		err = replay(dlq, *routingKey, options, args[1], time.Duration(*timeoutMs)*time.Millisecond)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Failed to %s: %v", args[0], err)
+	}
+}
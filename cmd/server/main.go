@@ -1,61 +1,280 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/MishkaRogachev/command-queue-executor/pkg/consumer"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/gateway"
 	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/orderedmap"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/wal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 // Config holds the configuration settings for the server application
 type Config struct {
-	RoutingKey string `json:"routing_key"`
-	Workers    int    `json:"workers"`
+	Transport          string `json:"transport,omitempty"`       // "rabbitmq", "tcp" or "grpc"
+	TCPAddress         string `json:"tcp_address,omitempty"`     // Address the TCP server listens on
+	GRPCAddress        string `json:"grpc_address,omitempty"`    // Address the gRPC server listens on
+	HTTPAddress        string `json:"http_address,omitempty"`    // Address of the HTTP/JSON gateway, disabled if empty
+	HTTPTimeoutMs      int    `json:"http_timeout_ms,omitempty"` // How long gateway requests wait for the reply
+	RoutingKey         string `json:"routing_key"`
+	Workers            int    `json:"workers"`
+	MinWorkers         int    `json:"min_workers,omitempty"`          // Lower limit of the autoscaling pool
+	MaxWorkers         int    `json:"max_workers,omitempty"`          // Upper limit of the autoscaling pool, "workers" is the initial size. The pool is fixed if zero
+	KeyAffinity        bool   `json:"key_affinity,omitempty"`         // Commands for a key are executed in order, can't be combined with max_workers
+	DrainTimeoutMs     int    `json:"drain_timeout_ms,omitempty"`     // How long requests in flight are waited for on shutdown
+	WALPath            string `json:"wal_path,omitempty"`             // Persistence is disabled if empty
+	WALSync            string `json:"wal_sync,omitempty"`             // "always", "interval" or "never"
+	WALSyncIntervalMs  int    `json:"wal_sync_interval_ms,omitempty"` // For "interval" sync
+	SnapshotPath       string `json:"snapshot_path,omitempty"`        // Snapshots are disabled if empty
+	SnapshotIntervalMs int    `json:"snapshot_interval_ms,omitempty"` // Periodic snapshots are disabled if zero
+	MaxItems           int    `json:"max_items,omitempty"`            // The map is unbounded if zero
+	EvictionPolicy     string `json:"eviction_policy,omitempty"`      // "fifo" or "lru"
+	DedupSize          int    `json:"dedup_size,omitempty"`           // Request IDs remembered to skip repeated requests, disabled if zero
+	DurableQueue       bool   `json:"durable_queue,omitempty"`        // The server queue survives broker restarts
+	PersistentRequests bool   `json:"persistent_requests,omitempty"`  // Dead letters the server publishes survive broker restarts
+	QueueMaxLength     int    `json:"queue_max_length,omitempty"`     // Waiting requests, unlimited if zero
+	QueueMessageTTLMs  int    `json:"queue_message_ttl_ms,omitempty"` // Requests waiting longer are dead-lettered, no limit if zero
+	QueueType          string `json:"queue_type,omitempty"`           // "classic" or "quorum", the broker default if empty
 }
 
-func loadConfig() Config {
-	// Hardcoding config values for simplicity
-	return Config{
-		RoutingKey: "rpc_queue",
-		Workers:    5,
+// loadConfig loads the configuration from a file, default values are used if no file is given
+func loadConfig(filePath string) (Config, error) {
+	config := Config{
+		Transport:         "rabbitmq",
+		TCPAddress:        ":5673",
+		GRPCAddress:       ":50051",
+		RoutingKey:        "rpc_queue",
+		Workers:           5,
+		DrainTimeoutMs:    int(consumer.DefaultDrainTimeout / time.Millisecond),
+		WALSyncIntervalMs: 1000,
+		DedupSize:         10000,
 	}
+	if filePath == "" {
+		return config, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Config{}, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// newServer creates the message queue server of the configured transport
+func newServer(config Config) (mq.ServerMQ, error) {
+	switch config.Transport {
+	case "rabbitmq":
+		return mq.NewServerRabbitMQWithOptions(mq.GetRabbitMQURL(), config.RoutingKey, mq.RabbitMQOptions{
+			Durable:    config.DurableQueue,
+			Persistent: config.PersistentRequests,
+			MaxLength:  config.QueueMaxLength,
+			MessageTTL: time.Duration(config.QueueMessageTTLMs) * time.Millisecond,
+			QueueType:  config.QueueType,
+		})
+	case "tcp":
+		server, err := mq.NewServerTCP(config.TCPAddress)
+		if err != nil {
+			return nil, err
+		}
+		go logDeadLetters(server.DeadLetters())
+		return server, nil
+	case "grpc":
+		listener, err := net.Listen("tcp", config.GRPCAddress)
+		if err != nil {
+			return nil, err
+		}
+		server := mq.NewServerGRPC(listener)
+		go logDeadLetters(server.DeadLetters())
+		return server, nil
+	default:
+		return nil, fmt.Errorf("invalid transport %q, must be 'rabbitmq', 'tcp' or 'grpc'", config.Transport)
+	}
+}
+
+// newGatewayClient creates a client of the server itself, so gateway requests go through the consumer
+func newGatewayClient(config Config) (mq.ClientMQ, error) {
+	switch config.Transport {
+	case "rabbitmq":
+		return mq.NewClientRabbitMQWithOptions(mq.GetRabbitMQURL(), config.RoutingKey, mq.RabbitMQOptions{
+			Persistent: config.PersistentRequests,
+		})
+	case "tcp":
+		return mq.NewClientTCP(config.TCPAddress)
+	case "grpc":
+		return mq.NewClientGRPC("passthrough:///"+config.GRPCAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	default:
+		return nil, fmt.Errorf("invalid transport %q, must be 'rabbitmq', 'tcp' or 'grpc'", config.Transport)
+	}
+}
+
+// startGateway serves the HTTP/JSON gateway until the returned server is shut down
+func startGateway(config Config) (*http.Server, mq.ClientMQ, error) {
+	client, err := newGatewayClient(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener, err := net.Listen("tcp", config.HTTPAddress)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	httpServer := &http.Server{
+		Handler: gateway.NewGateway(client, time.Duration(config.HTTPTimeoutMs)*time.Millisecond),
+	}
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP gateway stopped: %v", err)
+		}
+	}()
+	return httpServer, client, nil
+}
+
+// logDeadLetters logs dead letters of servers without a broker, there is no dead-letter queue to keep them
+func logDeadLetters(letters <-chan mq.DeadLetter) {
+	for letter := range letters {
+		log.Printf("Dead letter %s (%s): %s", letter.CorrelationID, letter.Reason, letter.Data)
+	}
+}
+
+// openWAL opens the write-ahead log if persistence is enabled
+func openWAL(config Config) (*wal.Log, error) {
+	if config.WALPath == "" {
+		return nil, nil
+	}
+
+	syncPolicy, err := wal.ParseSyncPolicy(config.WALSync)
+	if err != nil {
+		return nil, err
+	}
+
+	return wal.Open(config.WALPath,
+		wal.WithSyncPolicy(syncPolicy),
+		wal.WithSyncInterval(time.Duration(config.WALSyncIntervalMs)*time.Millisecond),
+	)
 }
 
 func main() {
-	config := loadConfig()
+	configPath := flag.String("config", "", "Path to the configuration file (optional)")
+	flag.Parse()
 
-	// Initialize RabbitMQ server
-	server, err := mq.NewServerRabbitMQ(mq.GetRabbitMQURL(), config.RoutingKey)
+	// Load the configuration
+	config, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Open the write-ahead log, so the state survives restarts
+	walLog, err := openWAL(config)
+	if err != nil {
+		log.Fatalf("Failed to open write-ahead log: %v", err)
+	}
+	var handlerOptions []consumer.HandlerOption
+	if walLog != nil {
+		defer func() {
+			if err := walLog.Close(); err != nil {
+				log.Printf("Error closing write-ahead log: %v", err)
+			}
+		}()
+		handlerOptions = append(handlerOptions, consumer.WithWAL(walLog))
+	}
+	if config.MaxItems > 0 {
+		policy, err := orderedmap.ParseEvictionPolicy(config.EvictionPolicy)
+		if err != nil {
+			log.Fatalf("Failed to configure eviction: %v", err)
+		}
+		handlerOptions = append(handlerOptions, consumer.WithMaxItems(config.MaxItems, policy))
+	}
+	if config.SnapshotPath != "" {
+		snapshotInterval := time.Duration(config.SnapshotIntervalMs) * time.Millisecond
+		handlerOptions = append(handlerOptions, consumer.WithSnapshots(config.SnapshotPath, snapshotInterval))
+	}
+
+	// Initialize the message queue server
+	server, err := newServer(config)
+	if err != nil {
+		log.Fatalf("Failed to initialize %s server: %v", config.Transport, err)
 	}
 	defer func() {
 		if err := server.Close(); err != nil {
-			log.Printf("Error closing RabbitMQ server: %v", err)
+			log.Printf("Error closing %s server: %v", config.Transport, err)
 		}
 	}()
 
-	// Initialize your handler (e.g. RequestHandlerOrderedMap, which has an Execute method)
-	handler := consumer.NewRequestHandlerOrderedMap()
+	// Initialize your handler (e.g. RequestHandlerOrderedMap, which has an Execute method),
+	// restoring the snapshot and replaying the write-ahead log if persistence is enabled
+	handler, err := consumer.NewRequestHandlerOrderedMap(handlerOptions...)
+	if err != nil {
+		log.Fatalf("Failed to initialize request handler: %v", err)
+	}
+	defer handler.Close()
 
-	// Create a Consumer with N worker goroutines
-	con := consumer.NewConsumer(server, config.Workers, handler.Execute)
+	// Create a Consumer with N worker goroutines, resized between min_workers and max_workers if set
+	// Requests which are not commands are kept in the dead-letter queue, see cmd/dlq
+	drainTimeout := time.Duration(config.DrainTimeoutMs) * time.Millisecond
+	consumerOptions := []consumer.Option{consumer.WithDeadLetters(handler.Validate), consumer.WithDrainTimeout(drainTimeout)}
+	if config.DedupSize > 0 {
+		consumerOptions = append(consumerOptions, consumer.WithDedup(config.DedupSize))
+	}
+	if config.MaxWorkers > 0 {
+		consumerOptions = append(consumerOptions, consumer.WithAutoscaling(config.MinWorkers, config.MaxWorkers, 0))
+	}
+	if config.KeyAffinity {
+		consumerOptions = append(consumerOptions, consumer.WithKeyAffinity(handler.Keys))
+	}
+	con := consumer.NewConsumer(server, config.Workers, handler.Execute, consumerOptions...)
 
-	// Start the consumer
+	// Start the consumer, on shutdown it finishes requests in flight for up to the drain timeout
 	if err := con.Start(); err != nil {
 		log.Fatalf("Failed to start concurrent consumer: %v", err)
 	}
 	defer con.Stop()
 
-	log.Println("RabbitMQ server is running. Press Ctrl+C to exit...")
+	// Start the HTTP/JSON gateway, it's stopped before the consumer
+	if config.HTTPAddress != "" {
+		httpServer, client, err := startGateway(config)
+		if err != nil {
+			log.Fatalf("Failed to start HTTP gateway: %v", err)
+		}
+		defer client.Close()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				log.Printf("Error stopping HTTP gateway: %v", err)
+			}
+		}()
+		log.Printf("HTTP gateway is listening on %s", config.HTTPAddress)
+	}
+
+	log.Printf("Server is running over %s. Press Ctrl+C to exit...", config.Transport)
 
 	// Graceful shutdown handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
-	log.Println("Shutting down...")
+	log.Printf("Shutting down, waiting up to %v for requests in flight...", drainTimeout)
 }
@@ -0,0 +1,396 @@
+// Package amqpfake is an in-memory AMQP 0-9-1 broker for hermetic tests of RabbitMQ clients.
+// It implements the subset of RabbitMQ the executor uses: the default exchange, direct and fanout exchanges,
+// queue declaration and binding, consuming, publishing with returns and confirms, acknowledgements,
+// dead-lettering, x-max-length and x-message-ttl. Durable queues are accepted, but nothing is persisted.
+// Network faults are simulated with KillConnections and DropFrames.
+package amqpfake
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// message is a message in a queue
+type message struct {
+	exchange    string
+	routingKey  string
+	properties  Properties
+	body        []byte
+	redelivered bool
+	expires     time.Time // The message is dead-lettered once it expires in a queue with x-message-ttl, never if zero
+}
+
+type binding struct {
+	queue      string
+	routingKey string
+}
+
+type exchange struct {
+	name     string
+	kind     string // "direct" or "fanout"
+	durable  bool
+	bindings []binding
+}
+
+type queue struct {
+	name       string
+	durable    bool
+	autoDelete bool
+	args       Table
+	owner      *connection // Exclusive queues are deleted with their connection
+
+	messages     []*message
+	consumers    []*consumer
+	next         int  // Round-robin position in consumers
+	hadConsumers bool // Auto-delete queues are deleted once their last consumer is gone
+}
+
+type consumer struct {
+	tag       string
+	channel   *channel
+	queue     *queue
+	noAck     bool
+	exclusive bool
+	unacked   int
+}
+
+// Broker is an in-memory AMQP 0-9-1 broker listening on a local TCP port
+type Broker struct {
+	listener net.Listener
+
+	mu               sync.Mutex
+	exchanges        map[string]*exchange
+	queues           map[string]*queue
+	connections      map[*connection]struct{}
+	names            int  // Counter for generated queue names and consumer tags
+	rejectPublishes  bool // Publishes are nacked instead of routed
+	closed           bool
+	acceptLoopDone   chan struct{}
+	connectionsGroup sync.WaitGroup
+
+	dropFilter atomic.Pointer[dropFilter] // Set by DropFrames, read without mu as heartbeats are sent without it
+}
+
+// NewBroker starts a broker on a random local port
+func NewBroker() (*Broker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	b := &Broker{
+		listener:       listener,
+		exchanges:      map[string]*exchange{"": {kind: "direct", durable: true}},
+		queues:         make(map[string]*queue),
+		connections:    make(map[*connection]struct{}),
+		acceptLoopDone: make(chan struct{}),
+	}
+	go b.acceptLoop()
+	return b, nil
+}
+
+// URL returns the AMQP URL clients connect to
+func (b *Broker) URL() string {
+	return "amqp://guest:guest@" + b.listener.Addr().String() + "/"
+}
+
+// Close stops the broker and drops all connections
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	connections := make([]*connection, 0, len(b.connections))
+	for c := range b.connections {
+		connections = append(connections, c)
+	}
+	b.mu.Unlock()
+
+	err := b.listener.Close()
+	<-b.acceptLoopDone
+	for _, c := range connections {
+		c.netConn.Close()
+	}
+	b.connectionsGroup.Wait()
+	return err
+}
+
+// RejectPublishes makes the broker nack publishes on channels in confirm mode instead of routing them,
+// as RabbitMQ does when it can't take responsibility for messages
+func (b *Broker) RejectPublishes(reject bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rejectPublishes = reject
+}
+
+func (b *Broker) acceptLoop() {
+	defer close(b.acceptLoopDone)
+
+	for {
+		netConn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			netConn.Close()
+			return
+		}
+		c := newConnection(b, netConn)
+		b.connections[c] = struct{}{}
+		b.connectionsGroup.Add(1)
+		b.mu.Unlock()
+
+		go c.serve()
+	}
+}
+
+// generateName returns a unique name with the prefix, the caller must hold mu
+func (b *Broker) generateName(prefix string) string {
+	b.names++
+	return fmt.Sprintf("%s%d", prefix, b.names)
+}
+
+// route returns the queues of a message, the caller must hold mu
+func (b *Broker) route(exchangeName, routingKey string) ([]*queue, bool) {
+	ex, ok := b.exchanges[exchangeName]
+	if !ok {
+		return nil, false
+	}
+
+	// The default exchange routes to the queue with the routing key as the name
+	if exchangeName == "" {
+		if q, ok := b.queues[routingKey]; ok {
+			return []*queue{q}, true
+		}
+		return nil, true
+	}
+
+	var queues []*queue
+	seen := make(map[*queue]bool)
+	for _, bind := range ex.bindings {
+		q := b.queues[bind.queue]
+		if q == nil || seen[q] || (ex.kind == "direct" && bind.routingKey != routingKey) {
+			continue
+		}
+		seen[q] = true
+		queues = append(queues, q)
+	}
+	return queues, true
+}
+
+// enqueue puts copies of the message to the queues and delivers them to consumers, the caller must hold mu.
+// Queues over x-max-length drop messages from the head.
+func (b *Broker) enqueue(queues []*queue, msg *message) {
+	for _, q := range queues {
+		copied := *msg
+		copied.expires = time.Time{}
+		if ttl, ok := intArg(q.args, "x-message-ttl"); ok {
+			delay := time.Duration(ttl) * time.Millisecond
+			copied.expires = time.Now().Add(delay)
+			time.AfterFunc(delay, func() {
+				b.mu.Lock()
+				defer b.mu.Unlock()
+
+				b.dispatch(q)
+			})
+		}
+		q.messages = append(q.messages, &copied)
+		b.dispatch(q)
+
+		if maxLength, ok := intArg(q.args, "x-max-length"); ok {
+			for int64(len(q.messages)) > maxLength {
+				head := q.messages[0]
+				q.messages = q.messages[1:]
+				b.deadLetter(q, head, "maxlen")
+			}
+		}
+	}
+}
+
+// expire dead-letters expired messages from the head of the queue, as RabbitMQ does, the caller must hold mu
+func (b *Broker) expire(q *queue) {
+	if b.queues[q.name] != q {
+		return
+	}
+	now := time.Now()
+	for len(q.messages) > 0 && !q.messages[0].expires.IsZero() && !now.Before(q.messages[0].expires) {
+		head := q.messages[0]
+		q.messages = q.messages[1:]
+		b.deadLetter(q, head, "expired")
+	}
+}
+
+// requeue puts messages back to the front of the queue in their order, the caller must hold mu
+func (b *Broker) requeue(q *queue, messages []*message) {
+	if b.queues[q.name] != q || len(messages) == 0 {
+		return
+	}
+	for _, msg := range messages {
+		msg.redelivered = true
+	}
+	q.messages = append(append([]*message(nil), messages...), q.messages...)
+	b.dispatch(q)
+}
+
+// dispatch delivers ready messages to consumers with free capacity in round-robin order, the caller must hold mu
+func (b *Broker) dispatch(q *queue) {
+	b.expire(q)
+	for len(q.messages) > 0 {
+		cons := q.nextConsumer()
+		if cons == nil {
+			return
+		}
+
+		msg := q.messages[0]
+		q.messages = q.messages[1:]
+		cons.channel.deliver(cons, msg)
+	}
+}
+
+// nextConsumer returns the next consumer which can take a message, nil if there is none
+func (q *queue) nextConsumer() *consumer {
+	for i := 0; i < len(q.consumers); i++ {
+		cons := q.consumers[(q.next+i)%len(q.consumers)]
+		prefetch := cons.channel.prefetch
+		if cons.noAck || prefetch == 0 || cons.unacked < prefetch {
+			q.next = (q.next + i + 1) % len(q.consumers)
+			return cons
+		}
+	}
+	return nil
+}
+
+// removeConsumer unsubscribes the consumer and auto-deletes the queue if it was the last one,
+// the caller must hold mu
+func (b *Broker) removeConsumer(cons *consumer) {
+	q := cons.queue
+	for i, other := range q.consumers {
+		if other == cons {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+	if q.next >= len(q.consumers) {
+		q.next = 0
+	}
+	if q.autoDelete && q.hadConsumers && len(q.consumers) == 0 {
+		b.deleteQueue(q)
+	}
+}
+
+// deleteQueue drops the queue with its messages and cancels its consumers, the caller must hold mu
+func (b *Broker) deleteQueue(q *queue) {
+	if b.queues[q.name] != q {
+		return
+	}
+	delete(b.queues, q.name)
+	for _, ex := range b.exchanges {
+		bindings := ex.bindings[:0]
+		for _, bind := range ex.bindings {
+			if bind.queue != q.name {
+				bindings = append(bindings, bind)
+			}
+		}
+		ex.bindings = bindings
+	}
+	// Consumers of the queue are cancelled, clients are notified as they support consumer_cancel_notify
+	for _, cons := range q.consumers {
+		delete(cons.channel.consumers, cons.tag)
+		cons.channel.send(basicCancel, func(e *encoder) {
+			e.shortstr(cons.tag)
+			e.octet(1)
+		})
+	}
+	q.consumers = nil
+}
+
+// deadLetter routes a rejected message to the dead-letter exchange of its queue, if there is one.
+// The reason is recorded in the x-death header, as RabbitMQ does. The caller must hold mu.
+func (b *Broker) deadLetter(q *queue, msg *message, reason string) {
+	dlx, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	routingKey := msg.routingKey
+	if key, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		routingKey = key
+	}
+
+	death := Table{
+		"reason":       reason,
+		"queue":        q.name,
+		"time":         time.Now(),
+		"exchange":     msg.exchange,
+		"routing-keys": []interface{}{msg.routingKey},
+		"count":        int64(1),
+	}
+	headers := make(Table, len(msg.properties.Headers)+1)
+	for key, value := range msg.properties.Headers {
+		headers[key] = value
+	}
+	deaths, _ := headers["x-death"].([]interface{})
+	headers["x-death"] = append([]interface{}{death}, deaths...)
+
+	dead := *msg
+	dead.exchange, dead.routingKey, dead.redelivered = dlx, routingKey, false
+	dead.properties.Headers = headers
+
+	if queues, ok := b.route(dlx, routingKey); ok {
+		b.enqueue(queues, &dead)
+	}
+}
+
+// declareQueue creates a queue or checks the existing one is equivalent, the caller must hold mu
+func (b *Broker) declareQueue(c *connection, name string, durable, exclusive, autoDelete bool, args Table) (*queue, *amqpError) {
+	if q, ok := b.queues[name]; ok {
+		if q.owner != nil && q.owner != c {
+			return nil, newError(replyResourceLocked, "cannot obtain exclusive access to locked queue '%s'", name)
+		}
+		if q.durable != durable || !equalArgs(q.args, args) {
+			return nil, newError(replyPreconditionFailed, "inequivalent arg for queue '%s'", name)
+		}
+		return q, nil
+	}
+
+	q := &queue{name: name, durable: durable, autoDelete: autoDelete, args: args}
+	if exclusive {
+		q.owner = c
+	}
+	b.queues[name] = q
+	return q, nil
+}
+
+// intArg returns an integer argument of any integer field type
+func intArg(args Table, key string) (int64, bool) {
+	switch v := args[key].(type) {
+	case int8:
+		return int64(v), true
+	case byte:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func equalArgs(a, b Table) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,552 @@
+package amqpfake
+
+import "sort"
+
+// unacked is a message delivered to the client and waiting for an acknowledgement
+type unacked struct {
+	msg      *message
+	queue    *queue
+	consumer *consumer // nil for basic.get
+}
+
+// publishing is a message being received: its method and header arrived, some of the body is pending
+type publishing struct {
+	msg       *message
+	mandatory bool
+	size      int
+}
+
+// channel is a client channel, all its state is guarded by the broker lock
+type channel struct {
+	conn *connection
+	id   uint16
+
+	closing   bool // Closed by the broker, waiting for channel.close-ok
+	confirm   bool
+	published uint64 // Publish sequence number in confirm mode
+	prefetch  int
+
+	consumers   map[string]*consumer
+	deliveryTag uint64
+	unacked     map[uint64]unacked
+	publishing  *publishing
+}
+
+func newChannel(c *connection, id uint16) *channel {
+	return &channel{
+		conn:      c,
+		id:        id,
+		consumers: make(map[string]*consumer),
+		unacked:   make(map[uint64]unacked),
+	}
+}
+
+func (ch *channel) handleFrame(f frame) *amqpError {
+	if ch.closing {
+		if f.typ == frameMethod && methodID((&decoder{buf: f.payload}).long()) == channelCloseOk {
+			delete(ch.conn.channels, ch.id)
+		}
+		return nil
+	}
+
+	switch f.typ {
+	case frameMethod:
+		if ch.publishing != nil {
+			return newError(replyCommandInvalid, "expected content frame")
+		}
+		return ch.handleMethod(f.payload)
+	case frameHeader:
+		return ch.handleHeader(f.payload)
+	case frameBody:
+		return ch.handleBody(f.payload)
+	default:
+		return newError(replyCommandInvalid, "unexpected frame type %d", f.typ)
+	}
+}
+
+func (ch *channel) handleMethod(payload []byte) *amqpError {
+	d := &decoder{buf: payload}
+	id := methodID(d.long())
+
+	var err *amqpError
+	switch id {
+	case channelClose:
+		ch.close()
+		delete(ch.conn.channels, ch.id)
+		ch.send(channelCloseOk, nil)
+	case exchangeDeclare:
+		err = ch.exchangeDeclare(d)
+	case queueDeclare:
+		err = ch.queueDeclare(d)
+	case queueBind:
+		err = ch.queueBind(d)
+	case queuePurge:
+		err = ch.queuePurge(d)
+	case queueDelete:
+		err = ch.queueDelete(d)
+	case basicQos:
+		d.long()
+		ch.prefetch = int(d.short())
+		d.octet()
+		ch.send(basicQosOk, nil)
+	case basicConsume:
+		err = ch.basicConsume(d)
+	case basicCancel:
+		err = ch.basicCancel(d)
+	case basicPublish:
+		d.short()
+		exchange, routingKey := d.shortstr(), d.shortstr()
+		flags := d.octet()
+		ch.publishing = &publishing{
+			msg:       &message{exchange: exchange, routingKey: routingKey},
+			mandatory: flags&1 != 0,
+		}
+	case basicGet:
+		err = ch.basicGet(d)
+	case basicAck:
+		tag := d.longlong()
+		flags := d.octet()
+		err = ch.settle(tag, flags&1 != 0, func(u unacked) {})
+	case basicNack:
+		tag := d.longlong()
+		flags := d.octet()
+		err = ch.reject(tag, flags&1 != 0, flags&2 != 0)
+	case basicReject:
+		tag := d.longlong()
+		flags := d.octet()
+		err = ch.reject(tag, false, flags&1 != 0)
+	case confirmSelect:
+		noWait := d.octet()&1 != 0
+		ch.confirm = true
+		if !noWait {
+			ch.send(confirmSelectOk, nil)
+		}
+	default:
+		return newError(replyNotImplemented, "method %d.%d is not implemented", id.class(), id.method())
+	}
+
+	if d.err != nil {
+		return newError(replyCommandInvalid, "malformed method %d.%d", id.class(), id.method())
+	}
+	return err
+}
+
+func (ch *channel) exchangeDeclare(d *decoder) *amqpError {
+	d.short()
+	name, kind := d.shortstr(), d.shortstr()
+	flags := d.octet()
+	d.table()
+	passive, durable, noWait := flags&1 != 0, flags&2 != 0, flags&16 != 0
+
+	b := ch.conn.broker
+	if ex, ok := b.exchanges[name]; ok {
+		if !passive && (ex.kind != kind || ex.durable != durable) {
+			return newError(replyPreconditionFailed, "inequivalent arg for exchange '%s'", name)
+		}
+	} else if passive {
+		return newError(replyNotFound, "no exchange '%s'", name)
+	} else if kind != "direct" && kind != "fanout" {
+		return newError(replyCommandInvalid, "exchange type '%s' is not supported", kind)
+	} else {
+		b.exchanges[name] = &exchange{name: name, kind: kind, durable: durable}
+	}
+
+	if !noWait {
+		ch.send(exchangeDeclareOk, nil)
+	}
+	return nil
+}
+
+func (ch *channel) queueDeclare(d *decoder) *amqpError {
+	d.short()
+	name := d.shortstr()
+	flags := d.octet()
+	args := d.table()
+	passive, durable, exclusive, autoDelete, noWait := flags&1 != 0, flags&2 != 0, flags&4 != 0, flags&8 != 0, flags&16 != 0
+
+	b := ch.conn.broker
+	var q *queue
+	if passive {
+		q = b.queues[name]
+		if q == nil {
+			return newError(replyNotFound, "no queue '%s'", name)
+		}
+	} else {
+		if name == "" {
+			name = b.generateName("amq.gen-")
+		}
+		var err *amqpError
+		if q, err = b.declareQueue(ch.conn, name, durable, exclusive, autoDelete, args); err != nil {
+			return err
+		}
+	}
+
+	if !noWait {
+		ch.send(queueDeclareOk, func(e *encoder) {
+			e.shortstr(q.name)
+			e.long(uint32(len(q.messages)))
+			e.long(uint32(len(q.consumers)))
+		})
+	}
+	return nil
+}
+
+func (ch *channel) queueBind(d *decoder) *amqpError {
+	d.short()
+	queueName, exchangeName, routingKey := d.shortstr(), d.shortstr(), d.shortstr()
+	noWait := d.octet()&1 != 0
+	d.table()
+
+	b := ch.conn.broker
+	ex, ok := b.exchanges[exchangeName]
+	if !ok || exchangeName == "" {
+		return newError(replyNotFound, "no exchange '%s'", exchangeName)
+	}
+	if _, ok := b.queues[queueName]; !ok {
+		return newError(replyNotFound, "no queue '%s'", queueName)
+	}
+
+	bind := binding{queue: queueName, routingKey: routingKey}
+	exists := false
+	for _, other := range ex.bindings {
+		exists = exists || other == bind
+	}
+	if !exists {
+		ex.bindings = append(ex.bindings, bind)
+	}
+
+	if !noWait {
+		ch.send(queueBindOk, nil)
+	}
+	return nil
+}
+
+func (ch *channel) queuePurge(d *decoder) *amqpError {
+	d.short()
+	name := d.shortstr()
+	noWait := d.octet()&1 != 0
+
+	q, ok := ch.conn.broker.queues[name]
+	if !ok {
+		return newError(replyNotFound, "no queue '%s'", name)
+	}
+	count := len(q.messages)
+	q.messages = nil
+
+	if !noWait {
+		ch.send(queuePurgeOk, func(e *encoder) {
+			e.long(uint32(count))
+		})
+	}
+	return nil
+}
+
+func (ch *channel) queueDelete(d *decoder) *amqpError {
+	d.short()
+	name := d.shortstr()
+	noWait := d.octet()&4 != 0
+
+	count := 0
+	if q, ok := ch.conn.broker.queues[name]; ok {
+		count = len(q.messages)
+		ch.conn.broker.deleteQueue(q)
+	}
+
+	if !noWait {
+		ch.send(queueDeleteOk, func(e *encoder) {
+			e.long(uint32(count))
+		})
+	}
+	return nil
+}
+
+func (ch *channel) basicConsume(d *decoder) *amqpError {
+	d.short()
+	queueName, tag := d.shortstr(), d.shortstr()
+	flags := d.octet()
+	d.table()
+	noAck, exclusive, noWait := flags&2 != 0, flags&4 != 0, flags&8 != 0
+
+	b := ch.conn.broker
+	q, ok := b.queues[queueName]
+	if !ok {
+		return newError(replyNotFound, "no queue '%s'", queueName)
+	}
+	if q.owner != nil && q.owner != ch.conn {
+		return newError(replyResourceLocked, "cannot obtain exclusive access to locked queue '%s'", queueName)
+	}
+	for _, other := range q.consumers {
+		if other.exclusive || exclusive {
+			return newError(replyAccessRefused, "queue '%s' in exclusive use", queueName)
+		}
+	}
+	if tag == "" {
+		tag = b.generateName("amq.ctag-")
+	}
+	if _, ok := ch.consumers[tag]; ok {
+		return newError(replyNotAllowed, "consumer tag '%s' is in use", tag)
+	}
+
+	cons := &consumer{tag: tag, channel: ch, queue: q, noAck: noAck, exclusive: exclusive}
+	ch.consumers[tag] = cons
+	q.consumers = append(q.consumers, cons)
+	q.hadConsumers = true
+
+	if !noWait {
+		ch.send(basicConsumeOk, func(e *encoder) {
+			e.shortstr(tag)
+		})
+	}
+	b.dispatch(q)
+	return nil
+}
+
+func (ch *channel) basicCancel(d *decoder) *amqpError {
+	tag := d.shortstr()
+	noWait := d.octet()&1 != 0
+
+	if cons, ok := ch.consumers[tag]; ok {
+		delete(ch.consumers, tag)
+		ch.conn.broker.removeConsumer(cons)
+	}
+
+	if !noWait {
+		ch.send(basicCancelOk, func(e *encoder) {
+			e.shortstr(tag)
+		})
+	}
+	return nil
+}
+
+func (ch *channel) basicGet(d *decoder) *amqpError {
+	d.short()
+	name := d.shortstr()
+	noAck := d.octet()&1 != 0
+
+	q, ok := ch.conn.broker.queues[name]
+	if !ok {
+		return newError(replyNotFound, "no queue '%s'", name)
+	}
+	ch.conn.broker.expire(q)
+	if len(q.messages) == 0 {
+		ch.send(basicGetEmpty, func(e *encoder) {
+			e.shortstr("")
+		})
+		return nil
+	}
+
+	msg := q.messages[0]
+	q.messages = q.messages[1:]
+	ch.deliveryTag++
+	tag := ch.deliveryTag
+	if !noAck {
+		ch.unacked[tag] = unacked{msg: msg, queue: q}
+	}
+
+	ch.conn.sendContent(ch.id, basicGetOk, func(e *encoder) {
+		e.longlong(tag)
+		e.octet(boolBit(msg.redelivered))
+		e.shortstr(msg.exchange)
+		e.shortstr(msg.routingKey)
+		e.long(uint32(len(q.messages)))
+	}, msg)
+	return nil
+}
+
+func (ch *channel) handleHeader(payload []byte) *amqpError {
+	// The body is allocated once the header arrives
+	if ch.publishing == nil || ch.publishing.msg.body != nil {
+		return newError(replyCommandInvalid, "unexpected content header")
+	}
+
+	d := &decoder{buf: payload}
+	d.short()
+	d.short()
+	size := d.longlong()
+	ch.publishing.msg.properties = decodeProperties(d)
+	if d.err != nil {
+		return newError(replyCommandInvalid, "malformed content header")
+	}
+
+	ch.publishing.size = int(size)
+	ch.publishing.msg.body = make([]byte, 0, size)
+	if size == 0 {
+		ch.publish()
+	}
+	return nil
+}
+
+func (ch *channel) handleBody(payload []byte) *amqpError {
+	p := ch.publishing
+	if p == nil || p.msg.body == nil || len(p.msg.body)+len(payload) > p.size {
+		return newError(replyCommandInvalid, "unexpected content body")
+	}
+
+	p.msg.body = append(p.msg.body, payload...)
+	if len(p.msg.body) == p.size {
+		ch.publish()
+	}
+	return nil
+}
+
+// publish routes the received message, returns it if it's mandatory and unroutable and confirms it
+func (ch *channel) publish() {
+	p := ch.publishing
+	ch.publishing = nil
+
+	b := ch.conn.broker
+	queues, ok := b.route(p.msg.exchange, p.msg.routingKey)
+	if !ok {
+		ch.fail(newError(replyNotFound, "no exchange '%s'", p.msg.exchange))
+		return
+	}
+
+	if ch.confirm {
+		ch.published++
+	}
+	if ch.confirm && b.rejectPublishes {
+		ch.confirmPublish(basicNack)
+		return
+	}
+
+	if len(queues) == 0 && p.mandatory {
+		ch.conn.sendContent(ch.id, basicReturn, func(e *encoder) {
+			e.short(replyNoRoute)
+			e.shortstr("NO_ROUTE")
+			e.shortstr(p.msg.exchange)
+			e.shortstr(p.msg.routingKey)
+		}, p.msg)
+	}
+	b.enqueue(queues, p.msg)
+
+	if ch.confirm {
+		ch.confirmPublish(basicAck)
+	}
+}
+
+func (ch *channel) confirmPublish(id methodID) {
+	tag := ch.published
+	ch.send(id, func(e *encoder) {
+		e.longlong(tag)
+		e.octet(0)
+	})
+}
+
+// deliver sends a message to the consumer
+func (ch *channel) deliver(cons *consumer, msg *message) {
+	ch.deliveryTag++
+	tag := ch.deliveryTag
+	if !cons.noAck {
+		ch.unacked[tag] = unacked{msg: msg, queue: cons.queue, consumer: cons}
+		cons.unacked++
+	}
+
+	ch.conn.sendContent(ch.id, basicDeliver, func(e *encoder) {
+		e.shortstr(cons.tag)
+		e.longlong(tag)
+		e.octet(boolBit(msg.redelivered))
+		e.shortstr(msg.exchange)
+		e.shortstr(msg.routingKey)
+	}, msg)
+}
+
+// settle removes acknowledged deliveries, all up to the tag if multiple is set, and passes them to fn
+func (ch *channel) settle(tag uint64, multiple bool, fn func(u unacked)) *amqpError {
+	var tags []uint64
+	if multiple {
+		for t := range ch.unacked {
+			if t <= tag || tag == 0 {
+				tags = append(tags, t)
+			}
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	} else {
+		if _, ok := ch.unacked[tag]; !ok {
+			return newError(replyPreconditionFailed, "unknown delivery tag %d", tag)
+		}
+		tags = []uint64{tag}
+	}
+
+	queues := make(map[*queue]bool)
+	for _, t := range tags {
+		u := ch.unacked[t]
+		delete(ch.unacked, t)
+		if u.consumer != nil {
+			u.consumer.unacked--
+		}
+		queues[u.queue] = true
+		fn(u)
+	}
+
+	// Acknowledgements free capacity of consumers
+	for q := range queues {
+		ch.conn.broker.dispatch(q)
+	}
+	return nil
+}
+
+// reject requeues or dead-letters deliveries
+func (ch *channel) reject(tag uint64, multiple, requeue bool) *amqpError {
+	b := ch.conn.broker
+	requeued := make(map[*queue][]*message)
+	err := ch.settle(tag, multiple, func(u unacked) {
+		if requeue {
+			requeued[u.queue] = append(requeued[u.queue], u.msg)
+		} else {
+			b.deadLetter(u.queue, u.msg, "rejected")
+		}
+	})
+	for q, messages := range requeued {
+		b.requeue(q, messages)
+	}
+	return err
+}
+
+// fail closes the channel with the error, as the broker does on channel exceptions
+func (ch *channel) fail(err *amqpError) {
+	ch.close()
+	ch.closing = true
+	ch.send(channelClose, func(e *encoder) {
+		e.short(err.code)
+		e.shortstr(err.text)
+		e.short(0)
+		e.short(0)
+	})
+}
+
+// close cancels consumers and requeues unacknowledged deliveries
+func (ch *channel) close() {
+	b := ch.conn.broker
+	for tag, cons := range ch.consumers {
+		delete(ch.consumers, tag)
+		b.removeConsumer(cons)
+	}
+	ch.publishing = nil
+
+	tags := make([]uint64, 0, len(ch.unacked))
+	for tag := range ch.unacked {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	requeued := make(map[*queue][]*message)
+	for _, tag := range tags {
+		u := ch.unacked[tag]
+		requeued[u.queue] = append(requeued[u.queue], u.msg)
+	}
+	ch.unacked = make(map[uint64]unacked)
+	for q, messages := range requeued {
+		b.requeue(q, messages)
+	}
+}
+
+func (ch *channel) send(id methodID, encode func(e *encoder)) {
+	ch.conn.sendMethod(ch.id, id, encode)
+}
+
+func boolBit(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
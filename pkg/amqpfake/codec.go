@@ -0,0 +1,303 @@
+package amqpfake
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Frame types of AMQP 0-9-1
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+)
+
+// protocolHeader opens every AMQP 0-9-1 connection
+var protocolHeader = []byte{'A', 'M', 'Q', 'P', 0, 0, 9, 1}
+
+var errMalformed = errors.New("malformed frame")
+
+// Table is an AMQP field table, e.g. queue arguments or message headers
+type Table map[string]interface{}
+
+type frame struct {
+	typ     byte
+	channel uint16
+	payload []byte
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[3:7])
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return frame{}, err
+	}
+	if payload[size] != frameEnd {
+		return frame{}, errMalformed
+	}
+
+	return frame{
+		typ:     header[0],
+		channel: binary.BigEndian.Uint16(header[1:3]),
+		payload: payload[:size],
+	}, nil
+}
+
+// encode returns the frame as it's sent on the wire
+func (f frame) encode() []byte {
+	buf := make([]byte, 7, 8+len(f.payload))
+	buf[0] = f.typ
+	binary.BigEndian.PutUint16(buf[1:3], f.channel)
+	binary.BigEndian.PutUint32(buf[3:7], uint32(len(f.payload)))
+	buf = append(buf, f.payload...)
+	return append(buf, frameEnd)
+}
+
+// decoder reads AMQP fields, the first error sticks and makes all later reads return zero values
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if len(d.buf) < n {
+		d.err = errMalformed
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) octet() byte {
+	return d.next(1)[0]
+}
+
+func (d *decoder) short() uint16 {
+	return binary.BigEndian.Uint16(d.next(2))
+}
+
+func (d *decoder) long() uint32 {
+	return binary.BigEndian.Uint32(d.next(4))
+}
+
+func (d *decoder) longlong() uint64 {
+	return binary.BigEndian.Uint64(d.next(8))
+}
+
+func (d *decoder) shortstr() string {
+	return string(d.next(int(d.octet())))
+}
+
+func (d *decoder) longstr() []byte {
+	return d.next(int(d.long()))
+}
+
+func (d *decoder) table() Table {
+	inner := decoder{buf: d.longstr()}
+	if d.err != nil {
+		return nil
+	}
+
+	table := make(Table)
+	for len(inner.buf) > 0 && inner.err == nil {
+		key := inner.shortstr()
+		table[key] = inner.field()
+	}
+	d.err = inner.err
+	return table
+}
+
+func (d *decoder) array() []interface{} {
+	inner := decoder{buf: d.longstr()}
+	if d.err != nil {
+		return nil
+	}
+
+	var values []interface{}
+	for len(inner.buf) > 0 && inner.err == nil {
+		values = append(values, inner.field())
+	}
+	d.err = inner.err
+	return values
+}
+
+func (d *decoder) field() interface{} {
+	switch kind := d.octet(); kind {
+	case 't':
+		return d.octet() != 0
+	case 'b':
+		return int8(d.octet())
+	case 'B':
+		return d.octet()
+	case 's':
+		return int16(d.short())
+	case 'u':
+		return d.short()
+	case 'I':
+		return int32(d.long())
+	case 'i':
+		return d.long()
+	case 'l':
+		return int64(d.longlong())
+	case 'f':
+		return math.Float32frombits(d.long())
+	case 'd':
+		return math.Float64frombits(d.longlong())
+	case 'D':
+		scale := d.octet()
+		return decimal{Scale: scale, Value: int32(d.long())}
+	case 'S':
+		return string(d.longstr())
+	case 'x':
+		return append([]byte(nil), d.longstr()...)
+	case 'A':
+		return d.array()
+	case 'T':
+		return time.Unix(int64(d.longlong()), 0)
+	case 'F':
+		return d.table()
+	case 'V':
+		return nil
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("%w: unknown field type %q", errMalformed, kind)
+		}
+		return nil
+	}
+}
+
+// decimal is a field value of type 'D', kept only to be passed through
+type decimal struct {
+	Scale byte
+	Value int32
+}
+
+// encoder writes AMQP fields
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) octet(v byte) {
+	e.buf.WriteByte(v)
+}
+
+func (e *encoder) short(v uint16) {
+	e.buf.Write(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func (e *encoder) long(v uint32) {
+	e.buf.Write(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (e *encoder) longlong(v uint64) {
+	e.buf.Write(binary.BigEndian.AppendUint64(nil, v))
+}
+
+func (e *encoder) shortstr(v string) {
+	if len(v) > math.MaxUint8 {
+		v = v[:math.MaxUint8]
+	}
+	e.octet(byte(len(v)))
+	e.buf.WriteString(v)
+}
+
+func (e *encoder) longstr(v []byte) {
+	e.long(uint32(len(v)))
+	e.buf.Write(v)
+}
+
+func (e *encoder) table(table Table) {
+	var inner encoder
+	for key, value := range table {
+		inner.shortstr(key)
+		inner.field(value)
+	}
+	e.longstr(inner.buf.Bytes())
+}
+
+func (e *encoder) field(value interface{}) {
+	switch v := value.(type) {
+	case bool:
+		e.octet('t')
+		if v {
+			e.octet(1)
+		} else {
+			e.octet(0)
+		}
+	case int8:
+		e.octet('b')
+		e.octet(byte(v))
+	case byte:
+		e.octet('B')
+		e.octet(v)
+	case int16:
+		e.octet('s')
+		e.short(uint16(v))
+	case uint16:
+		e.octet('u')
+		e.short(v)
+	case int32:
+		e.octet('I')
+		e.long(uint32(v))
+	case uint32:
+		e.octet('i')
+		e.long(v)
+	case int:
+		e.octet('l')
+		e.longlong(uint64(v))
+	case int64:
+		e.octet('l')
+		e.longlong(uint64(v))
+	case float32:
+		e.octet('f')
+		e.long(math.Float32bits(v))
+	case float64:
+		e.octet('d')
+		e.longlong(math.Float64bits(v))
+	case decimal:
+		e.octet('D')
+		e.octet(v.Scale)
+		e.long(uint32(v.Value))
+	case string:
+		e.octet('S')
+		e.longstr([]byte(v))
+	case []byte:
+		e.octet('x')
+		e.longstr(v)
+	case []interface{}:
+		var inner encoder
+		for _, item := range v {
+			inner.field(item)
+		}
+		e.octet('A')
+		e.longstr(inner.buf.Bytes())
+	case time.Time:
+		e.octet('T')
+		e.longlong(uint64(v.Unix()))
+	case Table:
+		e.octet('F')
+		e.table(v)
+	case map[string]interface{}:
+		e.octet('F')
+		e.table(v)
+	default:
+		e.octet('V')
+	}
+}
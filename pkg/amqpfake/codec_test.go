@@ -0,0 +1,57 @@
+package amqpfake
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	f := frame{typ: frameMethod, channel: 7, payload: []byte("payload")}
+
+	read, err := readFrame(bufio.NewReader(bytes.NewReader(f.encode())))
+	assert.NoError(t, err)
+	assert.Equal(t, f, read)
+
+	// Test a frame without the end marker is rejected
+	data := f.encode()
+	data[len(data)-1] = 0
+	_, err = readFrame(bufio.NewReader(bytes.NewReader(data)))
+	assert.ErrorIs(t, err, errMalformed)
+}
+
+func TestPropertiesRoundTrip(t *testing.T) {
+	props := Properties{
+		ContentType:   "application/json",
+		DeliveryMode:  2,
+		CorrelationID: "corr-id",
+		ReplyTo:       "reply-queue",
+		Headers: Table{
+			"flag":   true,
+			"count":  int64(3),
+			"reason": "rejected",
+			"time":   time.Unix(1700000000, 0),
+			"nested": Table{"queue": "test"},
+			"list":   []interface{}{"first", int32(2)},
+		},
+	}
+
+	var e encoder
+	props.encode(&e)
+
+	d := &decoder{buf: e.buf.Bytes()}
+	assert.Equal(t, props, decodeProperties(d))
+	assert.NoError(t, d.err)
+}
+
+func TestDecoderStickyError(t *testing.T) {
+	d := &decoder{buf: []byte{0, 1}}
+
+	assert.Equal(t, uint16(1), d.short())
+	assert.Equal(t, uint32(0), d.long())
+	assert.ErrorIs(t, d.err, errMalformed)
+	assert.Equal(t, "", d.shortstr())
+}
@@ -0,0 +1,323 @@
+package amqpfake
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Limits the broker offers in connection.tune
+const (
+	channelMax = 2047
+	frameMax   = 131072
+)
+
+// amqpError closes a channel or a connection with the reply code
+type amqpError struct {
+	code uint16
+	text string
+}
+
+func newError(code uint16, format string, args ...interface{}) *amqpError {
+	return &amqpError{code: code, text: fmt.Sprintf(format, args...)}
+}
+
+// connection serves one client connection. Frames are handled one by one under the broker lock,
+// outgoing frames are queued, so the broker never blocks on a slow client.
+type connection struct {
+	broker  *Broker
+	netConn net.Conn
+
+	// Guarded by the broker lock
+	channels        map[uint16]*channel
+	frameMax        int
+	closing         bool
+	droppingContent map[uint16]bool // Channels whose content frames are dropped with their method
+
+	outMu     sync.Mutex
+	outCond   *sync.Cond
+	out       [][]byte
+	outClosed bool
+}
+
+func newConnection(b *Broker, netConn net.Conn) *connection {
+	c := &connection{
+		broker:          b,
+		netConn:         netConn,
+		channels:        make(map[uint16]*channel),
+		frameMax:        frameMax,
+		droppingContent: make(map[uint16]bool),
+	}
+	c.outCond = sync.NewCond(&c.outMu)
+	return c
+}
+
+// serve runs the connection until the client or the broker closes it
+func (c *connection) serve() {
+	defer c.broker.connectionsGroup.Done()
+
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		c.writeLoop()
+	}()
+
+	c.readLoop()
+
+	c.broker.mu.Lock()
+	c.teardown()
+	delete(c.broker.connections, c)
+	c.broker.mu.Unlock()
+
+	c.closeOutput()
+	<-writerDone
+	c.netConn.Close()
+}
+
+func (c *connection) readLoop() {
+	r := bufio.NewReader(c.netConn)
+
+	header := make([]byte, len(protocolHeader))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return
+	}
+	if !bytes.Equal(header, protocolHeader) {
+		// Tell the client which protocol is supported
+		c.netConn.Write(protocolHeader)
+		return
+	}
+
+	c.sendMethod(0, connectionStart, func(e *encoder) {
+		e.octet(0)
+		e.octet(9)
+		e.table(Table{
+			"product": "amqpfake",
+			"capabilities": Table{
+				"publisher_confirms":     true,
+				"basic.nack":             true,
+				"consumer_cancel_notify": true,
+			},
+		})
+		e.longstr([]byte("PLAIN"))
+		e.longstr([]byte("en_US"))
+	})
+
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+
+		c.broker.mu.Lock()
+		done := c.handleFrame(f)
+		c.broker.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// handleFrame handles a frame from the client, returns true if the connection is closed
+func (c *connection) handleFrame(f frame) bool {
+	if c.dropIncoming(f) {
+		return false
+	}
+	if f.typ == frameHeartbeat {
+		return false
+	}
+	if f.channel == 0 {
+		if f.typ != frameMethod {
+			return c.fail(newError(replyCommandInvalid, "unexpected frame on channel 0"))
+		}
+		return c.handleConnectionMethod(f.payload)
+	}
+	if c.closing {
+		return false
+	}
+
+	ch, ok := c.channels[f.channel]
+	if !ok {
+		if f.typ == frameMethod {
+			d := &decoder{buf: f.payload}
+			if methodID(d.long()) == channelOpen {
+				ch = newChannel(c, f.channel)
+				c.channels[f.channel] = ch
+				c.sendMethod(f.channel, channelOpenOk, func(e *encoder) {
+					e.longstr(nil)
+				})
+				return false
+			}
+		}
+		return c.fail(newError(replyChannelError, "channel %d is not open", f.channel))
+	}
+
+	if err := ch.handleFrame(f); err != nil {
+		if err.code == replyCommandInvalid || err.code == replyChannelError || err.code == replyNotImplemented {
+			return c.fail(err)
+		}
+		ch.fail(err)
+	}
+	return false
+}
+
+func (c *connection) handleConnectionMethod(payload []byte) bool {
+	d := &decoder{buf: payload}
+	id := methodID(d.long())
+
+	switch id {
+	case connectionStartOk:
+		c.sendMethod(0, connectionTune, func(e *encoder) {
+			e.short(channelMax)
+			e.long(frameMax)
+			e.short(0) // The client's heartbeat is taken
+		})
+	case connectionTuneOk:
+		d.short()
+		if size := int(d.long()); size > 0 && size < c.frameMax {
+			c.frameMax = size
+		}
+		if heartbeat := time.Duration(d.short()) * time.Second; heartbeat > 0 {
+			go c.heartbeatLoop(heartbeat / 2)
+		}
+	case connectionOpen:
+		c.sendMethod(0, connectionOpenOk, func(e *encoder) {
+			e.shortstr("")
+		})
+	case connectionClose:
+		c.sendMethod(0, connectionCloseOk, nil)
+		return true
+	case connectionCloseOk:
+		return true
+	default:
+		return c.fail(newError(replyNotImplemented, "method %d.%d is not implemented", id.class(), id.method()))
+	}
+	return d.err != nil
+}
+
+// fail closes the connection with the error
+func (c *connection) fail(err *amqpError) bool {
+	c.sendMethod(0, connectionClose, func(e *encoder) {
+		e.short(err.code)
+		e.shortstr(err.text)
+		e.short(0)
+		e.short(0)
+	})
+	return true
+}
+
+// teardown closes all channels and deletes exclusive queues, the caller must hold the broker lock
+func (c *connection) teardown() {
+	c.closing = true
+	for _, ch := range c.channels {
+		ch.close()
+	}
+	c.channels = make(map[uint16]*channel)
+
+	for _, q := range c.broker.queues {
+		if q.owner == c {
+			c.broker.deleteQueue(q)
+		}
+	}
+}
+
+func (c *connection) heartbeatLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !c.send(frame{typ: frameHeartbeat}) {
+			return
+		}
+	}
+}
+
+// sendMethod queues a method frame, encode writes the arguments
+func (c *connection) sendMethod(channel uint16, id methodID, encode func(e *encoder)) {
+	var e encoder
+	e.long(uint32(id))
+	if encode != nil {
+		encode(&e)
+	}
+	c.send(frame{typ: frameMethod, channel: channel, payload: e.buf.Bytes()})
+}
+
+// sendContent queues a method frame followed by the content of the message
+func (c *connection) sendContent(channel uint16, id methodID, encode func(e *encoder), msg *message) {
+	var method encoder
+	method.long(uint32(id))
+	encode(&method)
+
+	var header encoder
+	header.short(basicClass)
+	header.short(0)
+	header.longlong(uint64(len(msg.body)))
+	msg.properties.encode(&header)
+
+	frames := []frame{
+		{typ: frameMethod, channel: channel, payload: method.buf.Bytes()},
+		{typ: frameHeader, channel: channel, payload: header.buf.Bytes()},
+	}
+	maxBody := c.frameMax - 8
+	for body := msg.body; len(body) > 0; {
+		size := min(len(body), maxBody)
+		frames = append(frames, frame{typ: frameBody, channel: channel, payload: body[:size]})
+		body = body[size:]
+	}
+	c.send(frames...)
+}
+
+// send queues frames for the writer, returns false if the connection is closed.
+// Frames of one method are sent together, so they are dropped together by DropFrames.
+func (c *connection) send(frames ...frame) bool {
+	if len(frames) > 0 && c.broker.dropFrame(ToClient, frames[0]) {
+		return true
+	}
+
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	if c.outClosed {
+		return false
+	}
+	for _, f := range frames {
+		c.out = append(c.out, f.encode())
+	}
+	c.outCond.Signal()
+	return true
+}
+
+func (c *connection) closeOutput() {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	c.outClosed = true
+	c.outCond.Signal()
+}
+
+// writeLoop writes queued frames until the output is closed and drained
+func (c *connection) writeLoop() {
+	for {
+		c.outMu.Lock()
+		for len(c.out) == 0 && !c.outClosed {
+			c.outCond.Wait()
+		}
+		out := c.out
+		c.out = nil
+		closed := c.outClosed
+		c.outMu.Unlock()
+
+		for _, data := range out {
+			if _, err := c.netConn.Write(data); err != nil {
+				c.netConn.Close()
+				return
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
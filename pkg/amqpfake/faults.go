@@ -0,0 +1,87 @@
+package amqpfake
+
+import "fmt"
+
+// Direction of a frame
+type Direction int
+
+const (
+	// ToBroker frames are sent by clients
+	ToBroker Direction = iota
+	// ToClient frames are sent by the broker
+	ToClient
+)
+
+// FrameInfo describes a frame for the filter of DropFrames
+type FrameInfo struct {
+	Direction Direction
+	Channel   uint16
+	Method    string // Method of method frames and of the content they carry, e.g. "basic.deliver"; empty for heartbeats
+}
+
+// dropFilter decides which frames are dropped
+type dropFilter func(FrameInfo) bool
+
+// KillConnections drops all client connections without the closing handshake, as if the network failed.
+// It returns the number of killed connections.
+func (b *Broker) KillConnections() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.connections {
+		c.netConn.Close()
+	}
+	return len(b.connections)
+}
+
+// DropFrames makes the broker drop frames for which drop returns true, both received and sent ones,
+// as if they were lost on the way. Content frames are dropped with the method frame before them.
+// Dropped frames aren't seen by the other side, e.g. a dropped delivery stays unacknowledged
+// until the consumer's channel is closed. A nil filter stops dropping.
+func (b *Broker) DropFrames(drop func(FrameInfo) bool) {
+	if drop == nil {
+		b.dropFilter.Store(nil)
+		return
+	}
+	filter := dropFilter(drop)
+	b.dropFilter.Store(&filter)
+}
+
+// dropFrame reports whether the frame is dropped
+func (b *Broker) dropFrame(direction Direction, f frame) bool {
+	filter := b.dropFilter.Load()
+	if filter == nil {
+		return false
+	}
+
+	info := FrameInfo{Direction: direction, Channel: f.channel}
+	if f.typ == frameMethod {
+		d := &decoder{buf: f.payload}
+		info.Method = methodID(d.long()).String()
+	}
+	return (*filter)(info)
+}
+
+// dropIncoming reports whether a frame received from the client is dropped.
+// The broker lock must be held, it guards the connection state.
+func (c *connection) dropIncoming(f frame) bool {
+	switch f.typ {
+	case frameMethod:
+		// The method decides for the content frames following it on its channel
+		drop := c.broker.dropFrame(ToBroker, f)
+		c.droppingContent[f.channel] = drop
+		return drop
+	case frameHeader, frameBody:
+		return c.droppingContent[f.channel]
+	default:
+		return c.broker.dropFrame(ToBroker, f)
+	}
+}
+
+// String returns the name of the method, e.g. "basic.publish"
+func (id methodID) String() string {
+	if name, ok := methodNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d.%d", id.class(), id.method())
+}
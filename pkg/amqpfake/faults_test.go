@@ -0,0 +1,56 @@
+package amqpfake
+
+import (
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropFrames(t *testing.T) {
+	broker, err := NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start broker: %v", err)
+	}
+	defer broker.Close()
+
+	conn, err := amqp091.Dial(broker.URL())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	assert.NoError(t, err)
+	_, err = ch.QueueDeclare("test-drop", false, false, false, false, nil)
+	assert.NoError(t, err)
+
+	var dropped []FrameInfo
+	broker.DropFrames(func(f FrameInfo) bool {
+		if f.Direction == ToBroker && f.Method == "basic.publish" {
+			dropped = append(dropped, f)
+			return true
+		}
+		return false
+	})
+	assert.NoError(t, ch.Publish("", "test-drop", false, false, amqp091.Publishing{Body: []byte("lost")}))
+
+	// Test the content of a dropped publish is dropped too, so the channel stays usable
+	_, ok, err := ch.Get("test-drop", true)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []FrameInfo{{Direction: ToBroker, Channel: 1, Method: "basic.publish"}}, dropped)
+
+	broker.DropFrames(nil)
+	assert.NoError(t, ch.Publish("", "test-drop", false, false, amqp091.Publishing{Body: []byte("delivered")}))
+
+	msg, ok, err := ch.Get("test-drop", true)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "delivered", string(msg.Body))
+
+	// Test killed connections are closed for the client without the closing handshake
+	closed := conn.NotifyClose(make(chan *amqp091.Error, 1))
+	assert.Equal(t, 1, broker.KillConnections())
+	assert.NotNil(t, <-closed)
+}
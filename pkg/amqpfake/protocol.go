@@ -0,0 +1,269 @@
+package amqpfake
+
+// methodID identifies a method by its class and method numbers
+type methodID uint32
+
+func newMethodID(class, method uint16) methodID {
+	return methodID(class)<<16 | methodID(method)
+}
+
+func (id methodID) class() uint16 {
+	return uint16(id >> 16)
+}
+
+func (id methodID) method() uint16 {
+	return uint16(id)
+}
+
+// Methods of AMQP 0-9-1 the broker understands
+var (
+	connectionStart   = newMethodID(10, 10)
+	connectionStartOk = newMethodID(10, 11)
+	connectionTune    = newMethodID(10, 30)
+	connectionTuneOk  = newMethodID(10, 31)
+	connectionOpen    = newMethodID(10, 40)
+	connectionOpenOk  = newMethodID(10, 41)
+	connectionClose   = newMethodID(10, 50)
+	connectionCloseOk = newMethodID(10, 51)
+
+	channelOpen    = newMethodID(20, 10)
+	channelOpenOk  = newMethodID(20, 11)
+	channelClose   = newMethodID(20, 40)
+	channelCloseOk = newMethodID(20, 41)
+
+	exchangeDeclare   = newMethodID(40, 10)
+	exchangeDeclareOk = newMethodID(40, 11)
+
+	queueDeclare   = newMethodID(50, 10)
+	queueDeclareOk = newMethodID(50, 11)
+	queueBind      = newMethodID(50, 20)
+	queueBindOk    = newMethodID(50, 21)
+	queuePurge     = newMethodID(50, 30)
+	queuePurgeOk   = newMethodID(50, 31)
+	queueDelete    = newMethodID(50, 40)
+	queueDeleteOk  = newMethodID(50, 41)
+
+	basicQos       = newMethodID(60, 10)
+	basicQosOk     = newMethodID(60, 11)
+	basicConsume   = newMethodID(60, 20)
+	basicConsumeOk = newMethodID(60, 21)
+	basicCancel    = newMethodID(60, 30)
+	basicCancelOk  = newMethodID(60, 31)
+	basicPublish   = newMethodID(60, 40)
+	basicReturn    = newMethodID(60, 50)
+	basicDeliver   = newMethodID(60, 60)
+	basicGet       = newMethodID(60, 70)
+	basicGetOk     = newMethodID(60, 71)
+	basicGetEmpty  = newMethodID(60, 72)
+	basicAck       = newMethodID(60, 80)
+	basicReject    = newMethodID(60, 90)
+	basicNack      = newMethodID(60, 120)
+
+	confirmSelect   = newMethodID(85, 10)
+	confirmSelectOk = newMethodID(85, 11)
+)
+
+// methodNames are the names of methods as the specification spells them
+var methodNames = map[methodID]string{
+	connectionStart:   "connection.start",
+	connectionStartOk: "connection.start-ok",
+	connectionTune:    "connection.tune",
+	connectionTuneOk:  "connection.tune-ok",
+	connectionOpen:    "connection.open",
+	connectionOpenOk:  "connection.open-ok",
+	connectionClose:   "connection.close",
+	connectionCloseOk: "connection.close-ok",
+
+	channelOpen:    "channel.open",
+	channelOpenOk:  "channel.open-ok",
+	channelClose:   "channel.close",
+	channelCloseOk: "channel.close-ok",
+
+	exchangeDeclare:   "exchange.declare",
+	exchangeDeclareOk: "exchange.declare-ok",
+
+	queueDeclare:   "queue.declare",
+	queueDeclareOk: "queue.declare-ok",
+	queueBind:      "queue.bind",
+	queueBindOk:    "queue.bind-ok",
+	queuePurge:     "queue.purge",
+	queuePurgeOk:   "queue.purge-ok",
+	queueDelete:    "queue.delete",
+	queueDeleteOk:  "queue.delete-ok",
+
+	basicQos:       "basic.qos",
+	basicQosOk:     "basic.qos-ok",
+	basicConsume:   "basic.consume",
+	basicConsumeOk: "basic.consume-ok",
+	basicCancel:    "basic.cancel",
+	basicCancelOk:  "basic.cancel-ok",
+	basicPublish:   "basic.publish",
+	basicReturn:    "basic.return",
+	basicDeliver:   "basic.deliver",
+	basicGet:       "basic.get",
+	basicGetOk:     "basic.get-ok",
+	basicGetEmpty:  "basic.get-empty",
+	basicAck:       "basic.ack",
+	basicReject:    "basic.reject",
+	basicNack:      "basic.nack",
+
+	confirmSelect:   "confirm.select",
+	confirmSelectOk: "confirm.select-ok",
+}
+
+// basicClass is the class of content frames of messages
+const basicClass = 60
+
+// Reply codes of AMQP 0-9-1
+const (
+	replyNoRoute            = 312
+	replyAccessRefused      = 403
+	replyNotFound           = 404
+	replyResourceLocked     = 405
+	replyPreconditionFailed = 406
+	replyNotAllowed         = 530
+	replyCommandInvalid     = 503
+	replyChannelError       = 504
+	replyNotImplemented     = 540
+)
+
+// Property flags of content headers, in the order the properties are encoded
+const (
+	flagContentType     = 0x8000
+	flagContentEncoding = 0x4000
+	flagHeaders         = 0x2000
+	flagDeliveryMode    = 0x1000
+	flagPriority        = 0x0800
+	flagCorrelationID   = 0x0400
+	flagReplyTo         = 0x0200
+	flagExpiration      = 0x0100
+	flagMessageID       = 0x0080
+	flagTimestamp       = 0x0040
+	flagType            = 0x0020
+	flagUserID          = 0x0010
+	flagAppID           = 0x0008
+)
+
+// Properties are the basic properties of a message
+type Properties struct {
+	ContentType     string
+	ContentEncoding string
+	Headers         Table
+	DeliveryMode    uint8 // 2 for persistent messages
+	Priority        uint8
+	CorrelationID   string
+	ReplyTo         string
+	Expiration      string
+	MessageID       string
+	Timestamp       uint64
+	Type            string
+	UserID          string
+	AppID           string
+}
+
+func decodeProperties(d *decoder) Properties {
+	var p Properties
+	flags := d.short()
+
+	if flags&flagContentType != 0 {
+		p.ContentType = d.shortstr()
+	}
+	if flags&flagContentEncoding != 0 {
+		p.ContentEncoding = d.shortstr()
+	}
+	if flags&flagHeaders != 0 {
+		p.Headers = d.table()
+	}
+	if flags&flagDeliveryMode != 0 {
+		p.DeliveryMode = d.octet()
+	}
+	if flags&flagPriority != 0 {
+		p.Priority = d.octet()
+	}
+	if flags&flagCorrelationID != 0 {
+		p.CorrelationID = d.shortstr()
+	}
+	if flags&flagReplyTo != 0 {
+		p.ReplyTo = d.shortstr()
+	}
+	if flags&flagExpiration != 0 {
+		p.Expiration = d.shortstr()
+	}
+	if flags&flagMessageID != 0 {
+		p.MessageID = d.shortstr()
+	}
+	if flags&flagTimestamp != 0 {
+		p.Timestamp = d.longlong()
+	}
+	if flags&flagType != 0 {
+		p.Type = d.shortstr()
+	}
+	if flags&flagUserID != 0 {
+		p.UserID = d.shortstr()
+	}
+	if flags&flagAppID != 0 {
+		p.AppID = d.shortstr()
+	}
+	return p
+}
+
+func (p Properties) encode(e *encoder) {
+	var flags uint16
+	var fields encoder
+
+	if p.ContentType != "" {
+		flags |= flagContentType
+		fields.shortstr(p.ContentType)
+	}
+	if p.ContentEncoding != "" {
+		flags |= flagContentEncoding
+		fields.shortstr(p.ContentEncoding)
+	}
+	if len(p.Headers) > 0 {
+		flags |= flagHeaders
+		fields.table(p.Headers)
+	}
+	if p.DeliveryMode != 0 {
+		flags |= flagDeliveryMode
+		fields.octet(p.DeliveryMode)
+	}
+	if p.Priority != 0 {
+		flags |= flagPriority
+		fields.octet(p.Priority)
+	}
+	if p.CorrelationID != "" {
+		flags |= flagCorrelationID
+		fields.shortstr(p.CorrelationID)
+	}
+	if p.ReplyTo != "" {
+		flags |= flagReplyTo
+		fields.shortstr(p.ReplyTo)
+	}
+	if p.Expiration != "" {
+		flags |= flagExpiration
+		fields.shortstr(p.Expiration)
+	}
+	if p.MessageID != "" {
+		flags |= flagMessageID
+		fields.shortstr(p.MessageID)
+	}
+	if p.Timestamp != 0 {
+		flags |= flagTimestamp
+		fields.longlong(p.Timestamp)
+	}
+	if p.Type != "" {
+		flags |= flagType
+		fields.shortstr(p.Type)
+	}
+	if p.UserID != "" {
+		flags |= flagUserID
+		fields.shortstr(p.UserID)
+	}
+	if p.AppID != "" {
+		flags |= flagAppID
+		fields.shortstr(p.AppID)
+	}
+
+	e.short(flags)
+	e.buf.Write(fields.buf.Bytes())
+}
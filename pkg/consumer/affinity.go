@@ -0,0 +1,207 @@
+package consumer
+
+import (
+	"errors"
+	"hash/fnv"
+	"sort"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+)
+
+// shardQueueSize is how many requests wait for the worker of a shard before the dispatcher blocks
+const shardQueueSize = 16
+
+// KeyFunc returns the keys a request operates on, none if it has none
+type KeyFunc func(string) []string
+
+// WithKeyAffinity makes the consumer execute requests with the same key in the order they were received.
+// Every worker owns a shard of keys with its own queue, a request goes to the shard of its key hash,
+// so requests for different keys are still executed in parallel. Requests without a key go to the shards in turn.
+// A request with keys of several shards, e.g. a batch or a transaction, holds all of them until it's executed.
+// A failed request is retried by the worker of its shard right away, so no later request for its keys overtakes it.
+// The pool can't be autoscaled.
+func WithKeyAffinity(keys KeyFunc) Option {
+	return func(c *Consumer) {
+		c.keyOf = keys
+	}
+}
+
+// errAffinityAutoscaling is returned by Start if both key affinity and autoscaling are set
+var errAffinityAutoscaling = errors.New("key affinity needs a fixed worker pool, it can't be combined with autoscaling")
+
+// shardTask is a request queued for the worker of a shard
+type shardTask struct {
+	req     mq.Request
+	barrier *shardBarrier // Set if the request has keys of several shards
+	owner   bool          // The worker executes the request, the workers of the other shards wait for it
+}
+
+// shardBarrier holds the shards of a request with keys of several shards until it's executed
+type shardBarrier struct {
+	others  int           // Number of shards waiting for the owner
+	arrived chan struct{} // Every other shard sends once its worker reached the request
+	done    chan struct{} // Closed once the request is executed
+}
+
+// startShards spawns a worker per shard and the dispatcher passing requests to them
+func (c *Consumer) startShards(reqCh <-chan mq.Request) {
+	c.shards = make([]chan shardTask, max(c.workerCount, 1))
+	for i := range c.shards {
+		c.shards[i] = make(chan shardTask, shardQueueSize)
+		c.wg.Add(1)
+		c.workers.Add(1)
+		go c.shardWorker(c.shards[i])
+	}
+	c.wg.Add(1)
+	go c.dispatch(reqCh)
+}
+
+// dispatch passes requests to the shards of their keys until the server closes the requests channel
+// or the consumer exits. The shards are closed then, so their workers exit once the queued requests are processed.
+func (c *Consumer) dispatch(reqCh <-chan mq.Request) {
+	defer c.wg.Done()
+	defer func() {
+		for _, shard := range c.shards {
+			close(shard)
+		}
+	}()
+
+	next := 0
+	for {
+		select {
+		case req, ok := <-reqCh:
+			if !ok {
+				return
+			}
+			shards := c.shardsOf(req, next)
+			next = (next + 1) % len(c.shards)
+
+			if !c.enqueue(req, shards) {
+				return
+			}
+		case <-c.stopChan:
+			return
+		}
+	}
+}
+
+// enqueue passes a request to its shards, the first one executes it. It returns false if the consumer exits meanwhile.
+func (c *Consumer) enqueue(req mq.Request, shards []int) bool {
+	var barrier *shardBarrier
+	if len(shards) > 1 {
+		barrier = &shardBarrier{
+			others:  len(shards) - 1,
+			arrived: make(chan struct{}, len(shards)-1),
+			done:    make(chan struct{}),
+		}
+	}
+
+	c.pending.Add(1)
+	for i, shard := range shards {
+		select {
+		case c.shards[shard] <- shardTask{req: req, barrier: barrier, owner: i == 0}:
+		case <-c.stopChan:
+			if i == 0 {
+				// No worker has the request, let the server pass it to another consumer
+				c.pending.Add(-1)
+				c.nack(req, true)
+			}
+			// Otherwise the request is queued, it's abandoned or given back by its owner
+			return false
+		}
+	}
+	return true
+}
+
+// shardWorker executes the requests of a shard in order until the shard is closed or the consumer exits
+func (c *Consumer) shardWorker(shard <-chan shardTask) {
+	defer c.wg.Done()
+	defer c.workers.Add(-1)
+
+	for {
+		select {
+		case task, ok := <-shard:
+			if !ok {
+				return
+			}
+			if !task.owner {
+				// Hold the shard until the owner executed the request
+				task.barrier.arrived <- struct{}{}
+				select {
+				case <-task.barrier.done:
+				case <-c.stopChan:
+					return
+				}
+				continue
+			}
+
+			c.pending.Add(-1)
+			if task.barrier != nil && !c.awaitShards(task.barrier) {
+				// The other shards may never reach the request, let the server pass it to another consumer
+				c.nack(task.req, true)
+				return
+			}
+			c.busy.Add(1)
+			c.process(task.req)
+			c.busy.Add(-1)
+			if task.barrier != nil {
+				close(task.barrier.done)
+			}
+		case <-c.stopChan:
+			return
+		}
+	}
+}
+
+// awaitShards waits until the workers of the other shards of a request reached it, false if the consumer exits first
+func (c *Consumer) awaitShards(barrier *shardBarrier) bool {
+	for i := 0; i < barrier.others; i++ {
+		select {
+		case <-barrier.arrived:
+		case <-c.stopChan:
+			return false
+		}
+	}
+	return true
+}
+
+// shardsOf returns the shards of the request keys in ascending order, or the next shard if the request has no key
+func (c *Consumer) shardsOf(req mq.Request, next int) []int {
+	seen := make(map[int]bool)
+	var shards []int
+	for _, key := range c.requestKeys(req) {
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		shard := int(hash.Sum32() % uint32(len(c.shards)))
+		if !seen[shard] {
+			seen[shard] = true
+			shards = append(shards, shard)
+		}
+	}
+	if len(shards) == 0 {
+		return []int{next}
+	}
+	sort.Ints(shards)
+	return shards
+}
+
+// requestKeys returns the keys of a request, or of all requests of a batch
+func (c *Consumer) requestKeys(req mq.Request) []string {
+	if !req.Batch {
+		return c.keyOf(req.Data)
+	}
+	requests, err := mq.DecodeBatch(req.Data)
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	for _, request := range requests {
+		keys = append(keys, c.keyOf(request)...)
+	}
+	return keys
+}
+
+// queued returns the number of requests waiting in the shards
+func (c *Consumer) queued() int {
+	return int(c.pending.Load())
+}
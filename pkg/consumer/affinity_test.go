@@ -0,0 +1,310 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerKeyAffinity(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	// Requests are "key:sequence", the handler records the order of sequences per key
+	var mu sync.Mutex
+	executed := make(map[string][]int)
+	var running, maxRunning atomic.Int64
+	handler := func(msg string) (string, error) {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := maxRunning.Load()
+			if current <= previous || maxRunning.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		key, sequence, _ := strings.Cut(msg, ":")
+		number, err := strconv.Atoi(sequence)
+		if err != nil {
+			return "", err
+		}
+		// Every other request is slow, so a free worker would overtake it with the next one
+		if number%2 == 0 {
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		mu.Lock()
+		executed[key] = append(executed[key], number)
+		mu.Unlock()
+		return "processed: " + msg, nil
+	}
+	keyOf := func(msg string) []string {
+		key, _, _ := strings.Cut(msg, ":")
+		return []string{key}
+	}
+	consumer := NewConsumer(server, 4, handler, WithKeyAffinity(keyOf))
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+	assert.Equal(t, 4, consumer.Workers())
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// One client sends requests for two keys in order, the keys have different shards
+	const keys, perKey = 2, 50
+	var replyChans []<-chan mq.Reply
+	for i := 0; i < perKey; i++ {
+		for k := 0; k < keys; k++ {
+			replyChan, err := client.Request(fmt.Sprintf("key%d:%d", k, i))
+			assert.NoError(t, err)
+			replyChans = append(replyChans, replyChan)
+		}
+	}
+	for _, replyChan := range replyChans {
+		select {
+		case reply := <-replyChan:
+			assert.NoError(t, reply.Err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for reply")
+		}
+	}
+
+	// Test requests for a key are executed in order, and different keys in parallel
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, executed, keys)
+	for key, sequences := range executed {
+		assert.Len(t, sequences, perKey, key)
+		for i, number := range sequences {
+			assert.Equal(t, i, number, key)
+		}
+	}
+	assert.Greater(t, maxRunning.Load(), int64(1))
+}
+
+// splitKeys is a KeyFunc of requests "key:sequence", several keys are separated by commas, e.g. "a,b:1"
+func splitKeys(msg string) []string {
+	keys, _, _ := strings.Cut(msg, ":")
+	if keys == "" {
+		return nil
+	}
+	return strings.Split(keys, ",")
+}
+
+// keysOfShards returns two keys of different shards of the consumer
+func keysOfShards(consumer *Consumer) (string, string) {
+	first := consumer.shardsOf(mq.Request{Data: "key0:0"}, 0)
+	for i := 1; ; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if consumer.shardsOf(mq.Request{Data: key + ":0"}, 0)[0] != first[0] {
+			return "key0", key
+		}
+	}
+}
+
+func TestConsumerKeyAffinityShards(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	consumer := NewConsumer(server, 3, nil, WithKeyAffinity(splitKeys))
+	consumer.shards = make([]chan shardTask, 3)
+	first, second := keysOfShards(consumer)
+	shards := []int{consumer.shardsOf(mq.Request{Data: first + ":0"}, 0)[0], consumer.shardsOf(mq.Request{Data: second + ":0"}, 0)[0]}
+	sort.Ints(shards)
+
+	// Test a batch and a request with keys of several shards go to all of them, requests without a key to the given shard
+	batch, err := mq.EncodeBatch([]string{first + ":1", second + ":2", first + ":3"})
+	assert.NoError(t, err)
+	assert.Equal(t, shards, consumer.shardsOf(mq.Request{Data: batch, Batch: true}, 0))
+	assert.Equal(t, shards, consumer.shardsOf(mq.Request{Data: second + "," + first + ":1"}, 0))
+	assert.Equal(t, []int{2}, consumer.shardsOf(mq.Request{Data: ":1"}, 2))
+}
+
+// orderRecorder is a handler of requests "keys:sequence" recording the order of sequences per key
+type orderRecorder struct {
+	mu       sync.Mutex
+	executed map[string][]int
+	fail     map[string]bool // Requests failing on their first attempt
+}
+
+func newOrderRecorder(fail ...string) *orderRecorder {
+	r := &orderRecorder{executed: make(map[string][]int), fail: make(map[string]bool)}
+	for _, msg := range fail {
+		r.fail[msg] = true
+	}
+	return r
+}
+
+func (r *orderRecorder) handle(msg string) (string, error) {
+	keys, sequence, _ := strings.Cut(msg, ":")
+	number, err := strconv.Atoi(sequence)
+	if err != nil {
+		return "", err
+	}
+	// Even requests are slow, so a request of another shard would overtake them
+	if number%2 == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail[msg] {
+		delete(r.fail, msg)
+		return "", fmt.Errorf("failed to handle %s", msg)
+	}
+	for _, key := range strings.Split(keys, ",") {
+		r.executed[key] = append(r.executed[key], number)
+	}
+	return "processed: " + msg, nil
+}
+
+// requestAll sends the requests in order and waits for all replies
+func requestAll(t *testing.T, client mq.ClientMQ, requests []string) {
+	var replyChans []<-chan mq.Reply
+	for _, request := range requests {
+		replyChan, err := client.Request(request)
+		assert.NoError(t, err)
+		replyChans = append(replyChans, replyChan)
+	}
+	for _, replyChan := range replyChans {
+		select {
+		case reply := <-replyChan:
+			assert.NoError(t, reply.Err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for reply")
+		}
+	}
+}
+
+func TestConsumerKeyAffinityMultipleKeys(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	recorder := newOrderRecorder()
+	consumer := NewConsumer(server, 4, recorder.handle, WithKeyAffinity(splitKeys))
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// Requests with both keys are sent between the requests of either key
+	first, second := keysOfShards(consumer)
+	both := first + "," + second
+	var requests []string
+	for i := 0; i < 30; i++ {
+		switch i % 3 {
+		case 0:
+			requests = append(requests, fmt.Sprintf("%s:%d", first, i))
+		case 1:
+			requests = append(requests, fmt.Sprintf("%s:%d", both, i))
+		case 2:
+			requests = append(requests, fmt.Sprintf("%s:%d", second, i))
+		}
+	}
+	requestAll(t, client, requests)
+
+	// Test requests of several shards are executed in order with the requests of every key
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, key := range []string{first, second} {
+		sequences := recorder.executed[key]
+		assert.Len(t, sequences, 20, key)
+		assert.True(t, sort.IntsAreSorted(sequences), "%s: %v", key, sequences)
+	}
+}
+
+func TestConsumerKeyAffinityRetriesInOrder(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	// The first request for the key fails once
+	recorder := newOrderRecorder("key:0")
+	consumer := NewConsumer(server, 2, recorder.handle, WithKeyAffinity(splitKeys), WithErrorHandler(func(mq.Request, error) {}))
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	requests := make([]string, 10)
+	for i := range requests {
+		requests[i] = fmt.Sprintf("key:%d", i)
+	}
+	requestAll(t, client, requests)
+
+	// Test the failed request is retried before the later requests for its key are executed
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, recorder.executed["key"])
+	assert.Len(t, server.DeadLetters(), 0)
+}
+
+// undrainableServer hides StopRequests of the server, so the consumer stops reading requests right away
+type undrainableServer struct {
+	mq.ServerMQ
+}
+
+func TestConsumerKeyAffinityStopRequeues(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	handler := func(msg string) (string, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return "processed: " + msg, nil
+	}
+	consumer := NewConsumer(undrainableServer{server}, 1, handler, WithKeyAffinity(splitKeys))
+	assert.NoError(t, consumer.Start())
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// The worker is busy, its queue is full and the dispatcher waits to pass the last request
+	_, err := client.Request("key:0")
+	assert.NoError(t, err)
+	<-started
+	last := fmt.Sprintf("key:%d", shardQueueSize+1)
+	for i := 1; i <= shardQueueSize+1; i++ {
+		_, err := client.Request(fmt.Sprintf("key:%d", i))
+		assert.NoError(t, err)
+	}
+
+	// Test the request held by the dispatcher is given back, the queued ones are abandoned
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, 1+shardQueueSize, consumer.Shutdown(ctx))
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	select {
+	case req := <-reqCh:
+		assert.Equal(t, last, req.Data)
+		assert.True(t, req.Redelivered)
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the request to be given back")
+	}
+}
+
+func TestConsumerKeyAffinityAutoscaling(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	consumer := NewConsumer(server, 1, nil, WithKeyAffinity(func(string) []string { return nil }), WithAutoscaling(1, 4, 0))
+	assert.ErrorIs(t, consumer.Start(), errAffinityAutoscaling)
+}
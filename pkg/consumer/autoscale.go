@@ -0,0 +1,182 @@
+package consumer
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+)
+
+// DefaultScaleInterval is how often the pool size is checked if the interval is not set
+const DefaultScaleInterval = 100 * time.Millisecond
+
+// scaleDownTicks is how many checks in a row the pool must be too big before a worker is removed,
+// so the pool doesn't shrink between bursts
+const scaleDownTicks = 10
+
+// ResizeEvent describes a change of the worker pool size and what caused it
+type ResizeEvent struct {
+	Previous int           // Workers before the change
+	Workers  int           // Workers after the change
+	Busy     int           // Workers processing requests at the check
+	Backlog  int           // Requests waiting for a worker, estimated if the server can't tell
+	Latency  time.Duration // Average time to process a request, zero if none was processed yet
+}
+
+// ResizeHandlerFunc is called when the worker pool is resized
+type ResizeHandlerFunc func(event ResizeEvent)
+
+// WithAutoscaling makes the worker pool resize between minWorkers and maxWorkers, workerCount is the initial size.
+// Every interval the pool grows to drain the server backlog within the next interval at the current
+// handler latency, it shrinks by one worker once it's been too big for a while.
+// The backlog is taken from servers implementing mq.Backlogger, for others all workers being busy counts as one.
+func WithAutoscaling(minWorkers, maxWorkers int, interval time.Duration) Option {
+	return func(c *Consumer) {
+		c.minWorkers = minWorkers
+		c.maxWorkers = maxWorkers
+		c.scaleInterval = interval
+	}
+}
+
+// WithResizeHandler passes resize events of an autoscaling pool to handle instead of logging them
+func WithResizeHandler(handle ResizeHandlerFunc) Option {
+	return func(c *Consumer) {
+		c.onResize = handle
+	}
+}
+
+// Workers returns the number of running workers
+func (c *Consumer) Workers() int {
+	return int(c.workers.Load())
+}
+
+// latencyMeter averages processing times between reads
+type latencyMeter struct {
+	total atomic.Int64 // Nanoseconds
+	count atomic.Int64
+	last  time.Duration // Average of the last period with requests, only used by the scaler
+}
+
+func (m *latencyMeter) record(d time.Duration) {
+	m.total.Add(int64(d))
+	m.count.Add(1)
+}
+
+// average returns the average since the last call, or the last average if nothing was recorded since
+func (m *latencyMeter) average() time.Duration {
+	count := m.count.Swap(0)
+	total := m.total.Swap(0)
+	if count > 0 {
+		m.last = time.Duration(total / count)
+	}
+	return m.last
+}
+
+// autoscaling reports whether the pool is resized
+func (c *Consumer) autoscaling() bool {
+	return c.maxWorkers > 0
+}
+
+// poolLimits clamps the initial pool size and the limits of an autoscaling pool
+func (c *Consumer) poolLimits() {
+	if !c.autoscaling() {
+		return
+	}
+	c.minWorkers = max(c.minWorkers, 1)
+	c.maxWorkers = max(c.maxWorkers, c.minWorkers)
+	c.workerCount = min(max(c.workerCount, c.minWorkers), c.maxWorkers)
+	if c.scaleInterval <= 0 {
+		c.scaleInterval = DefaultScaleInterval
+	}
+	c.shrinkChan = make(chan struct{}, c.maxWorkers)
+}
+
+// scale resizes the pool until the consumer stops or all workers exit
+func (c *Consumer) scale(reqCh <-chan mq.Request) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.scaleInterval)
+	defer ticker.Stop()
+
+	calm := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.stopChan:
+			return
+		}
+		if c.workers.Load() == 0 {
+			// The server closed the requests channel
+			return
+		}
+
+		// Workers asked to exit don't count
+		current := int(c.workers.Load()) - len(c.shrinkChan)
+		busy := int(c.busy.Load())
+		latency := c.latency.average()
+		backlog := c.backlog(busy, current)
+		desired := c.desiredWorkers(busy, backlog, latency)
+
+		switch {
+		case desired > current:
+			calm = 0
+			c.spawn(reqCh, desired-current)
+		case desired < current:
+			calm++
+			if calm < scaleDownTicks {
+				continue
+			}
+			calm = 0
+			c.shrinkChan <- struct{}{}
+			desired = current - 1
+		default:
+			calm = 0
+			continue
+		}
+
+		c.onResize(ResizeEvent{
+			Previous: current,
+			Workers:  desired,
+			Busy:     busy,
+			Backlog:  backlog,
+			Latency:  latency,
+		})
+	}
+}
+
+// backlog returns the requests waiting for a worker, all workers being busy counts as a backlog
+// of the pool size if the server can't tell
+func (c *Consumer) backlog(busy, workers int) int {
+	if backlogger, ok := c.server.(mq.Backlogger); ok {
+		backlog, err := backlogger.Backlog()
+		if err == nil {
+			return backlog
+		}
+		log.Printf("Failed to get the server backlog: %v", err)
+	}
+	if busy >= workers {
+		return workers
+	}
+	return 0
+}
+
+// desiredWorkers is the pool size which keeps the busy workers and drains the backlog within the next interval
+func (c *Consumer) desiredWorkers(busy, backlog int, latency time.Duration) int {
+	desired := busy
+	if backlog > 0 {
+		if latency <= 0 {
+			// Nothing was processed yet, assume a request takes the whole interval
+			latency = c.scaleInterval
+		}
+		perWorker := max(int(c.scaleInterval/latency), 1)
+		desired += (backlog + perWorker - 1) / perWorker
+	}
+	return min(max(desired, c.minWorkers), c.maxWorkers)
+}
+
+// logResize is the default ResizeHandlerFunc
+func logResize(event ResizeEvent) {
+	log.Printf("Resized worker pool from %d to %d: %d busy, backlog %d, latency %v",
+		event.Previous, event.Workers, event.Busy, event.Backlog, event.Latency)
+}
@@ -0,0 +1,153 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/producer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDesiredWorkers(t *testing.T) {
+	c := NewConsumer(nil, 1, nil, WithAutoscaling(2, 10, 100*time.Millisecond))
+	c.poolLimits()
+
+	tests := []struct {
+		busy, backlog int
+		latency       time.Duration
+		expected      int
+	}{
+		{busy: 0, backlog: 0, latency: 0, expected: 2},                       // Never below the minimum
+		{busy: 4, backlog: 0, latency: 0, expected: 4},                       // Idle workers are not needed
+		{busy: 4, backlog: 3, latency: 0, expected: 7},                       // Unknown latency, a worker per request
+		{busy: 4, backlog: 3, latency: 10 * time.Millisecond, expected: 5},   // A worker drains 10 requests per interval
+		{busy: 4, backlog: 30, latency: 50 * time.Millisecond, expected: 10}, // Never above the maximum
+		{busy: 2, backlog: 5, latency: time.Second, expected: 7},             // Slow requests need a worker each
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, c.desiredWorkers(test.busy, test.backlog, test.latency), test)
+	}
+}
+
+func TestConsumerAutoscaling(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	handler := func(msg string) (string, error) {
+		time.Sleep(20 * time.Millisecond)
+		return "processed: " + msg, nil
+	}
+
+	var mu sync.Mutex
+	var events []ResizeEvent
+	onResize := func(event ResizeEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	consumer := NewConsumer(server, 1, handler,
+		WithAutoscaling(1, 8, 10*time.Millisecond),
+		WithResizeHandler(onResize),
+	)
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+	assert.Equal(t, 1, consumer.Workers())
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// Test the pool grows under a burst
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			requestRaw(t, client, fmt.Sprintf("request %d", i))
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return consumer.Workers() == 8 }, 2*time.Second, 5*time.Millisecond)
+	wg.Wait()
+
+	// Test the pool shrinks back once it's idle
+	assert.Eventually(t, func() bool { return consumer.Workers() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// The worker exits before the shrink is reported
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return events[len(events)-1].Workers == 1
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, events[0].Workers, events[0].Previous)
+	assert.Positive(t, events[0].Backlog)
+	// Busy and backlog of the last tick depend on timing
+	last := events[len(events)-1]
+	assert.Equal(t, 2, last.Previous)
+	assert.Equal(t, 1, last.Workers)
+}
+
+// BenchmarkConsumerBurst measures throughput of a producer sending bursts of random requests separated by idle pauses.
+// Every request waits for I/O a millisecond, so five workers take longer than a pause to process a burst
+// and a bigger pool catches up before the next one. The throughput counts the pauses.
+func BenchmarkConsumerBurst(b *testing.B) {
+	const burstSize = 200
+	const burstPause = 20 * time.Millisecond
+
+	pools := []struct {
+		name    string
+		options []Option
+	}{
+		{name: "Fixed5"},
+		{name: "Autoscaling1-64", options: []Option{WithAutoscaling(1, 64, 10*time.Millisecond)}},
+	}
+
+	for _, pool := range pools {
+		b.Run(pool.name, func(b *testing.B) {
+			server := mq.NewInprocServer()
+			defer server.Close()
+
+			handler, err := NewRequestHandlerOrderedMap()
+			if err != nil {
+				b.Fatalf("Failed to create handler: %v", err)
+			}
+			defer handler.Close()
+
+			execute := func(request string) (string, error) {
+				time.Sleep(time.Millisecond)
+				return handler.Execute(request)
+			}
+			options := append([]Option{WithResizeHandler(func(ResizeEvent) {})}, pool.options...)
+			consumer := NewConsumer(server, 5, execute, options...)
+			if err := consumer.Start(); err != nil {
+				b.Fatalf("Failed to start consumer: %v", err)
+			}
+			defer consumer.Stop()
+
+			client := mq.NewInprocClient(server)
+			defer client.Close()
+
+			var responses atomic.Int64
+			onResponse := func(string) error {
+				responses.Add(1)
+				return nil
+			}
+			feed := producer.NewRandomRequestFeed(b.N*burstSize, producer.WithBursts(burstSize, burstPause))
+			prod := producer.NewProducer(client, onResponse, feed, time.Minute, burstSize)
+
+			b.ResetTimer()
+			prod.Start()
+			b.StopTimer()
+
+			if int(responses.Load()) != b.N*burstSize {
+				b.Errorf("Got %d responses to %d requests", responses.Load(), b.N*burstSize)
+			}
+			b.ReportMetric(float64(b.N*burstSize)/b.Elapsed().Seconds(), "req/s")
+		})
+	}
+}
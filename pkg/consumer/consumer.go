@@ -1,55 +1,244 @@
 package consumer
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
 	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
 )
 
+// DefaultDrainTimeout is how long Stop waits for requests in flight by default
+const DefaultDrainTimeout = 10 * time.Second
+
+// ErrHandlerPanicked is wrapped by the errors of requests whose handler panicked
+var ErrHandlerPanicked = errors.New("handler panicked")
+
 // RequestHandlerFunc handles a request message and returns a response.
-type RequestHandlerFunc func(string) string
+// An error means the request failed, it's retried once and then answered with an error response.
+type RequestHandlerFunc func(string) (string, error)
+
+// ValidateFunc returns why a request can never be executed, nil if it can.
+type ValidateFunc func(string) error
+
+// ErrorHandlerFunc is called with every failure to process a request
+type ErrorHandlerFunc func(req mq.Request, err error)
+
+// Option is a function type for configuring the Consumer
+type Option func(c *Consumer)
+
+// WithDedup makes the consumer remember responses to the last size request IDs.
+// A request with a remembered ID isn't executed again, e.g. when it's redelivered,
+// the remembered response is sent instead.
+func WithDedup(size int) Option {
+	return func(c *Consumer) {
+		c.dedupSize = size
+	}
+}
+
+// WithDeadLetters makes the consumer dead-letter requests rejected by validate.
+// They are still passed to the handler, so the client gets an error response.
+func WithDeadLetters(validate ValidateFunc) Option {
+	return func(c *Consumer) {
+		c.validate = validate
+	}
+}
+
+// WithErrorHandler passes failures to process requests to handle instead of logging them:
+// handler errors and panics and failures to reply, settle or dead-letter requests.
+func WithErrorHandler(handle ErrorHandlerFunc) Option {
+	return func(c *Consumer) {
+		c.onError = handle
+	}
+}
+
+// WithDrainTimeout sets how long Stop waits for requests in flight
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(c *Consumer) {
+		c.drainTimeout = timeout
+	}
+}
 
 // Consumer reads requests from the server, processes them, and replies.
 type Consumer struct {
-	server      mq.ServerMQ
-	handler     RequestHandlerFunc
-	workerCount int
-	stopChan    chan struct{}
-	wg          sync.WaitGroup
+	server       mq.ServerMQ
+	handler      RequestHandlerFunc
+	workerCount  int
+	dedupSize    int          // Requests are not deduplicated if zero
+	validate     ValidateFunc // Requests are not dead-lettered if nil
+	onError      ErrorHandlerFunc
+	drainTimeout time.Duration
+
+	// The pool is resized between the limits if maxWorkers is set
+	minWorkers    int
+	maxWorkers    int
+	scaleInterval time.Duration
+	onResize      ResizeHandlerFunc
+	shrinkChan    chan struct{} // A worker exits for every value
+	workers       atomic.Int64
+	latency       latencyMeter
+
+	keyOf   KeyFunc          // Requests are executed by any worker if nil
+	shards  []chan shardTask // Queues of the workers with key affinity
+	pending atomic.Int64     // Requests in the shard queues
+
+	started  bool
+	stopOnce sync.Once
+	stopChan chan struct{} // Closed when workers must stop reading requests
+	exitOnce sync.Once
+	done     chan struct{} // Closed when all workers exited
+	busy     atomic.Int64  // Requests being processed
+	wg       sync.WaitGroup
 }
 
 // NewConsumer creates a new Consumer instance.
-func NewConsumer(server mq.ServerMQ, workerCount int, handler RequestHandlerFunc) *Consumer {
-	return &Consumer{
-		server:      server,
-		handler:     handler,
-		workerCount: workerCount,
-		stopChan:    make(chan struct{}),
+func NewConsumer(server mq.ServerMQ, workerCount int, handler RequestHandlerFunc, options ...Option) *Consumer {
+	c := &Consumer{
+		server:       server,
+		handler:      handler,
+		workerCount:  workerCount,
+		onError:      logError,
+		onResize:     logResize,
+		drainTimeout: DefaultDrainTimeout,
+		stopChan:     make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	for _, option := range options {
+		option(c)
 	}
+	return c
 }
 
 // Start spawns worker goroutines to process incoming requests.
+// Servers with manual acknowledgements get at most one unacknowledged request per worker,
+// or per the maximum of workers of an autoscaling pool, or per place in the shard queues with key affinity.
 func (c *Consumer) Start() error {
+	if c.keyOf != nil && c.autoscaling() {
+		return errAffinityAutoscaling
+	}
+	c.poolLimits()
+
+	if c.dedupSize > 0 {
+		cache, err := newDedupCache(c.dedupSize)
+		if err != nil {
+			return err
+		}
+		handler := c.handler
+		c.handler = func(request string) (string, error) {
+			return cache.execute(request, handler)
+		}
+	}
+
+	if prefetcher, ok := c.server.(mq.Prefetcher); ok {
+		prefetch := max(c.workerCount, c.maxWorkers)
+		if c.keyOf != nil {
+			prefetch = max(c.workerCount, 1) * (shardQueueSize + 1)
+		}
+		if err := prefetcher.SetPrefetch(prefetch); err != nil {
+			return err
+		}
+	}
+
 	reqCh, err := c.server.ListenForRequests()
 	if err != nil {
 		return err
 	}
 
-	for i := 0; i < c.workerCount; i++ {
+	switch {
+	case c.keyOf != nil:
+		c.startShards(reqCh)
+	case c.autoscaling():
+		c.spawn(reqCh, c.workerCount)
 		c.wg.Add(1)
-		go c.worker(reqCh)
+		go c.scale(reqCh)
+	default:
+		c.spawn(reqCh, c.workerCount)
 	}
+	c.started = true
+	go func() {
+		c.wg.Wait()
+		close(c.done)
+	}()
 	return nil
 }
 
-// Stop signals the consumer to stop and waits for workers to finish.
+// Run starts the consumer and stops it once ctx is done, waiting for requests in flight up to the drain timeout.
+// It returns the number of requests abandoned after the drain timeout.
+func (c *Consumer) Run(ctx context.Context) (int, error) {
+	if err := c.Start(); err != nil {
+		return 0, err
+	}
+	<-ctx.Done()
+	return c.drain(), nil
+}
+
+// Stop is Shutdown limited by the drain timeout, abandoned requests are logged.
 func (c *Consumer) Stop() {
-	close(c.stopChan)
-	c.wg.Wait()
+	if abandoned := c.drain(); abandoned > 0 {
+		log.Printf("Abandoned %d requests after draining for %v", abandoned, c.drainTimeout)
+	}
+}
+
+// drain is Shutdown limited by the drain timeout
+func (c *Consumer) drain() int {
+	ctx, cancel := context.WithTimeout(context.Background(), c.drainTimeout)
+	defer cancel()
+	return c.Shutdown(ctx)
+}
+
+// Shutdown stops taking new requests and waits until the ones taken are processed or ctx is done.
+// Servers implementing mq.Drainer still pass the requests they took, other servers are left right away.
+// It returns the number of requests still being processed or queued when ctx is done, their workers are abandoned.
+// It's safe to call more than once.
+func (c *Consumer) Shutdown(ctx context.Context) int {
+	if !c.started {
+		return 0
+	}
+
+	c.stopOnce.Do(func() {
+		if drainer, ok := c.server.(mq.Drainer); ok {
+			err := drainer.StopRequests()
+			if err == nil {
+				return
+			}
+			log.Printf("Failed to stop taking requests: %v", err)
+		}
+		c.exit()
+	})
+
+	select {
+	case <-c.done:
+		return 0
+	case <-ctx.Done():
+		c.exit()
+		return int(c.busy.Load()) + c.queued()
+	}
+}
+
+// exit makes workers stop reading requests
+func (c *Consumer) exit() {
+	c.exitOnce.Do(func() {
+		close(c.stopChan)
+	})
+}
+
+// spawn adds count workers to the pool
+func (c *Consumer) spawn(reqCh <-chan mq.Request, count int) {
+	for i := 0; i < count; i++ {
+		c.wg.Add(1)
+		c.workers.Add(1)
+		go c.worker(reqCh)
+	}
 }
 
 func (c *Consumer) worker(reqCh <-chan mq.Request) {
 	defer c.wg.Done()
+	defer c.workers.Add(-1)
 
 	for {
 		select {
@@ -58,10 +247,125 @@ func (c *Consumer) worker(reqCh <-chan mq.Request) {
 				// The server closed the requests channel
 				return
 			}
-			response := c.handler(req.Data)
-			_ = c.server.Reply(req.CorrelationID, response)
+			c.busy.Add(1)
+			started := time.Now()
+			c.process(req)
+			c.latency.record(time.Since(started))
+			c.busy.Add(-1)
+		case <-c.shrinkChan:
+			// The autoscaling pool shrinks
+			return
 		case <-c.stopChan:
 			return
 		}
 	}
 }
+
+// process replies to a request and acknowledges it. A request that failed is requeued once,
+// so it is retried by another worker, a redelivered one is answered with the error and dead-lettered.
+// With key affinity the request is retried right away instead, requests for its keys queued behind it wait.
+// A request whose reply fails is settled all the same, the handler already executed it.
+func (c *Consumer) process(req mq.Request) {
+	response, err := c.handle(req)
+	if err != nil && c.keyOf != nil && !req.Redelivered {
+		c.onError(req, err)
+		req.Redelivered = true
+		response, err = c.handle(req)
+	}
+	if err != nil {
+		c.onError(req, err)
+		if !req.Redelivered {
+			c.nack(req, true)
+			return
+		}
+		response = errorResponse(err)
+	}
+
+	if replyErr := c.server.Reply(req.CorrelationID, response); replyErr != nil {
+		c.onError(req, fmt.Errorf("failed to reply: %w", replyErr))
+	}
+	if err != nil {
+		c.nack(req, false)
+		return
+	}
+
+	if err := req.Ack(); err != nil {
+		c.onError(req, fmt.Errorf("failed to acknowledge: %w", err))
+	}
+}
+
+// nack rejects a request, it's redelivered if requeue is set and dead-lettered otherwise
+func (c *Consumer) nack(req mq.Request, requeue bool) {
+	if err := req.Nack(requeue); err != nil {
+		c.onError(req, fmt.Errorf("failed to reject: %w", err))
+	}
+}
+
+// handle executes a request, requests of a batch are executed in order and their responses are packed together.
+// A failed request of a batch is answered with an error response, so the others aren't executed again.
+func (c *Consumer) handle(req mq.Request) (string, error) {
+	if !req.Batch {
+		return c.execute(req, req.Data)
+	}
+
+	requests, err := mq.DecodeBatch(req.Data)
+	if err != nil {
+		c.onError(req, fmt.Errorf("failed to unpack batch: %w", err))
+		requests = nil
+	}
+
+	responses := make([]string, len(requests))
+	for i, request := range requests {
+		response, err := c.execute(req, request)
+		if err != nil {
+			c.onError(req, err)
+			response = errorResponse(err)
+		}
+		responses[i] = response
+	}
+
+	// An empty batch reply makes the client release all reply channels of a malformed batch
+	response, err := mq.EncodeBatch(responses)
+	if err != nil {
+		c.onError(req, fmt.Errorf("failed to pack batch reply: %w", err))
+	}
+	return response, nil
+}
+
+// execute runs the handler for a request of the message, an invalid request is dead-lettered first.
+// A panic of the handler is turned into an error.
+func (c *Consumer) execute(req mq.Request, request string) (response string, err error) {
+	if c.validate != nil {
+		if err := c.validate(request); err != nil {
+			letter := req
+			letter.Data, letter.Batch = request, false
+			if err := c.server.DeadLetter(letter, err.Error()); err != nil {
+				c.onError(req, fmt.Errorf("failed to dead-letter: %w", err))
+			}
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrHandlerPanicked, r)
+		}
+	}()
+	return c.handler(request)
+}
+
+// errorResponse is the response to a request which failed
+func errorResponse(err error) string {
+	response, serializeErr := models.SerializeResponse(models.ErrorResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+	if serializeErr != nil {
+		return `{"success":false,"message":"internal error"}`
+	}
+	return response
+}
+
+// logError is the default ErrorHandlerFunc
+func logError(req mq.Request, err error) {
+	log.Printf("Failed to process request %s: %v", req.CorrelationID, err)
+}
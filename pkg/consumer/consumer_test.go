@@ -1,11 +1,15 @@
 package consumer
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
 	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,9 +29,9 @@ func TestConsumerWithInproc(t *testing.T) {
 	assert.NotNil(t, server)
 
 	// Create a Consumer with a handler
-	handler := func(msg string) string {
+	handler := func(msg string) (string, error) {
 		fmt.Printf("Handling: %s\n", msg)
-		return fmt.Sprintf(`{"success":true,"message":"processed: %s"}`, msg)
+		return fmt.Sprintf(`{"success":true,"message":"processed: %s"}`, msg), nil
 	}
 	consumer := NewConsumer(server, 3, handler)
 	err := consumer.Start()
@@ -51,7 +55,8 @@ func TestConsumerWithInproc(t *testing.T) {
 
 			select {
 			case reply := <-replyChan:
-				fmt.Println("Got reply:", reply)
+				assert.NoError(t, reply.Err)
+				fmt.Println("Got reply:", reply.Data)
 			case <-time.After(2 * time.Second):
 				t.Error("Timed out waiting for reply")
 			}
@@ -62,3 +67,577 @@ func TestConsumerWithInproc(t *testing.T) {
 	consumer.Stop()
 	client.Close()
 }
+
+// requestReply sends a request through the client and decodes the reply into response
+func requestReply(t *testing.T, client mq.ClientMQ, requestType models.RequestType, payload interface{}, response interface{}) {
+	raw, err := models.SerializeRequest(requestType, payload)
+	assert.NoError(t, err)
+
+	replyChan, err := client.Request(raw)
+	assert.NoError(t, err)
+
+	select {
+	case reply := <-replyChan:
+		assert.NoError(t, reply.Err)
+		assert.NoError(t, models.DeserializeResponse(reply.Data, response))
+	case <-time.After(2 * time.Second):
+		t.Error("Timed out waiting for reply")
+	}
+}
+
+func TestConsumerConditionalWritesRace(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	consumer := NewConsumer(server, 4, handler.Execute)
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	const clientCount = 5
+	const increments = 20
+
+	clients := make([]*mq.InprocClient, clientCount)
+	for i := range clients {
+		clients[i] = mq.NewInprocClient(server)
+		defer clients[i].Close()
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+
+	// Test only one client wins addIfAbsent
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client *mq.InprocClient) {
+			defer wg.Done()
+
+			var resp models.AddIfAbsentResponse
+			requestReply(t, client, models.AddIfAbsent, models.AddIfAbsentRequest{Key: "counter", Value: "0"}, &resp)
+			if resp.Success {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			} else {
+				assert.Equal(t, "key already exists", resp.Message)
+			}
+		}(i, client)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, winners)
+
+	// Test concurrent read-modify-write with CAS retries doesn't lose updates
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *mq.InprocClient) {
+			defer wg.Done()
+
+			for i := 0; i < increments; i++ {
+				for {
+					var getResp models.GetItemResponse
+					requestReply(t, client, models.GetItem, models.GetItemRequest{Key: "counter"}, &getResp)
+					if !assert.True(t, getResp.Success) {
+						return
+					}
+
+					var value int
+					_, err := fmt.Sscan(getResp.Value, &value)
+					assert.NoError(t, err)
+
+					var casResp models.CasItemResponse
+					requestReply(t, client, models.CasItem, models.CasItemRequest{
+						Key:     "counter",
+						Value:   fmt.Sprint(value + 1),
+						Version: getResp.Version,
+					}, &casResp)
+					if casResp.Success {
+						assert.Greater(t, casResp.Version, getResp.Version)
+						break
+					}
+					assert.Equal(t, "version mismatch", casResp.Message)
+				}
+			}
+		}(client)
+	}
+	wg.Wait()
+
+	var getResp models.GetItemResponse
+	requestReply(t, clients[0], models.GetItem, models.GetItemRequest{Key: "counter"}, &getResp)
+	assert.Equal(t, fmt.Sprint(clientCount*increments), getResp.Value)
+}
+
+func TestConsumerBatch(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	consumer := NewConsumer(server, 3, handler.Execute)
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// Requests of a batch are executed in order, so the last one sees the others
+	requests := generateCommands(5)
+	getItem, err := models.SerializeRequest(models.GetItem, models.GetItemRequest{Key: "key4"})
+	assert.NoError(t, err)
+	requests = append(requests, getItem)
+
+	replyChans, err := client.RequestBatch(context.Background(), requests)
+	assert.NoError(t, err)
+	assert.Len(t, replyChans, len(requests))
+
+	for i, replyChan := range replyChans[:5] {
+		var resp models.AddItemResponse
+		reply := <-replyChan
+		assert.NoError(t, reply.Err)
+		assert.NoError(t, models.DeserializeResponse(reply.Data, &resp))
+		assert.True(t, resp.Success, i)
+	}
+
+	var getResp models.GetItemResponse
+	reply := <-replyChans[5]
+	assert.NoError(t, reply.Err)
+	assert.NoError(t, models.DeserializeResponse(reply.Data, &getResp))
+	assert.True(t, getResp.Success)
+	assert.Equal(t, "value4", getResp.Value)
+}
+
+func TestConsumerRequeuesFailedRequests(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	// The handler panics on the first attempt of every request and twice on "fatal"
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	handler := func(msg string) (string, error) {
+		mu.Lock()
+		attempts[msg]++
+		attempt := attempts[msg]
+		mu.Unlock()
+
+		if attempt == 1 || msg == "fatal" {
+			panic("failed to handle " + msg)
+		}
+		return "processed: " + msg, nil
+	}
+	consumer := NewConsumer(server, 2, handler)
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// Test a failed request is retried
+	replyChan, err := client.Request("retry")
+	assert.NoError(t, err)
+
+	select {
+	case reply := <-replyChan:
+		assert.NoError(t, reply.Err)
+		assert.Equal(t, "processed: retry", reply.Data)
+	case <-time.After(2 * time.Second):
+		t.Error("Timed out waiting for reply")
+	}
+
+	// Test a request failing again is answered with the error and dead-lettered
+	replyChan, err = client.Request("fatal")
+	assert.NoError(t, err)
+
+	select {
+	case reply := <-replyChan:
+		assert.NoError(t, reply.Err)
+		var resp models.ErrorResponse
+		assert.NoError(t, models.DeserializeResponse(reply.Data, &resp))
+		assert.False(t, resp.Success)
+		assert.Equal(t, "handler panicked: failed to handle fatal", resp.Message)
+	case <-time.After(2 * time.Second):
+		t.Error("Timed out waiting for reply")
+	}
+
+	letter := <-server.DeadLetters()
+	assert.Equal(t, "fatal", letter.Data)
+	assert.Equal(t, mq.DeadLetterRejected, letter.Reason)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, attempts["fatal"])
+}
+
+// failingReplyServer is an in-process server whose replies always fail
+type failingReplyServer struct {
+	*mq.InprocServer
+}
+
+func (s failingReplyServer) Reply(corrID, data string) error {
+	return errors.New("reply failed")
+}
+
+func TestConsumerFailedReplyNotRequeued(t *testing.T) {
+	server := failingReplyServer{mq.NewInprocServer()}
+	defer server.Close()
+
+	var mu sync.Mutex
+	executed := 0
+	handler := func(msg string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		executed++
+		return "processed: " + msg, nil
+	}
+	consumer := NewConsumer(server, 2, handler, WithErrorHandler(func(mq.Request, error) {}))
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server.InprocServer)
+	defer client.Close()
+
+	_, err := client.Request("write")
+	assert.NoError(t, err)
+
+	// Test the executed request isn't executed again nor dead-lettered once its reply fails
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return executed == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Never(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return executed > 1 || len(server.DeadLetters()) > 0
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestConsumerErrorHandler(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	errFailed := errors.New("failed")
+	handler := func(msg string) (string, error) {
+		switch msg {
+		case "fail":
+			return "", errFailed
+		case "panic":
+			panic("boom")
+		default:
+			return "processed: " + msg, nil
+		}
+	}
+
+	var mu sync.Mutex
+	var failures []error
+	onError := func(req mq.Request, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, err)
+	}
+	consumer := NewConsumer(server, 2, handler, WithErrorHandler(onError))
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// Test a failing request is retried once, both failures are reported
+	var resp models.ErrorResponse
+	assert.NoError(t, models.DeserializeResponse(requestRaw(t, client, "fail"), &resp))
+	assert.Equal(t, models.ErrorResponse{Success: false, Message: "failed"}, resp)
+	<-server.DeadLetters()
+
+	mu.Lock()
+	assert.Len(t, failures, 2)
+	for _, err := range failures {
+		assert.ErrorIs(t, err, errFailed)
+	}
+	failures = nil
+	mu.Unlock()
+
+	// Test failed requests of a batch are answered in place, the batch isn't retried
+	replyChans, err := client.RequestBatch(context.Background(), []string{"first", "panic", "last"})
+	assert.NoError(t, err)
+
+	var replies []string
+	for _, replyChan := range replyChans {
+		reply := <-replyChan
+		assert.NoError(t, reply.Err)
+		replies = append(replies, reply.Data)
+	}
+	assert.Equal(t, []string{
+		"processed: first",
+		`{"success":false,"message":"handler panicked: boom"}`,
+		"processed: last",
+	}, replies)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, failures, 1)
+	assert.ErrorIs(t, failures[0], ErrHandlerPanicked)
+}
+
+// serializeRequestWithID serializes a request with the idempotency key
+func serializeRequestWithID(t *testing.T, requestID string, requestType models.RequestType, payload interface{}) string {
+	request, err := models.NewRequestWrapper(requestType, payload)
+	assert.NoError(t, err)
+	request.RequestID = requestID
+
+	raw, err := json.Marshal(request)
+	assert.NoError(t, err)
+	return string(raw)
+}
+
+// requestRaw sends a raw request through the client and returns the reply data
+func requestRaw(t *testing.T, client mq.ClientMQ, raw string) string {
+	replyChan, err := client.Request(raw)
+	assert.NoError(t, err)
+
+	select {
+	case reply := <-replyChan:
+		assert.NoError(t, reply.Err)
+		return reply.Data
+	case <-time.After(2 * time.Second):
+		t.Error("Timed out waiting for reply")
+		return ""
+	}
+}
+
+func TestConsumerDedup(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	consumer := NewConsumer(server, 3, handler.Execute, WithDedup(2))
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// Test a replayed request gets the first response instead of being executed again
+	add := serializeRequestWithID(t, "add-a", models.AddIfAbsent, models.AddIfAbsentRequest{Key: "a", Value: "1"})
+	first := requestRaw(t, client, add)
+	assert.Equal(t, first, requestRaw(t, client, add))
+
+	var addResp models.AddIfAbsentResponse
+	assert.NoError(t, models.DeserializeResponse(first, &addResp))
+	assert.True(t, addResp.Success)
+
+	del := serializeRequestWithID(t, "delete-a", models.DeleteItem, models.DeleteItemRequest{Key: "a"})
+	var delResp models.DeleteItemResponse
+	assert.NoError(t, models.DeserializeResponse(requestRaw(t, client, del), &delResp))
+	assert.True(t, delResp.Success)
+	assert.NoError(t, models.DeserializeResponse(requestRaw(t, client, del), &delResp))
+	assert.True(t, delResp.Success)
+
+	// Test the same request with another ID is executed
+	delAgain := serializeRequestWithID(t, "delete-a-again", models.DeleteItem, models.DeleteItemRequest{Key: "a"})
+	assert.NoError(t, models.DeserializeResponse(requestRaw(t, client, delAgain), &delResp))
+	assert.False(t, delResp.Success)
+
+	// Test the oldest ID is forgotten once the cache is full, "add-a" is executed again
+	assert.NoError(t, models.DeserializeResponse(requestRaw(t, client, add), &addResp))
+	assert.True(t, addResp.Success)
+
+	// "delete-a-again" is still remembered, so "a" isn't deleted
+	assert.NoError(t, models.DeserializeResponse(requestRaw(t, client, delAgain), &delResp))
+	assert.False(t, delResp.Success)
+
+	// Test requests without an ID are never deduplicated
+	var noIDResp models.AddIfAbsentResponse
+	requestReply(t, client, models.AddIfAbsent, models.AddIfAbsentRequest{Key: "a", Value: "2"}, &noIDResp)
+	assert.False(t, noIDResp.Success)
+}
+
+func TestConsumerDedupConcurrentRequests(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	// Requests with the same ID may be redelivered while the first one is still executing
+	var mu sync.Mutex
+	executions := 0
+	handler := func(msg string) (string, error) {
+		mu.Lock()
+		executions++
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		return "processed", nil
+	}
+	consumer := NewConsumer(server, 4, handler, WithDedup(10))
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	request := serializeRequestWithID(t, "request-1", models.DeleteItem, models.DeleteItemRequest{Key: "a"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "processed", requestRaw(t, client, request))
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, executions)
+}
+
+func TestConsumerDeadLetters(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	consumer := NewConsumer(server, 2, handler.Execute, WithDeadLetters(handler.Validate))
+	assert.NoError(t, consumer.Start())
+	defer consumer.Stop()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	// Test an invalid request is answered and dead-lettered
+	var resp models.AddItemResponse
+	assert.NoError(t, models.DeserializeResponse(requestRaw(t, client, "{invalid_json"), &resp))
+	assert.Equal(t, "invalid command", resp.Message)
+
+	letter := <-server.DeadLetters()
+	assert.Equal(t, "{invalid_json", letter.Data)
+	assert.NotEmpty(t, letter.Reason)
+	assert.NotEmpty(t, letter.CorrelationID)
+
+	// Test only the invalid request of a batch is dead-lettered
+	unknown := `{"type":"unknownType","payload":{}}`
+	requests := append(generateCommands(2), unknown)
+	replyChans, err := client.RequestBatch(context.Background(), requests)
+	assert.NoError(t, err)
+	for _, replyChan := range replyChans {
+		assert.NoError(t, (<-replyChan).Err)
+	}
+
+	letter = <-server.DeadLetters()
+	assert.Equal(t, unknown, letter.Data)
+	assert.False(t, letter.Batch)
+	assert.Equal(t, `unknown command type "unknownType"`, letter.Reason)
+
+	// Test valid requests are not dead-lettered
+	requestRaw(t, client, generateCommands(1)[0])
+	select {
+	case letter := <-server.DeadLetters():
+		t.Errorf("Unexpected dead letter: %v", letter)
+	default:
+	}
+}
+
+func TestConsumerDrain(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	handler := func(msg string) (string, error) {
+		started <- msg
+		<-release
+		return "processed: " + msg, nil
+	}
+	consumer := NewConsumer(server, 2, handler)
+	assert.NoError(t, consumer.Start())
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	var replyChans []<-chan mq.Reply
+	for _, msg := range []string{"first", "second"} {
+		replyChan, err := client.Request(msg)
+		assert.NoError(t, err)
+		replyChans = append(replyChans, replyChan)
+		<-started
+	}
+
+	abandoned := make(chan int)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		abandoned <- consumer.Shutdown(ctx)
+	}()
+
+	// Test new requests are refused once the consumer stops
+	assert.Eventually(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := client.RequestContext(ctx, "late")
+		return errors.Is(err, mq.ErrStopped)
+	}, time.Second, 20*time.Millisecond)
+
+	// Test requests in flight are finished before the consumer stops
+	close(release)
+	assert.Equal(t, 0, <-abandoned)
+	for i, replyChan := range replyChans {
+		reply := <-replyChan
+		assert.NoError(t, reply.Err)
+		assert.Equal(t, "processed: "+[]string{"first", "second"}[i], reply.Data)
+	}
+
+	// Test stopping again is a no-op
+	consumer.Stop()
+	assert.Equal(t, 0, consumer.Shutdown(context.Background()))
+}
+
+func TestConsumerRunAbandons(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	handler := func(msg string) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "processed: " + msg, nil
+	}
+	consumer := NewConsumer(server, 1, handler, WithDrainTimeout(100*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	type result struct {
+		abandoned int
+		err       error
+	}
+	done := make(chan result)
+	go func() {
+		abandoned, err := consumer.Run(ctx)
+		done <- result{abandoned, err}
+	}()
+
+	client := mq.NewInprocClient(server)
+	defer client.Close()
+
+	_, err := client.Request("hung")
+	assert.NoError(t, err)
+	<-started
+
+	// Test a request still processing after the drain timeout is abandoned
+	cancel()
+	select {
+	case r := <-done:
+		assert.NoError(t, r.err)
+		assert.Equal(t, 1, r.abandoned)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run didn't return after the drain timeout")
+	}
+}
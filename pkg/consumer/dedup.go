@@ -0,0 +1,96 @@
+package consumer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/orderedmap"
+)
+
+// dedupEntry holds the response to a request ID, done is closed once the request is executed
+type dedupEntry struct {
+	done     chan struct{}
+	response string
+	ok       bool // False if the handler failed or panicked, so the request must be executed again
+}
+
+// dedupCache remembers responses to the latest request IDs, so repeated requests aren't executed twice.
+// The oldest IDs are forgotten once the cache is full.
+type dedupCache struct {
+	entries *orderedmap.OrderedMap[string, *dedupEntry]
+}
+
+func newDedupCache(size int) (*dedupCache, error) {
+	entries, err := orderedmap.New[string, *dedupEntry](
+		orderedmap.WithMaxSize[string, *dedupEntry](size),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dedup cache: %w", err)
+	}
+	return &dedupCache{entries: entries}, nil
+}
+
+// execute runs the handler for a request, unless its request ID was seen already.
+// Then the response to the first request is returned, waiting for it if it's still executing.
+// Requests without an ID are always executed.
+func (d *dedupCache) execute(request string, handler RequestHandlerFunc) (string, error) {
+	wrapper, err := models.DeserializeCommandWrapper(request)
+	if err != nil || wrapper.RequestID == "" {
+		return handler(request)
+	}
+
+	for {
+		entry, owner := d.acquire(wrapper.RequestID)
+		if owner {
+			return d.run(wrapper.RequestID, entry, request, handler)
+		}
+
+		<-entry.done
+		if entry.ok {
+			return entry.response, nil
+		}
+	}
+}
+
+// acquire returns the entry of the request ID, owner is true if it was just created by the caller
+func (d *dedupCache) acquire(id string) (entry *dedupEntry, owner bool) {
+	_ = d.entries.Update(func(tx *orderedmap.Tx[string, *dedupEntry]) error {
+		if existing, err := tx.Get(id); err == nil {
+			entry = existing
+			return nil
+		}
+
+		entry, owner = &dedupEntry{done: make(chan struct{})}, true
+		tx.StoreWithDeadline(id, entry, time.Time{})
+		return nil
+	})
+	return entry, owner
+}
+
+// run executes the request for the owner of the entry, the entry is forgotten if the handler fails or panics
+func (d *dedupCache) run(id string, entry *dedupEntry, request string, handler RequestHandlerFunc) (string, error) {
+	defer func() {
+		if !entry.ok {
+			d.forget(id, entry)
+		}
+		close(entry.done)
+	}()
+
+	response, err := handler(request)
+	if err != nil {
+		return "", err
+	}
+	entry.response, entry.ok = response, true
+	return response, nil
+}
+
+// forget removes the entry of the request ID, unless it was replaced already
+func (d *dedupCache) forget(id string, entry *dedupEntry) {
+	_ = d.entries.Update(func(tx *orderedmap.Tx[string, *dedupEntry]) error {
+		if existing, err := tx.Get(id); err == nil && existing == entry {
+			return tx.Delete(id)
+		}
+		return nil
+	})
+}
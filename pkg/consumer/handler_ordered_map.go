@@ -1,111 +1,431 @@
 package consumer
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
 	"github.com/MishkaRogachev/command-queue-executor/pkg/orderedmap"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/wal"
 )
 
+// MaxPageSize is the maximum number of items returned in one GetAllItems response
+const MaxPageSize = 1000
+
+// DefaultSweepInterval is how often expired items are removed from the map
+const DefaultSweepInterval = time.Second
+
+type handlerConfig struct {
+	wal              *wal.Log
+	snapshotPath     string
+	snapshotInterval time.Duration
+	sweepInterval    time.Duration
+	maxItems         int
+	evictionPolicy   orderedmap.EvictionPolicy
+}
+
+// HandlerOption is a function type for configuring the RequestHandlerOrderedMap
+type HandlerOption func(config *handlerConfig)
+
+// WithWAL makes the handler log every mutation to the write-ahead log before applying it.
+// Records already in the log are replayed into the map when the handler is created.
+func WithWAL(log *wal.Log) HandlerOption {
+	return func(c *handlerConfig) {
+		c.wal = log
+	}
+}
+
+// WithSweepInterval sets how often expired items are removed from the map, DefaultSweepInterval if not set
+func WithSweepInterval(interval time.Duration) HandlerOption {
+	return func(c *handlerConfig) {
+		c.sweepInterval = interval
+	}
+}
+
+// WithMaxItems bounds the number of items, adding an item to a full map evicts another one according to the policy.
+// Evictions are recorded in the write-ahead log as deletions.
+func WithMaxItems(maxItems int, policy orderedmap.EvictionPolicy) HandlerOption {
+	return func(c *handlerConfig) {
+		c.maxItems = maxItems
+		c.evictionPolicy = policy
+	}
+}
+
+// walEntry is a mutation recorded in the write-ahead log
+type walEntry struct {
+	Type      models.RequestType `json:"type"`
+	Key       string             `json:"key"`
+	Value     string             `json:"value,omitempty"`
+	ExpiresAt int64              `json:"expires_at,omitempty"` // Unix time in nanoseconds, so replay keeps the original deadline
+	Entries   []walEntry         `json:"entries,omitempty"`    // Mutations of a transaction
+	Seq       uint64             `json:"seq,omitempty"`        // Increases with every record, zero in logs of older versions
+}
+
 // RequestHandlerOrderedMap is a request handler that uses an ordered map to store key-value pairs
 type RequestHandlerOrderedMap struct {
 	omap *orderedmap.OrderedMap[string, string]
+	wal  *wal.Log // nil if persistence is disabled
+
+	snapshotPath string // Snapshots are disabled if empty
+
+	// Serializes logging and applying of mutations, so the log order matches the map state
+	writeMu sync.Mutex
+	seq     uint64 // Sequence number of the last logged mutation
+	// Set if an eviction couldn't be logged, so replay would diverge from the map.
+	// Writes fail until a snapshot captures the map.
+	unloggedErr error
+
+	// Log records up to restoredSeq are in the restored snapshot and are not replayed.
+	// Snapshots of older versions have no sequence number, the whole log is replayed on top of them.
+	restoredSeq      uint64
+	restoredSeqKnown bool
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
 // NewRequestHandlerOrderedMap creates a new RequestHandlerOrderedMap instance
-func NewRequestHandlerOrderedMap() *RequestHandlerOrderedMap {
-	omap, err := orderedmap.New[string, string]()
+func NewRequestHandlerOrderedMap(options ...HandlerOption) (*RequestHandlerOrderedMap, error) {
+	config := handlerConfig{
+		sweepInterval: DefaultSweepInterval,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	if config.maxItems < 0 {
+		return nil, fmt.Errorf("invalid max items: %d", config.maxItems)
+	}
+
+	h := &RequestHandlerOrderedMap{
+		wal:          config.wal,
+		snapshotPath: config.snapshotPath,
+		stopChan:     make(chan struct{}),
+	}
+
+	// The map starts unbounded, so recovery replays exactly what was logged
+	omap, err := orderedmap.New[string, string](
+		orderedmap.WithSweepInterval[string, string](config.sweepInterval),
+		orderedmap.WithEvictionPolicy[string, string](config.evictionPolicy),
+		orderedmap.WithEvictionCallback(h.onEvict),
+	)
 	if err != nil {
-		log.Fatalf("Failed to create ordered map: %v", err)
+		return nil, fmt.Errorf("failed to create ordered map: %w", err)
 	}
-	return &RequestHandlerOrderedMap{
-		omap: omap,
+	h.omap = omap
+
+	// Recover the state: the last snapshot first, then mutations logged after it
+	if err := h.restoreSnapshot(); err != nil {
+		omap.Close()
+		return nil, err
 	}
+	if h.wal != nil {
+		if err := h.wal.Replay(h.replayEntry); err != nil {
+			omap.Close()
+			return nil, fmt.Errorf("failed to replay write-ahead log: %w", err)
+		}
+	}
+
+	if config.maxItems > 0 {
+		h.writeMu.Lock()
+		err := h.omap.SetMaxSize(config.maxItems)
+		if err == nil {
+			err = h.unloggedErr
+		}
+		h.writeMu.Unlock()
+		if err != nil {
+			omap.Close()
+			return nil, fmt.Errorf("failed to bound ordered map: %w", err)
+		}
+	}
+
+	if h.snapshotPath != "" && config.snapshotInterval > 0 {
+		h.wg.Add(1)
+		go h.snapshotLoop(config.snapshotInterval)
+	}
+	return h, nil
+}
+
+// Close stops background tasks of the handler
+func (h *RequestHandlerOrderedMap) Close() {
+	h.closeOnce.Do(func() {
+		close(h.stopChan)
+	})
+	h.wg.Wait()
+	h.omap.Close()
 }
 
-// Execute handles a request message and returns a response message as a string
-func (h *RequestHandlerOrderedMap) Execute(rawRequest string) string {
+// Execute handles a request message and returns a response message as a string.
+// Invalid requests get error responses, an error means a write couldn't be persisted and may be retried.
+func (h *RequestHandlerOrderedMap) Execute(rawRequest string) (string, error) {
 	var wrapper models.RequestWrapper
 	err := json.Unmarshal([]byte(rawRequest), &wrapper)
 	if err != nil {
 		log.Printf("Failed to deserialize command wrapper: %v", err)
-		return h.errorResponse("invalid command")
+		return h.errorResponse("invalid command"), nil
 	}
 
 	switch wrapper.Type {
 	case models.AddItem:
-		return h.handleAddItem(wrapper.Payload)
+		return h.executeWrite(h.addItem, wrapper.Payload)
 	case models.DeleteItem:
-		return h.handleDeleteItem(wrapper.Payload)
+		return h.executeWrite(h.deleteItem, wrapper.Payload)
 	case models.GetItem:
-		return h.handleGetItem(wrapper.Payload)
+		response, _, _ := h.getItem(h.omap, nil, wrapper.Payload)
+		return h.toJSON(response), nil
 	case models.GetAll:
-		return h.handleGetAll(wrapper.Payload)
+		return h.handleGetAll(wrapper.Payload), nil
+	case models.CasItem:
+		return h.executeWrite(h.casItem, wrapper.Payload)
+	case models.AddIfAbsent:
+		return h.executeWrite(h.addIfAbsent, wrapper.Payload)
+	case models.Transaction:
+		return h.handleTransaction(wrapper.Payload)
+	case models.Snapshot:
+		return h.handleSnapshot(wrapper.Payload), nil
+	default:
+		return h.errorResponse("unknown command type"), nil
+	}
+}
+
+// Validate returns why a request can't be executed at all: it's not a command or its type is unknown.
+// Execute answers such requests with an error response.
+func (h *RequestHandlerOrderedMap) Validate(rawRequest string) error {
+	wrapper, err := models.DeserializeCommandWrapper(rawRequest)
+	if err != nil {
+		return err
+	}
+	if !wrapper.Type.IsKnown() {
+		return fmt.Errorf("unknown command type %q", wrapper.Type)
+	}
+	return nil
+}
+
+// Keys returns the item keys of a request for WithKeyAffinity, a transaction has the keys of all its requests.
+// Other commands and requests which are not commands have no keys.
+func (h *RequestHandlerOrderedMap) Keys(rawRequest string) []string {
+	wrapper, err := models.DeserializeCommandWrapper(rawRequest)
+	if err != nil {
+		return nil
+	}
+	return commandKeys(wrapper)
+}
+
+func commandKeys(wrapper models.RequestWrapper) []string {
+	switch wrapper.Type {
+	case models.AddItem, models.DeleteItem, models.GetItem, models.CasItem, models.AddIfAbsent:
+		var payload struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(wrapper.Payload, &payload); err != nil || payload.Key == "" {
+			return nil
+		}
+		return []string{payload.Key}
+	case models.Transaction:
+		var payload models.TransactionRequest
+		if err := json.Unmarshal(wrapper.Payload, &payload); err != nil {
+			return nil
+		}
+		var keys []string
+		for _, request := range payload.Requests {
+			keys = append(keys, commandKeys(request)...)
+		}
+		return keys
 	default:
-		return h.errorResponse("unknown command type")
+		return nil
 	}
 }
 
-func (h *RequestHandlerOrderedMap) handleAddItem(payload json.RawMessage) string {
+// itemStore is what item commands need from the map, it's either the map itself or a transaction on it
+type itemStore interface {
+	GetWithVersion(key string) (string, uint64, error)
+	StoreWithDeadline(key, value string, deadline time.Time) uint64
+	Delete(key string) error
+}
+
+// recordFunc records a mutation before it's applied to the store
+type recordFunc func(entry walEntry) error
+
+// itemCommand executes a command on the store and returns its response and whether a transaction may go on:
+// it's false if the command failed, unless it's a read or delete of a missing key with IgnoreMissing set.
+// An error means the mutation couldn't be recorded and nothing was applied.
+type itemCommand func(store itemStore, record recordFunc, payload json.RawMessage) (any, bool, error)
+
+// executeWrite executes a mutating command on the map, logging mutations to the write-ahead log.
+// It fails if the mutation couldn't be logged, then nothing is applied.
+func (h *RequestHandlerOrderedMap) executeWrite(command itemCommand, payload json.RawMessage) (string, error) {
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	response, _, err := command(h.omap, h.logEntry, payload)
+	if err == nil {
+		// Evictions of the command are logged after it's applied
+		err = h.unloggedErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to persist command: %w", err)
+	}
+	return h.toJSON(response), nil
+}
+
+func (h *RequestHandlerOrderedMap) addItem(store itemStore, record recordFunc, payload json.RawMessage) (any, bool, error) {
 	var req models.AddItemRequest
 	if err := json.Unmarshal(payload, &req); err != nil {
 		log.Printf("Failed to deserialize AddItemRequest: %v", err)
-		return h.errorResponse("invalid payload for AddItem")
+		return h.errorResult("invalid payload for AddItem")
+	}
+	if req.TTLMs < 0 {
+		return h.errorResult("invalid ttl for AddItem")
+	}
+
+	version, err := h.storeItem(store, record, req.Key, req.Value, req.TTLMs)
+	if err != nil {
+		return nil, false, err
 	}
 
-	h.omap.Store(req.Key, req.Value)
 	resp := models.AddItemResponse{
 		Success: true,
+		Version: version,
 		Message: "item added",
 	}
-	return h.toJSON(resp)
+	return resp, true, nil
+}
+
+func (h *RequestHandlerOrderedMap) casItem(store itemStore, record recordFunc, payload json.RawMessage) (any, bool, error) {
+	var req models.CasItemRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Printf("Failed to deserialize CasItemRequest: %v", err)
+		return h.errorResult("invalid payload for CasItem")
+	}
+	if req.TTLMs < 0 {
+		return h.errorResult("invalid ttl for CasItem")
+	}
+
+	// The caller holds writeMu, nothing can change the item between the check and the write
+	_, current, err := store.GetWithVersion(req.Key)
+	if err != nil {
+		resp := models.CasItemResponse{
+			Success: false,
+			Message: "key not found",
+		}
+		return resp, false, nil
+	}
+	if current != req.Version {
+		resp := models.CasItemResponse{
+			Success: false,
+			Version: current,
+			Message: "version mismatch",
+		}
+		return resp, false, nil
+	}
+
+	version, err := h.storeItem(store, record, req.Key, req.Value, req.TTLMs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp := models.CasItemResponse{
+		Success: true,
+		Version: version,
+		Message: "item swapped",
+	}
+	return resp, true, nil
+}
+
+func (h *RequestHandlerOrderedMap) addIfAbsent(store itemStore, record recordFunc, payload json.RawMessage) (any, bool, error) {
+	var req models.AddIfAbsentRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Printf("Failed to deserialize AddIfAbsentRequest: %v", err)
+		return h.errorResult("invalid payload for AddIfAbsent")
+	}
+	if req.TTLMs < 0 {
+		return h.errorResult("invalid ttl for AddIfAbsent")
+	}
+
+	if _, current, err := store.GetWithVersion(req.Key); err == nil {
+		resp := models.AddIfAbsentResponse{
+			Success: false,
+			Version: current,
+			Message: "key already exists",
+		}
+		return resp, false, nil
+	}
+
+	version, err := h.storeItem(store, record, req.Key, req.Value, req.TTLMs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp := models.AddIfAbsentResponse{
+		Success: true,
+		Version: version,
+		Message: "item added",
+	}
+	return resp, true, nil
 }
 
-func (h *RequestHandlerOrderedMap) handleDeleteItem(payload json.RawMessage) string {
+func (h *RequestHandlerOrderedMap) deleteItem(store itemStore, record recordFunc, payload json.RawMessage) (any, bool, error) {
 	var req models.DeleteItemRequest
 	if err := json.Unmarshal(payload, &req); err != nil {
 		log.Printf("Failed to deserialize DeleteItemRequest: %v", err)
-		return h.errorResponse("invalid payload for DeleteItem")
+		return h.errorResult("invalid payload for DeleteItem")
 	}
 
-	err := h.omap.Delete(req.Key)
-	if err != nil {
+	if _, _, err := store.GetWithVersion(req.Key); err != nil {
 		resp := models.DeleteItemResponse{
 			Success: false,
 			Message: "key not found",
 		}
-		return h.toJSON(resp)
+		return resp, req.IgnoreMissing, nil
+	}
+
+	if err := record(walEntry{Type: models.DeleteItem, Key: req.Key}); err != nil {
+		return nil, false, err
+	}
+
+	if err := store.Delete(req.Key); err != nil {
+		resp := models.DeleteItemResponse{
+			Success: false,
+			Message: "key not found",
+		}
+		return resp, req.IgnoreMissing, nil
 	}
 
 	resp := models.DeleteItemResponse{
 		Success: true,
 		Message: "item deleted",
 	}
-	return h.toJSON(resp)
+	return resp, true, nil
 }
 
-func (h *RequestHandlerOrderedMap) handleGetItem(payload json.RawMessage) string {
+func (h *RequestHandlerOrderedMap) getItem(store itemStore, _ recordFunc, payload json.RawMessage) (any, bool, error) {
 	var req models.GetItemRequest
 	if err := json.Unmarshal(payload, &req); err != nil {
 		log.Printf("Failed to deserialize GetItemRequest: %v", err)
-		return h.errorResponse("invalid payload for GetItem")
+		return h.errorResult("invalid payload for GetItem")
 	}
 
-	value, err := h.omap.Get(req.Key)
+	value, version, err := store.GetWithVersion(req.Key)
 	if err != nil {
 		resp := models.GetItemResponse{
 			Success: false,
 			Message: "key not found",
 		}
-		return h.toJSON(resp)
+		return resp, req.IgnoreMissing, nil
 	}
 
 	resp := models.GetItemResponse{
 		Success: true,
 		Value:   value,
+		Version: version,
 	}
-	return h.toJSON(resp)
+	return resp, true, nil
 }
 
 func (h *RequestHandlerOrderedMap) handleGetAll(payload json.RawMessage) string {
@@ -115,9 +435,24 @@ func (h *RequestHandlerOrderedMap) handleGetAll(payload json.RawMessage) string
 		return h.errorResponse("invalid payload for GetAllItems")
 	}
 
-	allItems := h.omap.GetAll()
-	items := make([]models.KeyValuePair, len(allItems))
-	for i, pair := range allItems {
+	cursor, err := decodeCursor(req.Cursor)
+	if err != nil {
+		log.Printf("Failed to decode cursor: %v", err)
+		return h.errorResponse("invalid cursor")
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	pageItems, next, err := h.omap.Page(cursor, limit)
+	if err != nil {
+		// The cursor was returned before a restart, the client has to start over
+		return h.errorResponse("invalid cursor")
+	}
+	items := make([]models.KeyValuePair, len(pageItems))
+	for i, pair := range pageItems {
 		items[i] = models.KeyValuePair{
 			Key:   pair.Key,
 			Value: pair.Value,
@@ -125,12 +460,108 @@ func (h *RequestHandlerOrderedMap) handleGetAll(payload json.RawMessage) string
 	}
 
 	resp := models.GetAllItemsResponse{
-		Success: true,
-		Items:   items,
+		Success:    true,
+		Items:      items,
+		NextCursor: encodeCursor(next),
 	}
 	return h.toJSON(resp)
 }
 
+// storeItem records and stores an item with an optional TTL, returning its new version.
+// The caller must hold writeMu.
+func (h *RequestHandlerOrderedMap) storeItem(store itemStore, record recordFunc, key, value string, ttlMs int64) (uint64, error) {
+	var deadline time.Time
+	entry := walEntry{Type: models.AddItem, Key: key, Value: value}
+	if ttlMs > 0 {
+		deadline = time.Now().Add(time.Duration(ttlMs) * time.Millisecond)
+		entry.ExpiresAt = deadline.UnixNano()
+	}
+
+	if err := record(entry); err != nil {
+		return 0, err
+	}
+	return store.StoreWithDeadline(key, value, deadline), nil
+}
+
+// logEntry appends a mutation to the write-ahead log, the caller must hold writeMu
+func (h *RequestHandlerOrderedMap) logEntry(entry walEntry) error {
+	if h.wal == nil {
+		return nil
+	}
+	if h.unloggedErr != nil {
+		return h.unloggedErr
+	}
+
+	h.seq++
+	entry.Seq = h.seq
+	record, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to serialize write-ahead log entry: %w", err)
+	}
+	if err := h.wal.Append(record); err != nil {
+		log.Printf("Failed to append to write-ahead log: %v", err)
+		return err
+	}
+	return nil
+}
+
+// onEvict records an evicted item as a deletion, so replay doesn't depend on the eviction policy state.
+// Evictions happen only within mutations, so the caller holds writeMu. The item is already gone,
+// so if the deletion can't be logged, writes fail until a snapshot captures the map.
+func (h *RequestHandlerOrderedMap) onEvict(key, _ string) {
+	if err := h.logEntry(walEntry{Type: models.DeleteItem, Key: key}); err != nil && h.unloggedErr == nil {
+		h.unloggedErr = fmt.Errorf("failed to record eviction of %q: %w", key, err)
+	}
+}
+
+// replayEntry applies a mutation read from the write-ahead log, unless it's already in the restored snapshot
+func (h *RequestHandlerOrderedMap) replayEntry(record []byte) error {
+	var entry walEntry
+	if err := json.Unmarshal(record, &entry); err != nil {
+		return fmt.Errorf("failed to deserialize write-ahead log entry: %w", err)
+	}
+	if h.restoredSeqKnown && entry.Seq <= h.restoredSeq {
+		// The snapshot was written, but the log wasn't truncated before a crash
+		return nil
+	}
+	h.seq = max(h.seq, entry.Seq)
+
+	if entry.Type == models.Transaction {
+		return h.omap.Update(func(tx *orderedmap.Tx[string, string]) error {
+			for _, nested := range entry.Entries {
+				if nested.Type == models.Transaction {
+					return errors.New("nested transaction in write-ahead log")
+				}
+				if err := applyEntry(tx, nested); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return applyEntry(h.omap, entry)
+}
+
+// applyEntry applies a logged mutation to the store
+func applyEntry(store itemStore, entry walEntry) error {
+	switch entry.Type {
+	case models.AddItem:
+		// Items expired while the server was down are stored as expired, so they still replace older values
+		var deadline time.Time
+		if entry.ExpiresAt != 0 {
+			deadline = time.Unix(0, entry.ExpiresAt)
+		}
+		store.StoreWithDeadline(entry.Key, entry.Value, deadline)
+	case models.DeleteItem:
+		if err := store.Delete(entry.Key); err != nil && !errors.Is(err, orderedmap.ErrKeyNotFound) {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown write-ahead log entry type: %s", entry.Type)
+	}
+	return nil
+}
+
 func (h *RequestHandlerOrderedMap) errorResponse(message string) string {
 	return h.toJSON(models.GetAllItemsResponse{
 		Success: false,
@@ -138,6 +569,14 @@ func (h *RequestHandlerOrderedMap) errorResponse(message string) string {
 	})
 }
 
+// errorResult is the result of an item command which couldn't be executed
+func (h *RequestHandlerOrderedMap) errorResult(message string) (any, bool, error) {
+	return models.GetAllItemsResponse{
+		Success: false,
+		Message: message,
+	}, false, nil
+}
+
 func (h *RequestHandlerOrderedMap) toJSON(v interface{}) string {
 	data, err := json.Marshal(v)
 	if err != nil {
@@ -146,3 +585,33 @@ func (h *RequestHandlerOrderedMap) toJSON(v interface{}) string {
 	}
 	return string(data)
 }
+
+// pageCursor is the serialized form of orderedmap.Cursor, clients treat it as an opaque string
+type pageCursor struct {
+	Key   string `json:"k"`
+	Seq   uint64 `json:"s"`
+	Epoch uint64 `json:"e"`
+}
+
+func encodeCursor(cursor *orderedmap.Cursor[string]) string {
+	if cursor == nil {
+		return ""
+	}
+	data, _ := json.Marshal(pageCursor{Key: cursor.Key, Seq: cursor.Seq, Epoch: cursor.Epoch})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (*orderedmap.Cursor[string], error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return &orderedmap.Cursor[string]{Key: cursor.Key, Seq: cursor.Seq, Epoch: cursor.Epoch}, nil
+}
@@ -0,0 +1,170 @@
+package consumer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+)
+
+// ErrSnapshotsDisabled is returned when a snapshot is requested but no snapshot path is configured
+var ErrSnapshotsDisabled = errors.New("snapshots are not configured")
+
+// Handler snapshot layout: magic, format version (uint16), sequence number of the last logged mutation (uint64),
+// followed by the snapshot of the ordered map. Older snapshots are the map snapshot alone.
+const handlerSnapshotVersion uint16 = 1
+
+var handlerSnapshotMagic = [4]byte{'H', 'S', 'N', 'P'}
+
+type handlerSnapshotHeader struct {
+	Magic   [4]byte
+	Version uint16
+	Seq     uint64
+}
+
+// WithSnapshots makes the handler restore the map from the snapshot at path on creation and
+// write a new snapshot there every interval (zero interval disables periodic snapshots).
+// When combined with WithWAL, the log is truncated after every snapshot.
+func WithSnapshots(path string, interval time.Duration) HandlerOption {
+	return func(c *handlerConfig) {
+		c.snapshotPath = path
+		c.snapshotInterval = interval
+	}
+}
+
+// Snapshot writes a point-in-time snapshot of the map to disk and returns the number of captured items
+func (h *RequestHandlerOrderedMap) Snapshot() (int, error) {
+	if h.snapshotPath == "" {
+		return 0, ErrSnapshotsDisabled
+	}
+
+	// Block mutations, so the snapshot and the truncated log stay consistent
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	// Write to a temporary file first, so a crash never leaves a partial snapshot behind
+	tmp, err := os.CreateTemp(filepath.Dir(h.snapshotPath), filepath.Base(h.snapshotPath)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	items := h.omap.Len()
+	header := handlerSnapshotHeader{Magic: handlerSnapshotMagic, Version: handlerSnapshotVersion, Seq: h.seq}
+	if err := binary.Write(tmp, binary.BigEndian, header); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+	if err := h.omap.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), h.snapshotPath); err != nil {
+		return 0, fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+
+	// Mutations are in the snapshot now. If we crash before truncating,
+	// records up to the sequence number in the snapshot are skipped on replay.
+	if h.wal != nil {
+		if err := h.wal.Truncate(); err != nil {
+			return 0, fmt.Errorf("failed to truncate write-ahead log: %w", err)
+		}
+	}
+	// Evictions which couldn't be logged are in the snapshot too
+	h.unloggedErr = nil
+	return items, nil
+}
+
+// restoreSnapshot loads the map from the snapshot file if it exists
+func (h *RequestHandlerOrderedMap) restoreSnapshot() error {
+	if h.snapshotPath == "" {
+		return nil
+	}
+
+	file, err := os.Open(h.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	magic, err := r.Peek(len(handlerSnapshotMagic))
+	if err == nil && [4]byte(magic) == handlerSnapshotMagic {
+		var header handlerSnapshotHeader
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return fmt.Errorf("failed to read snapshot header: %w", err)
+		}
+		if header.Version != handlerSnapshotVersion {
+			return fmt.Errorf("unsupported snapshot version: %d", header.Version)
+		}
+		h.restoredSeq, h.restoredSeqKnown = header.Seq, true
+		h.seq = header.Seq
+	}
+
+	if err := h.omap.Restore(r); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return nil
+}
+
+func (h *RequestHandlerOrderedMap) snapshotLoop(interval time.Duration) {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if items, err := h.Snapshot(); err != nil {
+				log.Printf("Periodic snapshot failed: %v", err)
+			} else {
+				log.Printf("Periodic snapshot written, %d items", items)
+			}
+		case <-h.stopChan:
+			return
+		}
+	}
+}
+
+func (h *RequestHandlerOrderedMap) handleSnapshot(payload json.RawMessage) string {
+	var req models.SnapshotRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Printf("Failed to deserialize SnapshotRequest: %v", err)
+		return h.errorResponse("invalid payload for Snapshot")
+	}
+
+	items, err := h.Snapshot()
+	if err != nil {
+		log.Printf("Failed to write snapshot: %v", err)
+		resp := models.SnapshotResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		return h.toJSON(resp)
+	}
+
+	resp := models.SnapshotResponse{
+		Success: true,
+		Items:   items,
+		Message: "snapshot written",
+	}
+	return h.toJSON(resp)
+}
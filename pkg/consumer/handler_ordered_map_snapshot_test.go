@@ -0,0 +1,147 @@
+package consumer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestHandlerOrderedMapSnapshotCommand(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "handler.snapshot")
+	walPath := filepath.Join(dir, "handler.wal")
+
+	openHandler := func() (*RequestHandlerOrderedMap, *wal.Log) {
+		walLog, err := wal.Open(walPath)
+		assert.NoError(t, err)
+		handler, err := NewRequestHandlerOrderedMap(WithWAL(walLog), WithSnapshots(snapshotPath, 0))
+		assert.NoError(t, err)
+		return handler, walLog
+	}
+
+	handler, walLog := openHandler()
+	for i := 0; i < 20; i++ {
+		executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: fmt.Sprintf("key%d", i), Value: "before"})
+	}
+	executeRequest(t, handler, models.DeleteItem, models.DeleteItemRequest{Key: "key3"})
+
+	// Test snapshot admin command
+	var snapshotResponse models.SnapshotResponse
+	err := models.DeserializeResponse(executeRequest(t, handler, models.Snapshot, models.SnapshotRequest{}), &snapshotResponse)
+	assert.NoError(t, err)
+	assert.True(t, snapshotResponse.Success)
+	assert.Equal(t, 19, snapshotResponse.Items)
+
+	// The log is truncated after the snapshot
+	info, err := os.Stat(walPath)
+	assert.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	// Mutations after the snapshot go to the log only
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "key3", Value: "after"})
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "key0", Value: "after"})
+	executeRequest(t, handler, models.DeleteItem, models.DeleteItemRequest{Key: "key5"})
+	expected := getAllItems(t, handler)
+
+	var pageResponse models.GetAllItemsResponse
+	err = models.DeserializeResponse(executeRequest(t, handler, models.GetAll, models.GetAllItemsRequest{Limit: 5}), &pageResponse)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pageResponse.NextCursor)
+	assert.NoError(t, walLog.Close())
+
+	// Test restart restores the snapshot and replays the log on top of it
+	handler, walLog = openHandler()
+	defer walLog.Close()
+	assert.Equal(t, expected, getAllItems(t, handler))
+	assert.Equal(t, "key3", expected[len(expected)-1].Key)
+
+	// Test a cursor from before the restart is rejected instead of resuming at a wrong position
+	request := models.GetAllItemsRequest{Cursor: pageResponse.NextCursor, Limit: 5}
+	err = models.DeserializeResponse(executeRequest(t, handler, models.GetAll, request), &pageResponse)
+	assert.NoError(t, err)
+	assert.False(t, pageResponse.Success)
+	assert.Equal(t, "invalid cursor", pageResponse.Message)
+}
+
+func TestRequestHandlerOrderedMapSnapshotCrashBeforeTruncate(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "handler.snapshot")
+	walPath := filepath.Join(dir, "handler.wal")
+
+	openHandler := func() (*RequestHandlerOrderedMap, *wal.Log) {
+		walLog, err := wal.Open(walPath)
+		assert.NoError(t, err)
+		handler, err := NewRequestHandlerOrderedMap(WithWAL(walLog), WithSnapshots(snapshotPath, 0))
+		assert.NoError(t, err)
+		return handler, walLog
+	}
+
+	handler, walLog := openHandler()
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "j", Value: "1"})
+	_, err := handler.Snapshot()
+	assert.NoError(t, err)
+	executeRequest(t, handler, models.DeleteItem, models.DeleteItemRequest{Key: "j"})
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "j", Value: "2"})
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "k", Value: "3"})
+	expected := []models.KeyValuePair{{Key: "j", Value: "2"}, {Key: "k", Value: "3"}}
+	assert.Equal(t, expected, getAllItems(t, handler))
+
+	// Simulate a crash between writing the snapshot and truncating the log
+	records, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	_, err = handler.Snapshot()
+	assert.NoError(t, err)
+	handler.Close()
+	assert.NoError(t, walLog.Close())
+	assert.NoError(t, os.WriteFile(walPath, records, 0o644))
+
+	// Test records in the snapshot are not replayed again, so the order is kept
+	handler, walLog = openHandler()
+	assert.Equal(t, expected, getAllItems(t, handler))
+
+	// Test mutations after the restart are replayed on top of the snapshot
+	executeRequest(t, handler, models.DeleteItem, models.DeleteItemRequest{Key: "j"})
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "j", Value: "4"})
+	handler.Close()
+	assert.NoError(t, walLog.Close())
+
+	handler, walLog = openHandler()
+	defer walLog.Close()
+	defer handler.Close()
+	assert.Equal(t, []models.KeyValuePair{{Key: "k", Value: "3"}, {Key: "j", Value: "4"}}, getAllItems(t, handler))
+}
+
+func TestRequestHandlerOrderedMapPeriodicSnapshots(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "handler.snapshot")
+
+	handler, err := NewRequestHandlerOrderedMap(WithSnapshots(snapshotPath, 10*time.Millisecond))
+	assert.NoError(t, err)
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "key", Value: "value"})
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(snapshotPath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	handler.Close()
+
+	restored, err := NewRequestHandlerOrderedMap(WithSnapshots(snapshotPath, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, []models.KeyValuePair{{Key: "key", Value: "value"}}, getAllItems(t, restored))
+}
+
+func TestRequestHandlerOrderedMapSnapshotsDisabled(t *testing.T) {
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+
+	var snapshotResponse models.SnapshotResponse
+	err = models.DeserializeResponse(executeRequest(t, handler, models.Snapshot, models.SnapshotRequest{}), &snapshotResponse)
+	assert.NoError(t, err)
+	assert.False(t, snapshotResponse.Success)
+	assert.Equal(t, ErrSnapshotsDisabled.Error(), snapshotResponse.Message)
+}
@@ -1,21 +1,59 @@
 package consumer
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/orderedmap"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/wal"
 	"github.com/stretchr/testify/assert"
 )
 
+func executeRequest(t *testing.T, handler *RequestHandlerOrderedMap, requestType models.RequestType, payload interface{}) string {
+	raw, err := models.SerializeRequest(requestType, payload)
+	assert.NoError(t, err)
+	return executeRaw(t, handler, raw)
+}
+
+// executeRaw executes a serialized request which must not fail
+func executeRaw(t *testing.T, handler *RequestHandlerOrderedMap, raw string) string {
+	response, err := handler.Execute(raw)
+	assert.NoError(t, err)
+	return response
+}
+
+// getAllItems collects all items from the handler page by page
+func getAllItems(t *testing.T, handler *RequestHandlerOrderedMap) []models.KeyValuePair {
+	items := []models.KeyValuePair{}
+	request := models.GetAllItemsRequest{}
+	for {
+		var response models.GetAllItemsResponse
+		err := models.DeserializeResponse(executeRequest(t, handler, models.GetAll, request), &response)
+		assert.NoError(t, err)
+		assert.True(t, response.Success)
+
+		items = append(items, response.Items...)
+		if response.NextCursor == "" {
+			return items
+		}
+		request.Cursor = response.NextCursor
+	}
+}
+
 func TestRequestHandlerOrderedMapWithModels(t *testing.T) {
-	handler := NewRequestHandlerOrderedMap()
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
 
 	// Test AddItem
 	addItemRequest := models.AddItemRequest{Key: "testKey1", Value: "testValue1"}
 	rawAddItem, err := models.SerializeRequest(models.AddItem, addItemRequest)
 	assert.NoError(t, err)
 
-	response := handler.Execute(rawAddItem)
+	response := executeRaw(t, handler, rawAddItem)
 	var addItemResponse models.AddItemResponse
 	err = models.DeserializeResponse(response, &addItemResponse)
 	assert.NoError(t, err)
@@ -27,7 +65,7 @@ func TestRequestHandlerOrderedMapWithModels(t *testing.T) {
 	rawGetItem, err := models.SerializeRequest(models.GetItem, getItemRequest)
 	assert.NoError(t, err)
 
-	response = handler.Execute(rawGetItem)
+	response = executeRaw(t, handler, rawGetItem)
 	var getItemResponse models.GetItemResponse
 	err = models.DeserializeResponse(response, &getItemResponse)
 	assert.NoError(t, err)
@@ -39,7 +77,7 @@ func TestRequestHandlerOrderedMapWithModels(t *testing.T) {
 	rawDeleteItem, err := models.SerializeRequest(models.DeleteItem, deleteItemRequest)
 	assert.NoError(t, err)
 
-	response = handler.Execute(rawDeleteItem)
+	response = executeRaw(t, handler, rawDeleteItem)
 	var deleteItemResponse models.DeleteItemResponse
 	err = models.DeserializeResponse(response, &deleteItemResponse)
 	assert.NoError(t, err)
@@ -51,10 +89,277 @@ func TestRequestHandlerOrderedMapWithModels(t *testing.T) {
 	rawGetAll, err := models.SerializeRequest(models.GetAll, getAllRequest)
 	assert.NoError(t, err)
 
-	response = handler.Execute(rawGetAll)
+	response = executeRaw(t, handler, rawGetAll)
 	var getAllResponse models.GetAllItemsResponse
 	err = models.DeserializeResponse(response, &getAllResponse)
 	assert.NoError(t, err)
 	assert.True(t, getAllResponse.Success)
 	assert.Empty(t, getAllResponse.Items)
 }
+
+func TestRequestHandlerOrderedMapPagination(t *testing.T) {
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+
+	for i := 0; i < 25; i++ {
+		rawAddItem, err := models.SerializeRequest(models.AddItem, models.AddItemRequest{
+			Key:   fmt.Sprintf("key%02d", i),
+			Value: fmt.Sprintf("value%02d", i),
+		})
+		assert.NoError(t, err)
+		executeRaw(t, handler, rawAddItem)
+	}
+
+	// Walk all the pages, deleting a key which is not read yet on the way
+	var keys []string
+	request := models.GetAllItemsRequest{Limit: 10}
+	for page := 0; ; page++ {
+		rawGetAll, err := models.SerializeRequest(models.GetAll, request)
+		assert.NoError(t, err)
+
+		var getAllResponse models.GetAllItemsResponse
+		err = models.DeserializeResponse(executeRaw(t, handler, rawGetAll), &getAllResponse)
+		assert.NoError(t, err)
+		assert.True(t, getAllResponse.Success)
+		assert.LessOrEqual(t, len(getAllResponse.Items), 10)
+
+		for _, item := range getAllResponse.Items {
+			keys = append(keys, item.Key)
+		}
+		if getAllResponse.NextCursor == "" {
+			break
+		}
+		if page == 0 {
+			rawDeleteItem, err := models.SerializeRequest(models.DeleteItem, models.DeleteItemRequest{Key: "key10"})
+			assert.NoError(t, err)
+			executeRaw(t, handler, rawDeleteItem)
+		}
+		request.Cursor = getAllResponse.NextCursor
+	}
+
+	assert.Len(t, keys, 24)
+	assert.Equal(t, "key00", keys[0])
+	assert.Equal(t, "key11", keys[10])
+	assert.Equal(t, "key24", keys[23])
+
+	// Test invalid cursor
+	rawGetAll, err := models.SerializeRequest(models.GetAll, models.GetAllItemsRequest{Cursor: "%%%"})
+	assert.NoError(t, err)
+
+	var getAllResponse models.GetAllItemsResponse
+	err = models.DeserializeResponse(executeRaw(t, handler, rawGetAll), &getAllResponse)
+	assert.NoError(t, err)
+	assert.False(t, getAllResponse.Success)
+	assert.Equal(t, "invalid cursor", getAllResponse.Message)
+}
+
+func TestRequestHandlerOrderedMapWALRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.wal")
+
+	// Killed handlers are left running until the test ends, as a crashed process would leave its file behind
+	openHandler := func() (*RequestHandlerOrderedMap, *wal.Log) {
+		walLog, err := wal.Open(path)
+		assert.NoError(t, err)
+		handler, err := NewRequestHandlerOrderedMap(WithWAL(walLog))
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			handler.Close()
+			walLog.Close()
+		})
+		return handler, walLog
+	}
+
+	// Shadow handler without persistence receives the same stream of commands
+	expected, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer expected.Close()
+
+	handler, _ := openHandler()
+	for i := 0; i < 300; i++ {
+		var requestType models.RequestType
+		var payload interface{}
+		switch {
+		case i%7 == 3:
+			requestType, payload = models.DeleteItem, models.DeleteItemRequest{Key: fmt.Sprintf("key%d", i/2)}
+		case i%5 == 0:
+			requestType, payload = models.AddItem, models.AddItemRequest{Key: fmt.Sprintf("key%d", i/3), Value: fmt.Sprintf("overwritten%d", i)}
+		default:
+			requestType, payload = models.AddItem, models.AddItemRequest{Key: fmt.Sprintf("key%d", i), Value: fmt.Sprintf("value%d", i)}
+		}
+		executeRequest(t, expected, requestType, payload)
+		executeRequest(t, handler, requestType, payload)
+
+		if i%100 == 99 {
+			// Kill the handler mid-stream without closing the log and start a new one over the same file
+			handler, _ = openHandler()
+			assert.Equal(t, getAllItems(t, expected), getAllItems(t, handler))
+		}
+	}
+
+	handler, walLog := openHandler()
+	assert.Equal(t, getAllItems(t, expected), getAllItems(t, handler))
+	assert.NoError(t, walLog.Close())
+
+	// A torn record left by a crash is ignored
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	handler, _ = openHandler()
+	assert.Equal(t, getAllItems(t, expected), getAllItems(t, handler))
+}
+
+func TestRequestHandlerOrderedMapTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.wal")
+	walLog, err := wal.Open(path)
+	assert.NoError(t, err)
+
+	handler, err := NewRequestHandlerOrderedMap(WithWAL(walLog), WithSweepInterval(5*time.Millisecond))
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "persistent", Value: "value"})
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "persistent", Value: "overwritten", TTLMs: 3600000})
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "expiring", Value: "value", TTLMs: 50})
+
+	var getItemResponse models.GetItemResponse
+	err = models.DeserializeResponse(executeRequest(t, handler, models.GetItem, models.GetItemRequest{Key: "expiring"}), &getItemResponse)
+	assert.NoError(t, err)
+	assert.True(t, getItemResponse.Success)
+	assert.Len(t, getAllItems(t, handler), 2)
+
+	// Test expired item disappears from responses
+	assert.Eventually(t, func() bool {
+		return len(getAllItems(t, handler)) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	err = models.DeserializeResponse(executeRequest(t, handler, models.GetItem, models.GetItemRequest{Key: "expiring"}), &getItemResponse)
+	assert.NoError(t, err)
+	assert.False(t, getItemResponse.Success)
+	assert.Equal(t, "key not found", getItemResponse.Message)
+
+	// Test invalid TTL
+	var addItemResponse models.AddItemResponse
+	err = models.DeserializeResponse(executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "key", Value: "value", TTLMs: -1}), &addItemResponse)
+	assert.NoError(t, err)
+	assert.False(t, addItemResponse.Success)
+
+	// Test replay keeps the original deadlines
+	expected := getAllItems(t, handler)
+	assert.NoError(t, walLog.Close())
+
+	walLog, err = wal.Open(path)
+	assert.NoError(t, err)
+	defer walLog.Close()
+
+	restored, err := NewRequestHandlerOrderedMap(WithWAL(walLog))
+	assert.NoError(t, err)
+	defer restored.Close()
+	assert.Equal(t, expected, getAllItems(t, restored))
+}
+
+func TestRequestHandlerOrderedMapMaxItems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.wal")
+
+	openHandler := func() (*RequestHandlerOrderedMap, *wal.Log) {
+		walLog, err := wal.Open(path)
+		assert.NoError(t, err)
+		handler, err := NewRequestHandlerOrderedMap(WithWAL(walLog), WithMaxItems(5, orderedmap.EvictLRU))
+		assert.NoError(t, err)
+		return handler, walLog
+	}
+
+	handler, walLog := openHandler()
+	for i := 0; i < 10; i++ {
+		executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: fmt.Sprintf("key%d", i), Value: "value"})
+		// Keep the first key hot, so LRU never evicts it
+		executeRequest(t, handler, models.GetItem, models.GetItemRequest{Key: "key0"})
+	}
+
+	items := getAllItems(t, handler)
+	assert.Len(t, items, 5)
+	assert.Equal(t, "key0", items[0].Key)
+	assert.Equal(t, "key9", items[4].Key)
+	handler.Close()
+	assert.NoError(t, walLog.Close())
+
+	// Test replay reproduces evictions regardless of the access history
+	handler, walLog = openHandler()
+	defer walLog.Close()
+	defer handler.Close()
+	assert.Equal(t, items, getAllItems(t, handler))
+}
+
+func TestRequestHandlerOrderedMapUnloggedEviction(t *testing.T) {
+	dir := t.TempDir()
+	walLog, err := wal.Open(filepath.Join(dir, "handler.wal"))
+	assert.NoError(t, err)
+	handler, err := NewRequestHandlerOrderedMap(WithWAL(walLog), WithSnapshots(filepath.Join(dir, "handler.snapshot"), 0))
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "key", Value: "value"})
+
+	// An eviction fails to be logged, as if the log broke between the write and its evictions
+	assert.NoError(t, walLog.Close())
+	handler.writeMu.Lock()
+	handler.onEvict("key", "value")
+	handler.writeMu.Unlock()
+
+	reopened, err := wal.Open(filepath.Join(dir, "handler.wal"))
+	assert.NoError(t, err)
+	defer reopened.Close()
+	handler.wal = reopened
+
+	// Test writes fail even with a working log, replay would bring the evicted item back
+	add, err := models.SerializeRequest(models.AddItem, models.AddItemRequest{Key: "other", Value: "value"})
+	assert.NoError(t, err)
+	_, err = handler.Execute(add)
+	assert.ErrorIs(t, err, wal.ErrClosed)
+	tx, err := models.SerializeRequest(models.Transaction, models.TransactionRequest{})
+	assert.NoError(t, err)
+	_, err = handler.Execute(tx)
+	assert.ErrorIs(t, err, wal.ErrClosed)
+
+	// Test writes succeed again once a snapshot captures the map
+	_, err = handler.Snapshot()
+	assert.NoError(t, err)
+	executeRaw(t, handler, add)
+}
+
+func TestRequestHandlerOrderedMapKeys(t *testing.T) {
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	serialize := func(requestType models.RequestType, payload interface{}) string {
+		raw, err := models.SerializeRequest(requestType, payload)
+		assert.NoError(t, err)
+		return raw
+	}
+	deleteFirst, err := models.NewRequestWrapper(models.DeleteItem, models.DeleteItemRequest{Key: "first"})
+	assert.NoError(t, err)
+	addSecond, err := models.NewRequestWrapper(models.AddItem, models.AddItemRequest{Key: "second", Value: "value"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		request  string
+		expected []string
+	}{
+		{serialize(models.AddItem, models.AddItemRequest{Key: "key1", Value: "value"}), []string{"key1"}},
+		{serialize(models.DeleteItem, models.DeleteItemRequest{Key: "key2"}), []string{"key2"}},
+		{serialize(models.GetItem, models.GetItemRequest{Key: "key3"}), []string{"key3"}},
+		{serialize(models.CasItem, models.CasItemRequest{Key: "key4", Value: "value", Version: 1}), []string{"key4"}},
+		{serialize(models.AddIfAbsent, models.AddIfAbsentRequest{Key: "key5", Value: "value"}), []string{"key5"}},
+		{serialize(models.Transaction, models.TransactionRequest{Requests: []models.RequestWrapper{deleteFirst, addSecond}}), []string{"first", "second"}},
+		{serialize(models.Transaction, models.TransactionRequest{}), nil},
+		{serialize(models.GetAll, models.GetAllItemsRequest{}), nil},
+		{serialize(models.Snapshot, models.SnapshotRequest{}), nil},
+		{"not a command", nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, handler.Keys(test.request), test.request)
+	}
+}
@@ -0,0 +1,98 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/orderedmap"
+)
+
+// errTransactionAborted is returned from the transaction function to discard the staged writes
+var errTransactionAborted = errors.New("transaction aborted")
+
+// txCommand returns the item command allowed within a transaction
+func (h *RequestHandlerOrderedMap) txCommand(requestType models.RequestType) (itemCommand, bool) {
+	switch requestType {
+	case models.AddItem:
+		return h.addItem, true
+	case models.DeleteItem:
+		return h.deleteItem, true
+	case models.GetItem:
+		return h.getItem, true
+	case models.CasItem:
+		return h.casItem, true
+	case models.AddIfAbsent:
+		return h.addIfAbsent, true
+	default:
+		return nil, false
+	}
+}
+
+// handleTransaction executes the requests under a single map lock. The writes are staged and applied
+// only if every request succeeds, then they are logged to the write-ahead log as one record.
+// Reads and deletes with IgnoreMissing don't abort the transaction if their key is missing, their results tell it.
+// It fails if the record couldn't be logged, then nothing is applied.
+func (h *RequestHandlerOrderedMap) handleTransaction(payload json.RawMessage) (string, error) {
+	var req models.TransactionRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Printf("Failed to deserialize TransactionRequest: %v", err)
+		return h.errorResponse("invalid payload for Transaction"), nil
+	}
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	results := make([]json.RawMessage, 0, len(req.Requests))
+	var entries []walEntry
+	record := func(entry walEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}
+
+	err := h.omap.Update(func(tx *orderedmap.Tx[string, string]) error {
+		for i, request := range req.Requests {
+			command, allowed := h.txCommand(request.Type)
+			if !allowed {
+				results = append(results, json.RawMessage(h.errorResponse("command type not allowed in transaction")))
+				return fmt.Errorf("%w at request %d", errTransactionAborted, i)
+			}
+
+			response, ok, _ := command(tx, record, request.Payload)
+			results = append(results, json.RawMessage(h.toJSON(response)))
+			if !ok {
+				return fmt.Errorf("%w at request %d", errTransactionAborted, i)
+			}
+		}
+
+		// Logging under the map lock, so the record is written before anyone can see the writes
+		if len(entries) == 0 {
+			return nil
+		}
+		return h.logEntry(walEntry{Type: models.Transaction, Entries: entries})
+	})
+	if err == nil {
+		// Evictions of the transaction are logged after it's applied
+		err = h.unloggedErr
+	}
+
+	if errors.Is(err, errTransactionAborted) {
+		resp := models.TransactionResponse{
+			Success: false,
+			Results: results,
+			Message: err.Error(),
+		}
+		return h.toJSON(resp), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to persist command: %w", err)
+	}
+
+	resp := models.TransactionResponse{
+		Success: true,
+		Results: results,
+	}
+	return h.toJSON(resp), nil
+}
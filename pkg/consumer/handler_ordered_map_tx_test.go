@@ -0,0 +1,171 @@
+package consumer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+// wrapRequest wraps a request to put it into a transaction
+func wrapRequest(t *testing.T, requestType models.RequestType, payload interface{}) models.RequestWrapper {
+	wrapper, err := models.NewRequestWrapper(requestType, payload)
+	assert.NoError(t, err)
+	return wrapper
+}
+
+func executeTransaction(t *testing.T, handler *RequestHandlerOrderedMap, requests ...models.RequestWrapper) models.TransactionResponse {
+	var response models.TransactionResponse
+	raw := executeRequest(t, handler, models.Transaction, models.TransactionRequest{Requests: requests})
+	assert.NoError(t, models.DeserializeResponse(raw, &response))
+	return response
+}
+
+func TestRequestHandlerOrderedMapTransaction(t *testing.T) {
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "a", Value: "1"})
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "b", Value: "2"})
+
+	response := executeTransaction(t, handler,
+		wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "c", Value: "3"}),
+		wrapRequest(t, models.DeleteItem, models.DeleteItemRequest{Key: "a"}),
+		wrapRequest(t, models.GetItem, models.GetItemRequest{Key: "c"}),
+		wrapRequest(t, models.AddIfAbsent, models.AddIfAbsentRequest{Key: "a", Value: "10"}),
+	)
+	assert.True(t, response.Success)
+	assert.Len(t, response.Results, 4)
+
+	// Test results of the requests see the earlier writes of the transaction
+	var addResponse models.AddItemResponse
+	assert.NoError(t, models.DeserializeResponse(string(response.Results[0]), &addResponse))
+	assert.True(t, addResponse.Success)
+
+	var getResponse models.GetItemResponse
+	assert.NoError(t, models.DeserializeResponse(string(response.Results[2]), &getResponse))
+	assert.True(t, getResponse.Success)
+	assert.Equal(t, "3", getResponse.Value)
+	assert.Equal(t, addResponse.Version, getResponse.Version)
+
+	assert.Equal(t, []models.KeyValuePair{
+		{Key: "b", Value: "2"},
+		{Key: "c", Value: "3"},
+		{Key: "a", Value: "10"},
+	}, getAllItems(t, handler))
+}
+
+func TestRequestHandlerOrderedMapTransactionAborts(t *testing.T) {
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "a", Value: "1"})
+	before := getAllItems(t, handler)
+
+	// Test a failed request discards the writes made before it
+	response := executeTransaction(t, handler,
+		wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "b", Value: "2"}),
+		wrapRequest(t, models.DeleteItem, models.DeleteItemRequest{Key: "a"}),
+		wrapRequest(t, models.CasItem, models.CasItemRequest{Key: "b", Value: "3", Version: 1}),
+		wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "c", Value: "4"}),
+	)
+	assert.False(t, response.Success)
+	assert.Len(t, response.Results, 3)
+	assert.Equal(t, "transaction aborted at request 2", response.Message)
+
+	var casResponse models.CasItemResponse
+	assert.NoError(t, models.DeserializeResponse(string(response.Results[2]), &casResponse))
+	assert.False(t, casResponse.Success)
+	assert.Equal(t, "version mismatch", casResponse.Message)
+	assert.Equal(t, before, getAllItems(t, handler))
+
+	// Test commands that can't be part of a transaction
+	for _, requestType := range []models.RequestType{models.GetAll, models.Snapshot, models.Transaction, "unknown"} {
+		response = executeTransaction(t, handler,
+			wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "b", Value: "2"}),
+			wrapRequest(t, requestType, struct{}{}),
+		)
+		assert.False(t, response.Success, requestType)
+		assert.Len(t, response.Results, 2)
+		assert.Equal(t, before, getAllItems(t, handler))
+	}
+
+	// Test invalid payload of a nested request
+	response = executeTransaction(t, handler, models.RequestWrapper{Type: models.AddItem, Payload: []byte(`"key"`)})
+	assert.False(t, response.Success)
+	assert.Equal(t, before, getAllItems(t, handler))
+}
+
+func TestRequestHandlerOrderedMapTransactionMissingKeys(t *testing.T) {
+	handler, err := NewRequestHandlerOrderedMap()
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	// Test a delete of a missing key aborts the transaction
+	response := executeTransaction(t, handler,
+		wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "a", Value: "1"}),
+		wrapRequest(t, models.DeleteItem, models.DeleteItemRequest{Key: "missing"}),
+	)
+	assert.False(t, response.Success)
+	assert.Len(t, response.Results, 2)
+	assert.Empty(t, getAllItems(t, handler))
+
+	// Test reads and deletes with IgnoreMissing fail on their own, the writes are applied
+	response = executeTransaction(t, handler,
+		wrapRequest(t, models.GetItem, models.GetItemRequest{Key: "missing", IgnoreMissing: true}),
+		wrapRequest(t, models.DeleteItem, models.DeleteItemRequest{Key: "missing", IgnoreMissing: true}),
+		wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "a", Value: "1"}),
+	)
+	assert.True(t, response.Success)
+	assert.Len(t, response.Results, 3)
+
+	var getResponse models.GetItemResponse
+	assert.NoError(t, models.DeserializeResponse(string(response.Results[0]), &getResponse))
+	assert.Equal(t, models.GetItemResponse{Success: false, Message: "key not found"}, getResponse)
+
+	var deleteResponse models.DeleteItemResponse
+	assert.NoError(t, models.DeserializeResponse(string(response.Results[1]), &deleteResponse))
+	assert.False(t, deleteResponse.Success)
+
+	assert.Equal(t, []models.KeyValuePair{{Key: "a", Value: "1"}}, getAllItems(t, handler))
+}
+
+func TestRequestHandlerOrderedMapTransactionWALRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.wal")
+	walLog, err := wal.Open(path)
+	assert.NoError(t, err)
+
+	handler, err := NewRequestHandlerOrderedMap(WithWAL(walLog))
+	assert.NoError(t, err)
+
+	executeRequest(t, handler, models.AddItem, models.AddItemRequest{Key: "a", Value: "1"})
+	response := executeTransaction(t, handler,
+		wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "b", Value: "2"}),
+		wrapRequest(t, models.DeleteItem, models.DeleteItemRequest{Key: "a"}),
+		wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "c", Value: "3", TTLMs: 60_000}),
+	)
+	assert.True(t, response.Success)
+	response = executeTransaction(t, handler,
+		wrapRequest(t, models.AddItem, models.AddItemRequest{Key: "d", Value: "4"}),
+		wrapRequest(t, models.DeleteItem, models.DeleteItemRequest{Key: "missing"}),
+	)
+	assert.False(t, response.Success)
+
+	expected := getAllItems(t, handler)
+	handler.Close()
+	assert.NoError(t, walLog.Close())
+
+	walLog, err = wal.Open(path)
+	assert.NoError(t, err)
+	defer walLog.Close()
+	handler, err = NewRequestHandlerOrderedMap(WithWAL(walLog))
+	assert.NoError(t, err)
+	defer handler.Close()
+
+	assert.Equal(t, expected, getAllItems(t, handler))
+	assert.Equal(t, []models.KeyValuePair{{Key: "b", Value: "2"}, {Key: "c", Value: "3"}}, expected)
+}
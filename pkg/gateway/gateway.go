@@ -0,0 +1,180 @@
+// Package gateway exposes the item store over HTTP/JSON. REST requests are translated into models commands
+// and sent through the message queue, so the consumer executes them as any other request.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+)
+
+// DefaultTimeout is how long a request waits for the reply if the timeout is not set
+const DefaultTimeout = 5 * time.Second
+
+// maxBodySize limits request bodies
+const maxBodySize = 1 << 20
+
+// IdempotencyKeyHeader sets the request ID of the command, so a retried request is not executed twice
+// if the consumer deduplicates requests
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Gateway is an http.Handler serving:
+//
+//	PUT    /items/{key}  body {"value": "...", "ttl_ms": 0}, adds or replaces the item
+//	GET    /items/{key}  gets the item, 404 if there is none
+//	DELETE /items/{key}  deletes the item, 404 if there is none
+//	GET    /items        gets a page of items, query parameters limit and cursor
+//
+// Replies are the models responses as JSON.
+type Gateway struct {
+	client  mq.ClientMQ
+	timeout time.Duration
+	mux     *http.ServeMux
+}
+
+// putItemBody is the body of PUT /items/{key}
+type putItemBody struct {
+	Value string `json:"value"`
+	TTLMs int64  `json:"ttl_ms,omitempty"` // Item expires after this many milliseconds, never if not set
+}
+
+// errorResponse is the reply to requests which didn't reach the store, shaped as models responses
+type errorResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// NewGateway creates a gateway sending commands through the client, they fail if not replied within the timeout
+func NewGateway(client mq.ClientMQ, timeout time.Duration) *Gateway {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	g := &Gateway{
+		client:  client,
+		timeout: timeout,
+		mux:     http.NewServeMux(),
+	}
+	g.mux.HandleFunc("PUT /items/{key}", g.putItem)
+	g.mux.HandleFunc("GET /items/{key}", g.getItem)
+	g.mux.HandleFunc("DELETE /items/{key}", g.deleteItem)
+	g.mux.HandleFunc("GET /items", g.getAllItems)
+	return g
+}
+
+// ServeHTTP implements http.Handler
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+func (g *Gateway) putItem(w http.ResponseWriter, r *http.Request) {
+	var body putItemBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+		return
+	}
+	if body.TTLMs < 0 {
+		writeError(w, http.StatusBadRequest, "negative ttl_ms")
+		return
+	}
+
+	g.execute(w, r, models.AddItem, models.AddItemRequest{
+		Key:   r.PathValue("key"),
+		Value: body.Value,
+		TTLMs: body.TTLMs,
+	}, http.StatusInternalServerError)
+}
+
+func (g *Gateway) getItem(w http.ResponseWriter, r *http.Request) {
+	g.execute(w, r, models.GetItem, models.GetItemRequest{Key: r.PathValue("key")}, http.StatusNotFound)
+}
+
+func (g *Gateway) deleteItem(w http.ResponseWriter, r *http.Request) {
+	g.execute(w, r, models.DeleteItem, models.DeleteItemRequest{Key: r.PathValue("key")}, http.StatusNotFound)
+}
+
+func (g *Gateway) getAllItems(w http.ResponseWriter, r *http.Request) {
+	request := models.GetAllItemsRequest{Cursor: r.URL.Query().Get("cursor")}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		if request.Limit, err = strconv.Atoi(limit); err != nil || request.Limit < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", limit))
+			return
+		}
+	}
+
+	// The store refuses invalid cursors
+	g.execute(w, r, models.GetAll, request, http.StatusBadRequest)
+}
+
+// execute sends the command and writes its response, failureStatus is the status of unsuccessful responses
+func (g *Gateway) execute(w http.ResponseWriter, r *http.Request, requestType models.RequestType, payload interface{}, failureStatus int) {
+	request, err := models.NewRequestWrapper(requestType, payload)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	request.RequestID = r.Header.Get(IdempotencyKeyHeader)
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to serialize request: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), g.timeout)
+	defer cancel()
+
+	replyChan, err := g.client.RequestContext(ctx, string(data))
+	if err != nil {
+		writeError(w, errorStatus(err), fmt.Sprintf("failed to send request: %v", err))
+		return
+	}
+	reply := <-replyChan
+	if reply.Err != nil {
+		writeError(w, errorStatus(reply.Err), fmt.Sprintf("request failed: %v", reply.Err))
+		return
+	}
+
+	var response struct {
+		Success bool `json:"success"`
+	}
+	if err := json.Unmarshal([]byte(reply.Data), &response); err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("invalid response: %v", err))
+		return
+	}
+
+	status := http.StatusOK
+	if !response.Success {
+		status = failureStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, reply.Data)
+}
+
+// errorStatus is the status of requests which failed without a response
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, mq.ErrNotConnected), errors.Is(err, mq.ErrConnectionLost), errors.Is(err, mq.ErrClosed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Success: false, Message: message})
+}
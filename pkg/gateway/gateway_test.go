@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/consumer"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestGateway serves a gateway in front of a consumer with the ordered map handler
+func newTestGateway(t *testing.T) *httptest.Server {
+	server := mq.NewInprocServer()
+	t.Cleanup(func() { server.Close() })
+
+	handler, err := consumer.NewRequestHandlerOrderedMap()
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	t.Cleanup(handler.Close)
+
+	con := consumer.NewConsumer(server, 2, handler.Execute, consumer.WithDedup(100))
+	if err := con.Start(); err != nil {
+		t.Fatalf("Failed to start consumer: %v", err)
+	}
+	t.Cleanup(con.Stop)
+
+	httpServer := httptest.NewServer(NewGateway(mq.NewInprocClient(server), time.Second))
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// do sends the request and decodes the JSON reply into target
+func do(t *testing.T, method, url, body string, header http.Header, target interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	if target != nil {
+		assert.NoError(t, json.Unmarshal(data, target), string(data))
+	}
+	return resp.StatusCode
+}
+
+func TestGatewayItems(t *testing.T) {
+	server := newTestGateway(t)
+
+	// Test adding and getting an item
+	var added models.AddItemResponse
+	assert.Equal(t, http.StatusOK, do(t, http.MethodPut, server.URL+"/items/key1", `{"value":"value1"}`, nil, &added))
+	assert.True(t, added.Success)
+	assert.Equal(t, uint64(1), added.Version)
+
+	var item models.GetItemResponse
+	assert.Equal(t, http.StatusOK, do(t, http.MethodGet, server.URL+"/items/key1", "", nil, &item))
+	assert.Equal(t, models.GetItemResponse{Success: true, Value: "value1", Version: 1}, item)
+
+	// Test replacing the item bumps its version
+	assert.Equal(t, http.StatusOK, do(t, http.MethodPut, server.URL+"/items/key1", `{"value":"value2"}`, nil, &added))
+	assert.Equal(t, uint64(2), added.Version)
+
+	// Test listing items page by page
+	assert.Equal(t, http.StatusOK, do(t, http.MethodPut, server.URL+"/items/key2", `{"value":"value3"}`, nil, &added))
+
+	var page models.GetAllItemsResponse
+	assert.Equal(t, http.StatusOK, do(t, http.MethodGet, server.URL+"/items?limit=1", "", nil, &page))
+	assert.Equal(t, []models.KeyValuePair{{Key: "key1", Value: "value2"}}, page.Items)
+	assert.NotEmpty(t, page.NextCursor)
+
+	assert.Equal(t, http.StatusOK, do(t, http.MethodGet, server.URL+"/items?limit=1&cursor="+page.NextCursor, "", nil, &page))
+	assert.Equal(t, []models.KeyValuePair{{Key: "key2", Value: "value3"}}, page.Items)
+
+	// Test deleting the item
+	var deleted models.DeleteItemResponse
+	assert.Equal(t, http.StatusOK, do(t, http.MethodDelete, server.URL+"/items/key1", "", nil, &deleted))
+	assert.True(t, deleted.Success)
+
+	// Test missing items
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodGet, server.URL+"/items/key1", "", nil, &item))
+	assert.False(t, item.Success)
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodDelete, server.URL+"/items/key1", "", nil, &deleted))
+	assert.False(t, deleted.Success)
+}
+
+func TestGatewayIdempotencyKey(t *testing.T) {
+	server := newTestGateway(t)
+	header := http.Header{IdempotencyKeyHeader: {"put-1"}}
+
+	// Test a retried request gets the response of the first one without executing again
+	var first, retried models.AddItemResponse
+	assert.Equal(t, http.StatusOK, do(t, http.MethodPut, server.URL+"/items/key", `{"value":"value"}`, header, &first))
+	assert.Equal(t, http.StatusOK, do(t, http.MethodPut, server.URL+"/items/key", `{"value":"value"}`, header, &retried))
+	assert.Equal(t, first, retried)
+
+	var item models.GetItemResponse
+	assert.Equal(t, http.StatusOK, do(t, http.MethodGet, server.URL+"/items/key", "", nil, &item))
+	assert.Equal(t, uint64(1), item.Version)
+}
+
+func TestGatewayInvalidRequests(t *testing.T) {
+	server := newTestGateway(t)
+
+	var response errorResponse
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodPut, server.URL+"/items/key", `not json`, nil, &response))
+	assert.False(t, response.Success)
+	assert.Contains(t, response.Message, "invalid body")
+
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodPut, server.URL+"/items/key", `{"value":"v","ttl_ms":-1}`, nil, &response))
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodGet, server.URL+"/items?limit=many", "", nil, &response))
+
+	var page models.GetAllItemsResponse
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodGet, server.URL+"/items?cursor=broken", "", nil, &page))
+	assert.False(t, page.Success)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, http.MethodPost, server.URL+"/items/key", "", nil, nil))
+}
+
+func TestGatewayTimeout(t *testing.T) {
+	// Nobody consumes the requests
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	httpServer := httptest.NewServer(NewGateway(mq.NewInprocClient(server), 10*time.Millisecond))
+	defer httpServer.Close()
+
+	var response errorResponse
+	assert.Equal(t, http.StatusGatewayTimeout, do(t, http.MethodGet, httpServer.URL+"/items/key", "", nil, &response))
+	assert.False(t, response.Success)
+}
@@ -17,12 +17,33 @@ const (
 	GetItem RequestType = "getItem"
 	// GetAll command type
 	GetAll RequestType = "getAllItems"
+	// CasItem command type, compare-and-swap by version
+	CasItem RequestType = "casItem"
+	// AddIfAbsent command type
+	AddIfAbsent RequestType = "addIfAbsent"
+	// Snapshot admin command type
+	Snapshot RequestType = "snapshot"
+	// Transaction command type, executes several commands atomically
+	Transaction RequestType = "transaction"
 )
 
+// IsKnown reports whether the request type is one of the types above
+func (t RequestType) IsKnown() bool {
+	switch t {
+	case AddItem, DeleteItem, GetItem, GetAll, CasItem, AddIfAbsent, Snapshot, Transaction:
+		return true
+	default:
+		return false
+	}
+}
+
 // RequestWrapper encapsulates all commands.
 type RequestWrapper struct {
 	Type    RequestType     `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+	// Idempotency key, a repeated request with the same ID gets the response of the first one.
+	// Ignored for requests of a transaction.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // Request and Response Models
@@ -31,17 +52,20 @@ type RequestWrapper struct {
 type AddItemRequest struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	TTLMs int64  `json:"ttl_ms,omitempty"` // Item expires after this many milliseconds, never if not set
 }
 
 // AddItemResponse represents the response to an AddItemRequest
 type AddItemResponse struct {
 	Success bool   `json:"success"`
+	Version uint64 `json:"version,omitempty"` // New version of the item
 	Message string `json:"message,omitempty"`
 }
 
 // DeleteItemRequest represents the request to delete an item
 type DeleteItemRequest struct {
-	Key string `json:"key"`
+	Key           string `json:"key"`
+	IgnoreMissing bool   `json:"ignore_missing,omitempty"` // A missing key doesn't abort the transaction of the request
 }
 
 // DeleteItemResponse represents the response to a DeleteItemRequest
@@ -52,24 +76,90 @@ type DeleteItemResponse struct {
 
 // GetItemRequest represents the request to get an item
 type GetItemRequest struct {
-	Key string `json:"key"`
+	Key           string `json:"key"`
+	IgnoreMissing bool   `json:"ignore_missing,omitempty"` // A missing key doesn't abort the transaction of the request
 }
 
 // GetItemResponse represents the response to a GetItemRequest
 type GetItemResponse struct {
 	Success bool   `json:"success"`
 	Value   string `json:"value,omitempty"`
+	Version uint64 `json:"version,omitempty"` // Current version of the item, for CasItemRequest
+	Message string `json:"message,omitempty"`
+}
+
+// CasItemRequest represents the request to replace an item only if it has the expected version
+type CasItemRequest struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version uint64 `json:"version"`          // Expected current version of the item
+	TTLMs   int64  `json:"ttl_ms,omitempty"` // Item expires after this many milliseconds, never if not set
+}
+
+// CasItemResponse represents the response to a CasItemRequest
+type CasItemResponse struct {
+	Success bool   `json:"success"`
+	Version uint64 `json:"version,omitempty"` // New version on success, current version on mismatch
+	Message string `json:"message,omitempty"`
+}
+
+// AddIfAbsentRequest represents the request to add an item only if the key doesn't exist
+type AddIfAbsentRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	TTLMs int64  `json:"ttl_ms,omitempty"` // Item expires after this many milliseconds, never if not set
+}
+
+// AddIfAbsentResponse represents the response to an AddIfAbsentRequest
+type AddIfAbsentResponse struct {
+	Success bool   `json:"success"`
+	Version uint64 `json:"version,omitempty"` // New version on success, current version if the key exists
 	Message string `json:"message,omitempty"`
 }
 
-// GetAllItemsRequest represents the request to get all items
-type GetAllItemsRequest struct{}
+// GetAllItemsRequest represents the request to get all items, page by page
+type GetAllItemsRequest struct {
+	Limit  int    `json:"limit,omitempty"`  // Maximum number of items in the page, server default if not set
+	Cursor string `json:"cursor,omitempty"` // Opaque cursor from the previous response, empty for the first page. Invalid after the server restarts
+}
 
 // GetAllItemsResponse represents the response to a GetAllItemsRequest
 type GetAllItemsResponse struct {
-	Items   []KeyValuePair `json:"items"`
-	Success bool           `json:"success"`
-	Message string         `json:"message,omitempty"`
+	Items      []KeyValuePair `json:"items"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Empty if it's the last page
+	Success    bool           `json:"success"`
+	Message    string         `json:"message,omitempty"`
+}
+
+// SnapshotRequest represents the admin request to write a snapshot of the server state
+type SnapshotRequest struct{}
+
+// SnapshotResponse represents the response to a SnapshotRequest
+type SnapshotResponse struct {
+	Success bool   `json:"success"`
+	Items   int    `json:"items,omitempty"` // Number of items captured by the snapshot
+	Message string `json:"message,omitempty"`
+}
+
+// TransactionRequest represents the request to execute several requests with all-or-nothing semantics.
+// Only addItem, deleteItem, getItem, casItem and addIfAbsent requests are allowed.
+type TransactionRequest struct {
+	Requests []RequestWrapper `json:"requests"`
+}
+
+// TransactionResponse represents the response to a TransactionRequest
+type TransactionResponse struct {
+	Success bool `json:"success"`
+	// Responses to the requests in order. If a request fails, nothing is applied
+	// and the results end with the response of the failed request.
+	Results []json.RawMessage `json:"results,omitempty"`
+	Message string            `json:"message,omitempty"`
+}
+
+// ErrorResponse represents the response to a request which failed to execute
+type ErrorResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
 }
 
 // KeyValuePair represents a key-value pair
@@ -78,16 +168,24 @@ type KeyValuePair struct {
 	Value string `json:"value"`
 }
 
-// SerializeRequest serializes a request with a given payload
-func SerializeRequest(requestType RequestType, payload interface{}) (string, error) {
+// NewRequestWrapper wraps a request with a given payload, e.g. to put it into a TransactionRequest
+func NewRequestWrapper(requestType RequestType, payload interface{}) (RequestWrapper, error) {
 	payloadData, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to serialize payload: %w", err)
+		return RequestWrapper{}, fmt.Errorf("failed to serialize payload: %w", err)
 	}
 
-	request := RequestWrapper{
+	return RequestWrapper{
 		Type:    requestType,
 		Payload: payloadData,
+	}, nil
+}
+
+// SerializeRequest serializes a request with a given payload
+func SerializeRequest(requestType RequestType, payload interface{}) (string, error) {
+	request, err := NewRequestWrapper(requestType, payload)
+	if err != nil {
+		return "", err
 	}
 
 	requestData, err := json.Marshal(request)
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,6 +12,7 @@ func TestCommandWrapperSerialization(t *testing.T) {
 		request := AddItemRequest{
 			Key:   "exampleKey",
 			Value: "exampleValue",
+			TTLMs: 1500,
 		}
 
 		raw, err := SerializeRequest(AddItem, request)
@@ -56,13 +58,31 @@ func TestCommandWrapperSerialization(t *testing.T) {
 		assert.Equal(t, request, deserializedRequest)
 	})
 
+	t.Run("Serialize and Deserialize GetAllItemsRequest", func(t *testing.T) {
+		request := GetAllItemsRequest{
+			Limit:  10,
+			Cursor: "exampleCursor",
+		}
+
+		raw, err := SerializeRequest(GetAll, request)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"type":"getAllItems","payload":{"limit":10,"cursor":"exampleCursor"}}`, raw)
+
+		var deserializedRequest GetAllItemsRequest
+		commandType, err := DeserializeRequest(raw, &deserializedRequest)
+		assert.NoError(t, err)
+		assert.Equal(t, GetAll, commandType)
+		assert.Equal(t, request, deserializedRequest)
+	})
+
 	t.Run("Serialize and Deserialize GetAllItemsResponse", func(t *testing.T) {
 		response := GetAllItemsResponse{
 			Items: []KeyValuePair{
 				{Key: "key1", Value: "value1"},
 				{Key: "key2", Value: "value2"},
 			},
-			Success: true,
+			NextCursor: "exampleCursor",
+			Success:    true,
 		}
 
 		raw, err := SerializeResponse(response)
@@ -76,6 +96,106 @@ func TestCommandWrapperSerialization(t *testing.T) {
 	})
 }
 
+func TestConditionalWriteSerialization(t *testing.T) {
+	t.Run("Serialize and Deserialize CasItemRequest", func(t *testing.T) {
+		request := CasItemRequest{
+			Key:     "exampleKey",
+			Value:   "exampleValue",
+			Version: 42,
+		}
+
+		raw, err := SerializeRequest(CasItem, request)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"type":"casItem","payload":{"key":"exampleKey","value":"exampleValue","version":42}}`, raw)
+
+		var deserializedRequest CasItemRequest
+		commandType, err := DeserializeRequest(raw, &deserializedRequest)
+		assert.NoError(t, err)
+		assert.Equal(t, CasItem, commandType)
+		assert.Equal(t, request, deserializedRequest)
+	})
+
+	t.Run("Serialize and Deserialize AddIfAbsentRequest", func(t *testing.T) {
+		request := AddIfAbsentRequest{
+			Key:   "exampleKey",
+			Value: "exampleValue",
+			TTLMs: 100,
+		}
+
+		raw, err := SerializeRequest(AddIfAbsent, request)
+		assert.NoError(t, err)
+
+		var deserializedRequest AddIfAbsentRequest
+		commandType, err := DeserializeRequest(raw, &deserializedRequest)
+		assert.NoError(t, err)
+		assert.Equal(t, AddIfAbsent, commandType)
+		assert.Equal(t, request, deserializedRequest)
+	})
+}
+
+func TestSnapshotSerialization(t *testing.T) {
+	raw, err := SerializeRequest(Snapshot, SnapshotRequest{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"snapshot","payload":{}}`, raw)
+
+	response := SnapshotResponse{
+		Success: true,
+		Items:   42,
+		Message: "snapshot written",
+	}
+
+	raw, err = SerializeResponse(response)
+	assert.NoError(t, err)
+
+	var deserializedResponse SnapshotResponse
+	err = DeserializeResponse(raw, &deserializedResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, response, deserializedResponse)
+}
+
+func TestTransactionSerialization(t *testing.T) {
+	add, err := NewRequestWrapper(AddItem, AddItemRequest{Key: "a", Value: "1"})
+	assert.NoError(t, err)
+	del, err := NewRequestWrapper(DeleteItem, DeleteItemRequest{Key: "b"})
+	assert.NoError(t, err)
+
+	request := TransactionRequest{Requests: []RequestWrapper{add, del}}
+	raw, err := SerializeRequest(Transaction, request)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"transaction","payload":{"requests":[
+		{"type":"addItem","payload":{"key":"a","value":"1"}},
+		{"type":"deleteItem","payload":{"key":"b"}}]}}`, raw)
+
+	var deserializedRequest TransactionRequest
+	commandType, err := DeserializeRequest(raw, &deserializedRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, Transaction, commandType)
+	assert.Equal(t, request, deserializedRequest)
+
+	var deleteRequest DeleteItemRequest
+	assert.NoError(t, json.Unmarshal(deserializedRequest.Requests[1].Payload, &deleteRequest))
+	assert.Equal(t, "b", deleteRequest.Key)
+}
+
+func TestRequestIDSerialization(t *testing.T) {
+	request, err := NewRequestWrapper(DeleteItem, DeleteItemRequest{Key: "a"})
+	assert.NoError(t, err)
+	request.RequestID = "request-1"
+
+	raw, err := json.Marshal(request)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"deleteItem","payload":{"key":"a"},"request_id":"request-1"}`, string(raw))
+
+	wrapper, err := DeserializeCommandWrapper(string(raw))
+	assert.NoError(t, err)
+	assert.Equal(t, request, wrapper)
+
+	// The ID is optional
+	raw, err = json.Marshal(RequestWrapper{Type: DeleteItem, Payload: request.Payload})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "request_id")
+}
+
 func TestInvalidSerialization(t *testing.T) {
 	t.Run("Deserialize Invalid JSON", func(t *testing.T) {
 		raw := `{"type":"addItem","payload":"{invalid_json"}`
@@ -90,5 +210,7 @@ func TestInvalidSerialization(t *testing.T) {
 		commandType, err := DeserializeRequest(raw, &request)
 		assert.NoError(t, err)
 		assert.Equal(t, RequestType("unknownType"), commandType)
+		assert.False(t, commandType.IsKnown())
+		assert.True(t, AddItem.IsKnown())
 	})
 }
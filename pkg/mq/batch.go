@@ -0,0 +1,57 @@
+package mq
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BatchContentType is the content type of messages carrying a batch of requests
+const BatchContentType = "application/x-batch+json"
+
+// EncodeBatch packs several messages into one message body
+func EncodeBatch(messages []string) (string, error) {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode batch: %w", err)
+	}
+	return string(data), nil
+}
+
+// DecodeBatch unpacks a message body packed by EncodeBatch
+func DecodeBatch(data string) ([]string, error) {
+	var messages []string
+	if err := json.Unmarshal([]byte(data), &messages); err != nil {
+		return nil, fmt.Errorf("failed to decode batch: %w", err)
+	}
+	return messages, nil
+}
+
+// batchReply creates reply channels for a batch of count requests, the packed reply is fanned out to them
+func batchReply(count int) ([]<-chan Reply, pendingReply) {
+	replyChans := make([]chan Reply, count)
+	result := make([]<-chan Reply, count)
+	for i := range replyChans {
+		replyChans[i] = make(chan Reply, 1)
+		result[i] = replyChans[i]
+	}
+
+	return result, func(data string, err error) {
+		var replies []string
+		if err == nil {
+			replies, err = DecodeBatch(data)
+			if err == nil && len(replies) != count {
+				err = fmt.Errorf("%w: %d replies for %d requests", ErrInvalidBatchReply, len(replies), count)
+			} else if err != nil {
+				err = fmt.Errorf("%w: %v", ErrInvalidBatchReply, err)
+			}
+		}
+		for i, replyChan := range replyChans {
+			if err != nil {
+				replyChan <- Reply{Err: err}
+			} else {
+				replyChan <- Reply{Data: replies[i]}
+			}
+			close(replyChan)
+		}
+	}
+}
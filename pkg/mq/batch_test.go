@@ -0,0 +1,46 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchEncoding(t *testing.T) {
+	messages := []string{`{"type":"addItem"}`, "", "plain text"}
+	data, err := EncodeBatch(messages)
+	assert.NoError(t, err)
+
+	decoded, err := DecodeBatch(data)
+	assert.NoError(t, err)
+	assert.Equal(t, messages, decoded)
+
+	_, err = DecodeBatch("not a batch")
+	assert.Error(t, err)
+}
+
+func TestBatchReply(t *testing.T) {
+	replyChans, deliver := batchReply(2)
+	reply, err := EncodeBatch([]string{"a", "b"})
+	assert.NoError(t, err)
+	deliver(reply, nil)
+
+	assert.Equal(t, Reply{Data: "a"}, <-replyChans[0])
+	assert.Equal(t, Reply{Data: "b"}, <-replyChans[1])
+
+	// Test a reply which doesn't match the batch fails every request
+	for _, reply := range []string{"invalid", `["a"]`} {
+		replyChans, deliver = batchReply(2)
+		deliver(reply, nil)
+		for _, replyChan := range replyChans {
+			assert.ErrorIs(t, (<-replyChan).Err, ErrInvalidBatchReply)
+			_, ok := <-replyChan
+			assert.False(t, ok)
+		}
+	}
+
+	// Test a request failed without a reply
+	replyChans, deliver = batchReply(1)
+	deliver("", ErrConnectionLost)
+	assert.ErrorIs(t, (<-replyChans[0]).Err, ErrConnectionLost)
+}
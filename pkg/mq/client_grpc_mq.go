@@ -0,0 +1,205 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq/executorpb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+)
+
+// grpcExchangeStream is the client side of the Exchange stream
+type grpcExchangeStream = grpc.BidiStreamingClient[executorpb.ExchangeRequest, executorpb.ExchangeReply]
+
+// ClientGRPC implements ClientMQ for ServerGRPC. Requests and replies are multiplexed over one stream,
+// serialized models are sent as typed commands and replies are serialized back.
+// If the stream breaks, requests in flight fail with ErrConnectionLost and the next request opens a new one,
+// the gRPC connection itself is restored by gRPC.
+type ClientGRPC struct {
+	conn     *grpc.ClientConn
+	executor executorpb.ExecutorClient
+
+	mu           sync.Mutex         // Guards the stream and serializes requests
+	stream       grpcExchangeStream // nil once the stream is broken
+	cancelStream context.CancelFunc
+	closed       bool
+	readers      sync.WaitGroup
+
+	corrMap pendingReplies
+}
+
+// NewClientGRPC creates a client of the ServerGRPC at the target, the options must set the transport credentials
+func NewClientGRPC(target string, opts ...grpc.DialOption) (*ClientGRPC, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	client := &ClientGRPC{conn: conn, executor: executorpb.NewExecutorClient(conn)}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if err := client.openStream(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// Request sends a request message to the server
+func (c *ClientGRPC) Request(data string) (<-chan Reply, error) {
+	return c.RequestContext(context.Background(), data)
+}
+
+// RequestContext sends a request message to the server, waiting for the reply until ctx is done
+func (c *ClientGRPC) RequestContext(ctx context.Context, data string) (<-chan Reply, error) {
+	replyChan, deliver := singleReply()
+	req := &executorpb.ExchangeRequest{Body: &executorpb.ExchangeRequest_Command{Command: commandFromData(data)}}
+	if err := c.send(ctx, req, deliver); err != nil {
+		return nil, err
+	}
+	return replyChan, nil
+}
+
+// RequestBatch sends several requests to the server in one message
+func (c *ClientGRPC) RequestBatch(ctx context.Context, data []string) ([]<-chan Reply, error) {
+	batch := &executorpb.Batch{Commands: make([]*executorpb.Command, len(data))}
+	for i, request := range data {
+		batch.Commands[i] = commandFromData(request)
+	}
+
+	replyChans, deliver := batchReply(len(data))
+	req := &executorpb.ExchangeRequest{Body: &executorpb.ExchangeRequest_Batch{Batch: batch}}
+	if err := c.send(ctx, req, deliver); err != nil {
+		return nil, err
+	}
+	return replyChans, nil
+}
+
+// Close closes the stream and the connection, requests in flight fail with ErrClosed
+func (c *ClientGRPC) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	if c.stream != nil {
+		c.cancelStream()
+	}
+	c.mu.Unlock()
+
+	c.readers.Wait()
+	return c.conn.Close()
+}
+
+func (c *ClientGRPC) send(ctx context.Context, req *executorpb.ExchangeRequest, deliver pendingReply) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if err := c.openStream(); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotConnected, err)
+	}
+
+	req.CorrelationId = uuid.New().String()
+	c.corrMap.add(ctx, req.CorrelationId, deliver)
+
+	if err := c.stream.Send(req); err != nil {
+		c.corrMap.remove(req.CorrelationId)
+		// The reader fails other requests and drops the stream
+		c.cancelStream()
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	return nil
+}
+
+// openStream opens the stream unless it's open, the caller must hold mu
+func (c *ClientGRPC) openStream() error {
+	if c.stream != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.executor.Exchange(ctx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to open stream: %w", err)
+	}
+	c.stream, c.cancelStream = stream, cancel
+
+	c.readers.Add(1)
+	go c.listenForReplies(stream, cancel)
+	return nil
+}
+
+// listenForReplies matches replies to correlation IDs until the stream is closed
+func (c *ClientGRPC) listenForReplies(stream grpcExchangeStream, cancel context.CancelFunc) {
+	defer c.readers.Done()
+
+	for {
+		reply, err := stream.Recv()
+		if err != nil {
+			c.onStreamLost(stream, cancel, err)
+			return
+		}
+		data, err := replyData(reply)
+		if err != nil {
+			c.corrMap.fail(reply.GetCorrelationId(), err)
+		} else {
+			c.corrMap.deliver(reply.GetCorrelationId(), data)
+		}
+	}
+}
+
+// replyData serializes the typed responses of a reply as the executor replied with them, packed if it's a batch
+func replyData(reply *executorpb.ExchangeReply) (string, error) {
+	switch body := reply.GetBody().(type) {
+	case *executorpb.ExchangeReply_Response:
+		data, err := responseData(body.Response)
+		if err != nil {
+			return "", fmt.Errorf("invalid reply: %w", err)
+		}
+		return data, nil
+	case *executorpb.ExchangeReply_Batch:
+		responses := make([]string, 0, len(body.Batch.GetResponses()))
+		for _, response := range body.Batch.GetResponses() {
+			data, err := responseData(response)
+			if err != nil {
+				return "", fmt.Errorf("%w: %v", ErrInvalidBatchReply, err)
+			}
+			responses = append(responses, data)
+		}
+		return EncodeBatch(responses)
+	case *executorpb.ExchangeReply_Error:
+		return "", replyError(body.Error)
+	default:
+		return "", errors.New("invalid reply: no body set")
+	}
+}
+
+// onStreamLost drops the stream and fails requests sent through it.
+// It holds mu, so no request is sent through a new stream meanwhile.
+func (c *ClientGRPC) onStreamLost(stream grpcExchangeStream, cancel context.CancelFunc, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cancel()
+	if c.stream == stream {
+		c.stream, c.cancelStream = nil, nil
+	}
+	if c.closed {
+		c.corrMap.failAll(ErrClosed)
+	} else {
+		c.corrMap.failAll(fmt.Errorf("%w: %v", ErrConnectionLost, err))
+	}
+}
@@ -1,6 +1,8 @@
 package mq
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -9,36 +11,70 @@ import (
 )
 
 // ClientRabbitMQ implements ClientMQ for RabbitMQ.
+// The connection is restored automatically, requests in flight when it's lost fail with ErrConnectionLost.
+// Requests are published in confirm mode as mandatory, so the ones the broker can't route or take
+// fail right away with ErrUnroutable or ErrPublishRejected.
 type ClientRabbitMQ struct {
-	conn       *amqp091.Connection
-	pubChannel *amqp091.Channel
-	subChannel *amqp091.Channel
+	conn       *rabbitConnection
+	routingKey string // which queue to publish requests to
+	options    RabbitMQOptions
 
-	replyQueue string   // ephemeral queue name for this client
-	routingKey string   // which queue to publish requests to
-	corrMap    sync.Map // correlationID -> chan string
+	// Guards the channel and the reply queue, both are replaced on reconnection
+	mu         sync.RWMutex
+	pubChannel *amqp091.Channel // nil while reconnecting
+	replyQueue string           // ephemeral queue name for this client
+
+	corrMap pendingReplies
 }
 
 // NewClientRabbitMQ creates a new RabbitMQ client with an ephemeral reply queue.
 // routingKey is the queue where requests are sent (the "server" queue).
 func NewClientRabbitMQ(url, routingKey string) (*ClientRabbitMQ, error) {
-	conn, err := amqp091.Dial(url)
+	return NewClientRabbitMQWithOptions(url, routingKey, RabbitMQOptions{})
+}
+
+// NewClientRabbitMQWithOptions creates a new RabbitMQ client publishing requests as the options of the server queue say.
+func NewClientRabbitMQWithOptions(url, routingKey string, options RabbitMQOptions) (*ClientRabbitMQ, error) {
+	return newClientRabbitMQ(url, routingKey, options, defaultRabbitConfig())
+}
+
+func newClientRabbitMQ(url, routingKey string, options RabbitMQOptions, config amqp091.Config) (*ClientRabbitMQ, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	client := &ClientRabbitMQ{
+		routingKey: routingKey,
+		options:    options,
+	}
+
+	conn, err := dialRabbitMQ(url, config, client.setup, client.onConnectionLost)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		return nil, err
 	}
+	client.conn = conn
+	return client, nil
+}
 
+// setup opens the channels and subscribes to a new reply queue, it runs on every (re)connection
+func (c *ClientRabbitMQ) setup(conn *amqp091.Connection) ([]*amqp091.Channel, error) {
 	// Channel #1 for publishing requests
 	pubCh, err := conn.Channel()
 	if err != nil {
-		conn.Close()
 		return nil, fmt.Errorf("failed to create publish channel: %w", err)
 	}
 
+	// Confirms let publish fail requests the broker refused to take
+	if err := pubCh.Confirm(false); err != nil {
+		pubCh.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	returns := pubCh.NotifyReturn(make(chan amqp091.Return, 1))
+
 	// Channel #2 for consuming replies
 	subCh, err := conn.Channel()
 	if err != nil {
 		pubCh.Close()
-		conn.Close()
 		return nil, fmt.Errorf("failed to create subscribe channel: %w", err)
 	}
 
@@ -54,29 +90,11 @@ func NewClientRabbitMQ(url, routingKey string) (*ClientRabbitMQ, error) {
 	if err != nil {
 		subCh.Close()
 		pubCh.Close()
-		conn.Close()
 		return nil, fmt.Errorf("failed to declare reply queue: %w", err)
 	}
 
-	client := &ClientRabbitMQ{
-		conn:       conn,
-		pubChannel: pubCh,
-		subChannel: subCh,
-		replyQueue: q.Name,
-		routingKey: routingKey,
-		corrMap:    sync.Map{},
-	}
-
-	// Start listening for replies in a separate goroutine
-	go client.listenForReplies()
-
-	return client, nil
-}
-
-// listenForReplies consumes from the ephemeral reply queue and matches messages to correlation IDs.
-func (c *ClientRabbitMQ) listenForReplies() {
-	deliveries, err := c.subChannel.Consume(
-		c.replyQueue,
+	deliveries, err := subCh.Consume(
+		q.Name,
 		"",    // consumer tag
 		true,  // auto-ack
 		true,  // exclusive
@@ -85,61 +103,136 @@ func (c *ClientRabbitMQ) listenForReplies() {
 		nil,
 	)
 	if err != nil {
-		fmt.Printf("Error starting reply consumer: %v\n", err)
-		return
+		subCh.Close()
+		pubCh.Close()
+		return nil, fmt.Errorf("failed to start reply consumer: %w", err)
 	}
 
+	c.mu.Lock()
+	c.pubChannel = pubCh
+	c.replyQueue = q.Name
+	c.mu.Unlock()
+
+	// Start listening for replies and returned requests in separate goroutines
+	go c.listenForReplies(deliveries)
+	go c.listenForReturns(returns)
+
+	return []*amqp091.Channel{pubCh, subCh}, nil
+}
+
+// onConnectionLost fails requests in flight, their replies are gone with the exclusive reply queue
+func (c *ClientRabbitMQ) onConnectionLost(err error) {
+	c.mu.Lock()
+	c.pubChannel = nil
+	c.replyQueue = ""
+	c.mu.Unlock()
+
+	c.corrMap.failAll(fmt.Errorf("%w: %v", ErrConnectionLost, err))
+}
+
+// listenForReplies matches messages from the reply queue to correlation IDs until the channel is closed.
+func (c *ClientRabbitMQ) listenForReplies(deliveries <-chan amqp091.Delivery) {
 	for d := range deliveries {
-		corrID := d.CorrelationId
-		if ch, ok := c.corrMap.Load(corrID); ok {
-			responseChan := ch.(chan string)
-			responseChan <- string(d.Body)
-			close(responseChan)
-			c.corrMap.Delete(corrID)
-		}
+		c.corrMap.deliver(d.CorrelationId, string(d.Body))
+	}
+}
+
+// listenForReturns fails requests the broker couldn't route until the channel is closed.
+func (c *ClientRabbitMQ) listenForReturns(returns <-chan amqp091.Return) {
+	for r := range returns {
+		c.corrMap.fail(r.CorrelationId, fmt.Errorf("%w: %s", ErrUnroutable, r.ReplyText))
+	}
+}
+
+// awaitConfirm fails the request if the broker nacks it
+func (c *ClientRabbitMQ) awaitConfirm(ctx context.Context, ch *amqp091.Channel, corrID string, confirm *amqp091.DeferredConfirmation) {
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil || acked {
+		return
+	}
+
+	// Pending confirms are nacked when the channel is closed
+	if ch.IsClosed() {
+		c.corrMap.fail(corrID, ErrConnectionLost)
+	} else {
+		c.corrMap.fail(corrID, ErrPublishRejected)
 	}
 }
 
 // Request sends `data` to the server queue (routingKey) and returns a channel for the reply.
-func (c *ClientRabbitMQ) Request(data string) (<-chan string, error) {
+func (c *ClientRabbitMQ) Request(data string) (<-chan Reply, error) {
+	return c.RequestContext(context.Background(), data)
+}
+
+// RequestContext is Request which stops waiting for the reply when ctx is done.
+func (c *ClientRabbitMQ) RequestContext(ctx context.Context, data string) (<-chan Reply, error) {
+	replyChan, deliver := singleReply()
+	if err := c.publish(ctx, data, "text/plain", deliver); err != nil {
+		return nil, err
+	}
+	return replyChan, nil
+}
+
+// RequestBatch sends several requests to the server queue in one message and returns a channel per request.
+func (c *ClientRabbitMQ) RequestBatch(ctx context.Context, data []string) ([]<-chan Reply, error) {
+	batch, err := EncodeBatch(data)
+	if err != nil {
+		return nil, err
+	}
+
+	replyChans, deliver := batchReply(len(data))
+	if err := c.publish(ctx, batch, BatchContentType, deliver); err != nil {
+		return nil, err
+	}
+	return replyChans, nil
+}
+
+// publish sends a message to the server queue, the reply will be passed to deliver
+func (c *ClientRabbitMQ) publish(ctx context.Context, data, contentType string, deliver pendingReply) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.pubChannel == nil {
+		return ErrNotConnected
+	}
 	corrID := uuid.New().String()
-	replyChan := make(chan string, 1)
 
-	// Store the channel so listenForReplies can deliver the response
-	c.corrMap.Store(corrID, replyChan)
+	// Store the callback so listenForReplies can deliver the response
+	c.corrMap.add(ctx, corrID, deliver)
 
 	// Publish the request to the server's queue
-	err := c.pubChannel.Publish(
+	confirm, err := c.pubChannel.PublishWithDeferredConfirmWithContext(
+		ctx,
 		"",           // exchange (empty => default)
 		c.routingKey, // routing key (the queue name)
-		false,        // mandatory
+		true,         // mandatory
 		false,        // immediate
 		amqp091.Publishing{
-			ContentType:   "text/plain",
+			ContentType:   contentType,
 			Body:          []byte(data),
 			CorrelationId: corrID,
 			ReplyTo:       c.replyQueue,
+			DeliveryMode:  c.options.deliveryMode(),
 		},
 	)
 	if err != nil {
-		c.corrMap.Delete(corrID)
-		return nil, fmt.Errorf("failed to publish message: %w", err)
+		c.corrMap.remove(corrID)
+		// The channel is closed before onConnectionLost clears it
+		if errors.Is(err, amqp091.ErrClosed) {
+			return ErrNotConnected
+		}
+		return fmt.Errorf("failed to publish message: %w", err)
 	}
 
-	return replyChan, nil
+	go c.awaitConfirm(ctx, c.pubChannel, corrID, confirm)
+	return nil
 }
 
 // Close closes channels and connection.
 func (c *ClientRabbitMQ) Close() error {
-	var firstErr error
-	if err := c.pubChannel.Close(); err != nil {
-		firstErr = err
-	}
-	if err := c.subChannel.Close(); err != nil && firstErr == nil {
-		firstErr = err
-	}
-	if err := c.conn.Close(); err != nil && firstErr == nil {
-		firstErr = err
-	}
-	return firstErr
+	return c.conn.Close()
 }
@@ -0,0 +1,94 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/amqpfake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRabbitMQPublisherConfirms(t *testing.T) {
+	broker, err := amqpfake.NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start fake broker: %v", err)
+	}
+	defer broker.Close()
+
+	server, err := NewServerRabbitMQ(broker.URL(), "test-confirms")
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+	}
+	defer server.Close()
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+
+	go func() {
+		for req := range reqCh {
+			_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+			_ = req.Ack()
+		}
+	}()
+
+	newClient := func(routingKey string) *ClientRabbitMQ {
+		client, err := NewClientRabbitMQ(broker.URL(), routingKey)
+		if err != nil {
+			t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+		}
+		return client
+	}
+
+	// awaitReply waits much less than the request timeout, failures must not wait for the deadline
+	awaitReply := func(replyChan <-chan Reply) Reply {
+		select {
+		case reply := <-replyChan:
+			return reply
+		case <-time.After(time.Second):
+			t.Error("Timed out waiting for reply")
+			return Reply{}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client := newClient("test-confirms")
+	defer client.Close()
+
+	// Test a confirmed request gets its reply
+	replyChan, err := client.RequestContext(ctx, "Message")
+	assert.NoError(t, err)
+	assert.Equal(t, Reply{Data: "Reply: Message"}, awaitReply(replyChan))
+
+	// Test a request to a missing queue is returned by the broker
+	lostClient := newClient("missing-queue")
+	defer lostClient.Close()
+
+	replyChan, err = lostClient.RequestContext(ctx, "Message")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, awaitReply(replyChan).Err, ErrUnroutable)
+
+	replyChans, err := lostClient.RequestBatch(ctx, []string{"First", "Second"})
+	assert.NoError(t, err)
+	for _, replyChan := range replyChans {
+		assert.ErrorIs(t, awaitReply(replyChan).Err, ErrUnroutable)
+	}
+	assert.Equal(t, 0, lostClient.corrMap.len())
+
+	// Test requests nacked by the broker fail
+	broker.RejectPublishes(true)
+
+	replyChan, err = client.RequestContext(ctx, "Message")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, awaitReply(replyChan).Err, ErrPublishRejected)
+	assert.Equal(t, 0, client.corrMap.len())
+
+	// Test the client keeps working once the broker takes requests again
+	broker.RejectPublishes(false)
+
+	replyChan, err = client.RequestContext(ctx, "Message")
+	assert.NoError(t, err)
+	assert.Equal(t, Reply{Data: "Reply: Message"}, awaitReply(replyChan))
+}
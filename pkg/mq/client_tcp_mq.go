@@ -0,0 +1,194 @@
+package mq
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// tcpDialTimeout bounds connecting to ServerTCP
+const tcpDialTimeout = 5 * time.Second
+
+// ClientTCP implements ClientMQ for ServerTCP. Requests and replies are multiplexed over one connection.
+// If the connection is lost, requests in flight fail with ErrConnectionLost and the next request reconnects.
+type ClientTCP struct {
+	addr string
+
+	mu      sync.Mutex // Guards the connection and serializes requests
+	conn    net.Conn   // nil once the connection is lost
+	closed  bool
+	readers sync.WaitGroup
+
+	corrMap pendingReplies
+}
+
+// NewClientTCP creates a client connected to the ServerTCP at the address
+func NewClientTCP(addr string) (*ClientTCP, error) {
+	client := &ClientTCP{addr: addr}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if err := client.connect(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Request sends a request message to the server
+func (c *ClientTCP) Request(data string) (<-chan Reply, error) {
+	return c.RequestContext(context.Background(), data)
+}
+
+// RequestContext sends a request message to the server, waiting for the reply until ctx is done
+func (c *ClientTCP) RequestContext(ctx context.Context, data string) (<-chan Reply, error) {
+	replyChan, deliver := singleReply()
+	if err := c.send(ctx, tcpFrameRequest, data, deliver); err != nil {
+		return nil, err
+	}
+	return replyChan, nil
+}
+
+// RequestBatch sends several requests to the server in one message
+func (c *ClientTCP) RequestBatch(ctx context.Context, data []string) ([]<-chan Reply, error) {
+	batch, err := EncodeBatch(data)
+	if err != nil {
+		return nil, err
+	}
+
+	replyChans, deliver := batchReply(len(data))
+	if err := c.send(ctx, tcpFrameBatchRequest, batch, deliver); err != nil {
+		return nil, err
+	}
+	return replyChans, nil
+}
+
+// Close closes the connection, requests in flight fail with ErrClosed
+func (c *ClientTCP) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	var err error
+	if c.conn != nil {
+		err = c.conn.Close()
+	}
+	c.mu.Unlock()
+
+	c.readers.Wait()
+	return err
+}
+
+func (c *ClientTCP) send(ctx context.Context, kind byte, data string, deliver pendingReply) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	corrID := uuid.New().String()
+	buf, err := tcpFrame{kind: kind, corrID: corrID, data: data}.encode()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	// The deadline may pass while other requests are sent
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotConnected, err)
+	}
+
+	c.corrMap.add(ctx, corrID, deliver)
+
+	deadline, _ := ctx.Deadline()
+	c.conn.SetWriteDeadline(deadline)
+	if n, err := c.conn.Write(buf); err != nil {
+		c.corrMap.remove(corrID)
+		if n > 0 {
+			// A partly written frame breaks the stream
+			c.dropConnection(fmt.Errorf("%w: %v", ErrConnectionLost, err))
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// The write deadline is the deadline of the context
+			err = context.DeadlineExceeded
+		}
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	return nil
+}
+
+// dropConnection closes the connection and fails requests sent through it, the caller must hold mu
+func (c *ClientTCP) dropConnection(err error) {
+	c.conn.Close()
+	c.conn = nil
+	c.corrMap.failAll(err)
+}
+
+// connect dials the server unless connected, the caller must hold mu
+func (c *ClientTCP) connect() error {
+	if c.conn != nil {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", c.addr, tcpDialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", c.addr, err)
+	}
+	c.conn = conn
+
+	c.readers.Add(1)
+	go c.listenForReplies(conn)
+	return nil
+}
+
+// listenForReplies matches replies to correlation IDs until the connection is closed
+func (c *ClientTCP) listenForReplies(conn net.Conn) {
+	defer c.readers.Done()
+
+	r := bufio.NewReader(conn)
+	for {
+		f, err := readTCPFrame(r)
+		if err != nil {
+			c.onConnectionLost(conn, err)
+			return
+		}
+		switch f.kind {
+		case tcpFrameReply:
+			c.corrMap.deliver(f.corrID, f.data)
+		case tcpFrameError:
+			c.corrMap.fail(f.corrID, replyError(f.data))
+		}
+	}
+}
+
+// onConnectionLost drops the connection and fails requests sent through it.
+// It holds mu, so no request is sent through a new connection meanwhile.
+func (c *ClientTCP) onConnectionLost(conn net.Conn, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != conn {
+		// Already dropped by a failed write, requests sent since use another connection
+		return
+	}
+	if c.closed {
+		c.dropConnection(ErrClosed)
+	} else {
+		c.dropConnection(fmt.Errorf("%w: %v", ErrConnectionLost, err))
+	}
+}
@@ -0,0 +1,34 @@
+package mq
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeadLetterNotFound is returned when there is no dead letter with the given correlation ID
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetterRejected is the reason of requests rejected by Nack without requeue
+const DeadLetterRejected = "rejected"
+
+// DeadLetter is a request which can't be executed, it's kept aside for inspection and replay
+type DeadLetter struct {
+	Data          string    `json:"data"`
+	CorrelationID string    `json:"correlation_id"`
+	ReplyTo       string    `json:"reply_to,omitempty"`
+	Batch         bool      `json:"batch,omitempty"`
+	Reason        string    `json:"reason"`
+	Time          time.Time `json:"time"`
+}
+
+// newDeadLetter captures the request with the reason why it's dead-lettered
+func newDeadLetter(req Request, reason string) DeadLetter {
+	return DeadLetter{
+		Data:          req.Data,
+		CorrelationID: req.CorrelationID,
+		ReplyTo:       req.ReplyTo,
+		Batch:         req.Batch,
+		Reason:        reason,
+		Time:          time.Now(),
+	}
+}
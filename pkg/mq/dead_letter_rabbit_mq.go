@@ -0,0 +1,211 @@
+package mq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// deadLetterReasonHeader keeps the reason of requests dead-lettered by the server.
+// Requests dead-lettered by the broker have the reason in the x-death header instead.
+const deadLetterReasonHeader = "x-dead-letter-reason"
+
+// DeadLetterQueueName returns the name of the dead-letter queue of a server queue
+func DeadLetterQueueName(routingKey string) string {
+	return routingKey + ".dlq"
+}
+
+// deadLetterExchangeName returns the name of the exchange routing dead letters of a server queue
+func deadLetterExchangeName(routingKey string) string {
+	return routingKey + ".dlx"
+}
+
+// declareDeadLetterQueue declares the dead-letter exchange of the server queue and the queue bound to it,
+// they are durable if the server queue is
+func declareDeadLetterQueue(ch *amqp091.Channel, routingKey string, durable bool) error {
+	exchange, queue := deadLetterExchangeName(routingKey), DeadLetterQueueName(routingKey)
+
+	err := ch.ExchangeDeclare(
+		exchange,
+		"direct",
+		durable,
+		false, // auto-delete
+		false, // internal
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %w", err)
+	}
+
+	_, err = ch.QueueDeclare(
+		queue,
+		durable,
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+
+	// The broker dead-letters requests with their original routing key
+	if err := ch.QueueBind(queue, routingKey, exchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue: %w", err)
+	}
+	return nil
+}
+
+// deadLetterPublishing is the message of a request dead-lettered by the server
+func deadLetterPublishing(req Request, reason string) amqp091.Publishing {
+	contentType := "text/plain"
+	if req.Batch {
+		contentType = BatchContentType
+	}
+	return amqp091.Publishing{
+		ContentType:   contentType,
+		Body:          []byte(req.Data),
+		CorrelationId: req.CorrelationID,
+		ReplyTo:       req.ReplyTo,
+		Timestamp:     time.Now(),
+		Headers:       amqp091.Table{deadLetterReasonHeader: reason},
+	}
+}
+
+// deadLetterFromDelivery decodes a message of the dead-letter queue
+func deadLetterFromDelivery(d amqp091.Delivery) DeadLetter {
+	letter := DeadLetter{
+		Data:          string(d.Body),
+		CorrelationID: d.CorrelationId,
+		ReplyTo:       d.ReplyTo,
+		Batch:         d.ContentType == BatchContentType,
+		Time:          d.Timestamp,
+	}
+
+	if reason, ok := d.Headers[deadLetterReasonHeader].(string); ok {
+		letter.Reason = reason
+		return letter
+	}
+	// The first x-death record is the latest one
+	if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp091.Table); ok {
+			letter.Reason, _ = death["reason"].(string)
+			if deathTime, ok := death["time"].(time.Time); ok {
+				letter.Time = deathTime
+			}
+		}
+	}
+	return letter
+}
+
+// DeadLetterQueueRabbitMQ browses the dead-letter queue of a RabbitMQ server queue
+type DeadLetterQueueRabbitMQ struct {
+	conn    *amqp091.Connection
+	channel *amqp091.Channel
+	queue   string
+}
+
+// NewDeadLetterQueueRabbitMQ connects to the dead-letter queue of the server queue (routingKey)
+func NewDeadLetterQueueRabbitMQ(url, routingKey string) (*DeadLetterQueueRabbitMQ, error) {
+	return NewDeadLetterQueueRabbitMQWithOptions(url, routingKey, RabbitMQOptions{})
+}
+
+// NewDeadLetterQueueRabbitMQWithOptions connects to the dead-letter queue of the server queue declared with the options
+func NewDeadLetterQueueRabbitMQWithOptions(url, routingKey string, options RabbitMQOptions) (*DeadLetterQueueRabbitMQ, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	conn, err := amqp091.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create channel: %w", err)
+	}
+
+	if err := declareDeadLetterQueue(ch, routingKey, options.Durable); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &DeadLetterQueueRabbitMQ{
+		conn:    conn,
+		channel: ch,
+		queue:   DeadLetterQueueName(routingKey),
+	}, nil
+}
+
+// List returns all dead letters, oldest first, leaving them in the queue
+func (q *DeadLetterQueueRabbitMQ) List() ([]DeadLetter, error) {
+	deliveries, err := q.fetchAll()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, len(deliveries))
+	for i, d := range deliveries {
+		letters[i] = deadLetterFromDelivery(d)
+	}
+	return letters, q.settle(deliveries, "")
+}
+
+// Remove takes the dead letter with the correlation ID out of the queue
+func (q *DeadLetterQueueRabbitMQ) Remove(corrID string) (DeadLetter, error) {
+	deliveries, err := q.fetchAll()
+	if err != nil {
+		return DeadLetter{}, err
+	}
+
+	for _, d := range deliveries {
+		if d.CorrelationId == corrID {
+			return deadLetterFromDelivery(d), q.settle(deliveries, corrID)
+		}
+	}
+	if err := q.settle(deliveries, ""); err != nil {
+		return DeadLetter{}, err
+	}
+	return DeadLetter{}, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, corrID)
+}
+
+// fetchAll gets all messages of the queue without acknowledging them
+func (q *DeadLetterQueueRabbitMQ) fetchAll() ([]amqp091.Delivery, error) {
+	var deliveries []amqp091.Delivery
+	for {
+		d, ok, err := q.channel.Get(q.queue, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dead letter: %w", err)
+		}
+		if !ok {
+			return deliveries, nil
+		}
+		deliveries = append(deliveries, d)
+	}
+}
+
+// settle acknowledges the first delivery with the correlation ID, if any, and puts the others back
+func (q *DeadLetterQueueRabbitMQ) settle(deliveries []amqp091.Delivery, removeCorrID string) error {
+	for _, d := range deliveries {
+		var err error
+		if removeCorrID != "" && d.CorrelationId == removeCorrID {
+			err = d.Ack(false)
+			removeCorrID = ""
+		} else {
+			err = d.Nack(false, true)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to settle dead letter: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the channel and connection
+func (q *DeadLetterQueueRabbitMQ) Close() error {
+	return q.conn.Close()
+}
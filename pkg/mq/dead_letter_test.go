@@ -0,0 +1,174 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterFromDelivery(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	// Test a request dead-lettered by the server
+	req := Request{Data: "poison", CorrelationID: "1", ReplyTo: "replies", Batch: true}
+	publishing := deadLetterPublishing(req, "invalid command")
+	letter := deadLetterFromDelivery(amqp091.Delivery{
+		Headers:       publishing.Headers,
+		ContentType:   publishing.ContentType,
+		CorrelationId: publishing.CorrelationId,
+		ReplyTo:       publishing.ReplyTo,
+		Timestamp:     now,
+		Body:          publishing.Body,
+	})
+	assert.Equal(t, DeadLetter{
+		Data:          "poison",
+		CorrelationID: "1",
+		ReplyTo:       "replies",
+		Batch:         true,
+		Reason:        "invalid command",
+		Time:          now,
+	}, letter)
+
+	// Test a request dead-lettered by the broker
+	letter = deadLetterFromDelivery(amqp091.Delivery{
+		Headers: amqp091.Table{"x-death": []interface{}{
+			amqp091.Table{"reason": "rejected", "time": now},
+			amqp091.Table{"reason": "expired"},
+		}},
+		CorrelationId: "2",
+		Body:          []byte("rejected"),
+	})
+	assert.Equal(t, DeadLetter{Data: "rejected", CorrelationID: "2", Reason: DeadLetterRejected, Time: now}, letter)
+}
+
+func TestInprocMQDeadLetters(t *testing.T) {
+	server := NewInprocServer()
+	defer server.Close()
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+
+	go func() {
+		for req := range reqCh {
+			switch req.Data {
+			case "poison":
+				assert.NoError(t, server.DeadLetter(req, "invalid command"))
+				_ = server.Reply(req.CorrelationID, "invalid command")
+				_ = req.Ack()
+			case "reject":
+				assert.NoError(t, req.Nack(false))
+			}
+		}
+	}()
+
+	client := NewInprocClient(server)
+	defer client.Close()
+
+	// Test a dead-lettered request is still replied to
+	replyChan, err := client.Request("poison")
+	assert.NoError(t, err)
+	assert.Equal(t, Reply{Data: "invalid command"}, <-replyChan)
+
+	letter := <-server.DeadLetters()
+	assert.Equal(t, "poison", letter.Data)
+	assert.Equal(t, "invalid command", letter.Reason)
+	assert.NotEmpty(t, letter.CorrelationID)
+	assert.WithinDuration(t, time.Now(), letter.Time, time.Second)
+
+	// Test a request rejected without requeue is dead-lettered
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	replyChan, err = client.RequestContext(ctx, "reject")
+	assert.NoError(t, err)
+
+	letter = <-server.DeadLetters()
+	assert.Equal(t, "reject", letter.Data)
+	assert.Equal(t, DeadLetterRejected, letter.Reason)
+	assert.ErrorIs(t, (<-replyChan).Err, context.DeadlineExceeded)
+}
+
+func TestRabbitMQDeadLetters(t *testing.T) {
+	const queue = "test-dead-letters"
+	url := testRabbitMQURL(t)
+
+	server, err := NewServerRabbitMQ(url, queue)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+	}
+	defer server.Close()
+
+	dlq, err := NewDeadLetterQueueRabbitMQ(url, queue)
+	if err != nil {
+		t.Fatalf("Failed to open dead-letter queue: %v", err)
+	}
+	defer dlq.Close()
+
+	// Start with an empty dead-letter queue
+	letters, err := dlq.List()
+	assert.NoError(t, err)
+	for _, letter := range letters {
+		_, err := dlq.Remove(letter.CorrelationID)
+		assert.NoError(t, err)
+	}
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+
+	go func() {
+		for req := range reqCh {
+			switch req.Data {
+			case "poison":
+				assert.NoError(t, server.DeadLetter(req, "invalid command"))
+				_ = server.Reply(req.CorrelationID, "invalid command")
+				_ = req.Ack()
+			case "reject":
+				assert.NoError(t, req.Nack(false))
+			}
+		}
+	}()
+
+	client, err := NewClientRabbitMQ(url, queue)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+	}
+	defer client.Close()
+
+	replyChan, err := client.Request("poison")
+	assert.NoError(t, err)
+	assert.Equal(t, Reply{Data: "invalid command"}, <-replyChan)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	replyChan, err = client.RequestContext(ctx, "reject")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, (<-replyChan).Err, context.DeadlineExceeded)
+
+	// Test both requests are in the dead-letter queue with their reasons
+	letters, err = dlq.List()
+	assert.NoError(t, err)
+	if !assert.Len(t, letters, 2) {
+		return
+	}
+	reasons := make(map[string]string)
+	for _, letter := range letters {
+		reasons[letter.Data] = letter.Reason
+	}
+	assert.Equal(t, map[string]string{"poison": "invalid command", "reject": DeadLetterRejected}, reasons)
+
+	// Test listing leaves dead letters in the queue and removing takes them out
+	for _, letter := range letters {
+		removed, err := dlq.Remove(letter.CorrelationID)
+		assert.NoError(t, err)
+		assert.Equal(t, letter.Data, removed.Data)
+	}
+	_, err = dlq.Remove(letters[0].CorrelationID)
+	assert.ErrorIs(t, err, ErrDeadLetterNotFound)
+
+	letters, err = dlq.List()
+	assert.NoError(t, err)
+	assert.Empty(t, letters)
+}
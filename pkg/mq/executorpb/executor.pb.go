@@ -0,0 +1,1905 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: executor.proto
+
+package executorpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ExchangeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CorrelationId string                 `protobuf:"bytes,1,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	// Types that are valid to be assigned to Body:
+	//
+	//	*ExchangeRequest_Command
+	//	*ExchangeRequest_Batch
+	Body          isExchangeRequest_Body `protobuf_oneof:"body"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExchangeRequest) Reset() {
+	*x = ExchangeRequest{}
+	mi := &file_executor_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExchangeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExchangeRequest) ProtoMessage() {}
+
+func (x *ExchangeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExchangeRequest.ProtoReflect.Descriptor instead.
+func (*ExchangeRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ExchangeRequest) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *ExchangeRequest) GetBody() isExchangeRequest_Body {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *ExchangeRequest) GetCommand() *Command {
+	if x != nil {
+		if x, ok := x.Body.(*ExchangeRequest_Command); ok {
+			return x.Command
+		}
+	}
+	return nil
+}
+
+func (x *ExchangeRequest) GetBatch() *Batch {
+	if x != nil {
+		if x, ok := x.Body.(*ExchangeRequest_Batch); ok {
+			return x.Batch
+		}
+	}
+	return nil
+}
+
+type isExchangeRequest_Body interface {
+	isExchangeRequest_Body()
+}
+
+type ExchangeRequest_Command struct {
+	Command *Command `protobuf:"bytes,2,opt,name=command,proto3,oneof"`
+}
+
+type ExchangeRequest_Batch struct {
+	Batch *Batch `protobuf:"bytes,3,opt,name=batch,proto3,oneof"` // Commands executed in order and answered in one reply
+}
+
+func (*ExchangeRequest_Command) isExchangeRequest_Body() {}
+
+func (*ExchangeRequest_Batch) isExchangeRequest_Body() {}
+
+type ExchangeReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CorrelationId string                 `protobuf:"bytes,1,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	// Types that are valid to be assigned to Body:
+	//
+	//	*ExchangeReply_Response
+	//	*ExchangeReply_Batch
+	//	*ExchangeReply_Error
+	Body          isExchangeReply_Body `protobuf_oneof:"body"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExchangeReply) Reset() {
+	*x = ExchangeReply{}
+	mi := &file_executor_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExchangeReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExchangeReply) ProtoMessage() {}
+
+func (x *ExchangeReply) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExchangeReply.ProtoReflect.Descriptor instead.
+func (*ExchangeReply) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ExchangeReply) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *ExchangeReply) GetBody() isExchangeReply_Body {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *ExchangeReply) GetResponse() *Response {
+	if x != nil {
+		if x, ok := x.Body.(*ExchangeReply_Response); ok {
+			return x.Response
+		}
+	}
+	return nil
+}
+
+func (x *ExchangeReply) GetBatch() *BatchResponse {
+	if x != nil {
+		if x, ok := x.Body.(*ExchangeReply_Batch); ok {
+			return x.Batch
+		}
+	}
+	return nil
+}
+
+func (x *ExchangeReply) GetError() string {
+	if x != nil {
+		if x, ok := x.Body.(*ExchangeReply_Error); ok {
+			return x.Error
+		}
+	}
+	return ""
+}
+
+type isExchangeReply_Body interface {
+	isExchangeReply_Body()
+}
+
+type ExchangeReply_Response struct {
+	Response *Response `protobuf:"bytes,2,opt,name=response,proto3,oneof"`
+}
+
+type ExchangeReply_Batch struct {
+	Batch *BatchResponse `protobuf:"bytes,3,opt,name=batch,proto3,oneof"`
+}
+
+type ExchangeReply_Error struct {
+	Error string `protobuf:"bytes,4,opt,name=error,proto3,oneof"` // The request failed without a response, e.g. it was sent after the server stopped taking requests
+}
+
+func (*ExchangeReply_Response) isExchangeReply_Body() {}
+
+func (*ExchangeReply_Batch) isExchangeReply_Body() {}
+
+func (*ExchangeReply_Error) isExchangeReply_Body() {}
+
+type Batch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Commands      []*Command             `protobuf:"bytes,1,rep,name=commands,proto3" json:"commands,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Batch) Reset() {
+	*x = Batch{}
+	mi := &file_executor_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Batch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Batch) ProtoMessage() {}
+
+func (x *Batch) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Batch.ProtoReflect.Descriptor instead.
+func (*Batch) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Batch) GetCommands() []*Command {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+type BatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Responses     []*Response            `protobuf:"bytes,1,rep,name=responses,proto3" json:"responses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	mi := &file_executor_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchResponse) GetResponses() []*Response {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+// Command is one of the commands of models.RequestType
+type Command struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	RequestId string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"` // Idempotency key, a repeated command with the same ID gets the response of the first one
+	// Types that are valid to be assigned to Command:
+	//
+	//	*Command_AddItem
+	//	*Command_DeleteItem
+	//	*Command_GetItem
+	//	*Command_GetAllItems
+	//	*Command_CasItem
+	//	*Command_AddIfAbsent
+	//	*Command_Snapshot
+	//	*Command_Transaction
+	//	*Command_Raw
+	Command       isCommand_Command `protobuf_oneof:"command"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Command) Reset() {
+	*x = Command{}
+	mi := &file_executor_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Command) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Command) ProtoMessage() {}
+
+func (x *Command) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Command.ProtoReflect.Descriptor instead.
+func (*Command) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Command) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *Command) GetCommand() isCommand_Command {
+	if x != nil {
+		return x.Command
+	}
+	return nil
+}
+
+func (x *Command) GetAddItem() *AddItemRequest {
+	if x != nil {
+		if x, ok := x.Command.(*Command_AddItem); ok {
+			return x.AddItem
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetDeleteItem() *DeleteItemRequest {
+	if x != nil {
+		if x, ok := x.Command.(*Command_DeleteItem); ok {
+			return x.DeleteItem
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetGetItem() *GetItemRequest {
+	if x != nil {
+		if x, ok := x.Command.(*Command_GetItem); ok {
+			return x.GetItem
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetGetAllItems() *GetAllItemsRequest {
+	if x != nil {
+		if x, ok := x.Command.(*Command_GetAllItems); ok {
+			return x.GetAllItems
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetCasItem() *CasItemRequest {
+	if x != nil {
+		if x, ok := x.Command.(*Command_CasItem); ok {
+			return x.CasItem
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetAddIfAbsent() *AddIfAbsentRequest {
+	if x != nil {
+		if x, ok := x.Command.(*Command_AddIfAbsent); ok {
+			return x.AddIfAbsent
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetSnapshot() *SnapshotRequest {
+	if x != nil {
+		if x, ok := x.Command.(*Command_Snapshot); ok {
+			return x.Snapshot
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetTransaction() *TransactionRequest {
+	if x != nil {
+		if x, ok := x.Command.(*Command_Transaction); ok {
+			return x.Transaction
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetRaw() string {
+	if x != nil {
+		if x, ok := x.Command.(*Command_Raw); ok {
+			return x.Raw
+		}
+	}
+	return ""
+}
+
+type isCommand_Command interface {
+	isCommand_Command()
+}
+
+type Command_AddItem struct {
+	AddItem *AddItemRequest `protobuf:"bytes,2,opt,name=add_item,json=addItem,proto3,oneof"`
+}
+
+type Command_DeleteItem struct {
+	DeleteItem *DeleteItemRequest `protobuf:"bytes,3,opt,name=delete_item,json=deleteItem,proto3,oneof"`
+}
+
+type Command_GetItem struct {
+	GetItem *GetItemRequest `protobuf:"bytes,4,opt,name=get_item,json=getItem,proto3,oneof"`
+}
+
+type Command_GetAllItems struct {
+	GetAllItems *GetAllItemsRequest `protobuf:"bytes,5,opt,name=get_all_items,json=getAllItems,proto3,oneof"`
+}
+
+type Command_CasItem struct {
+	CasItem *CasItemRequest `protobuf:"bytes,6,opt,name=cas_item,json=casItem,proto3,oneof"`
+}
+
+type Command_AddIfAbsent struct {
+	AddIfAbsent *AddIfAbsentRequest `protobuf:"bytes,7,opt,name=add_if_absent,json=addIfAbsent,proto3,oneof"`
+}
+
+type Command_Snapshot struct {
+	Snapshot *SnapshotRequest `protobuf:"bytes,8,opt,name=snapshot,proto3,oneof"`
+}
+
+type Command_Transaction struct {
+	Transaction *TransactionRequest `protobuf:"bytes,9,opt,name=transaction,proto3,oneof"`
+}
+
+type Command_Raw struct {
+	// A serialized models.RequestWrapper which isn't a valid command, the executor answers it with an error response
+	Raw string `protobuf:"bytes,15,opt,name=raw,proto3,oneof"`
+}
+
+func (*Command_AddItem) isCommand_Command() {}
+
+func (*Command_DeleteItem) isCommand_Command() {}
+
+func (*Command_GetItem) isCommand_Command() {}
+
+func (*Command_GetAllItems) isCommand_Command() {}
+
+func (*Command_CasItem) isCommand_Command() {}
+
+func (*Command_AddIfAbsent) isCommand_Command() {}
+
+func (*Command_Snapshot) isCommand_Command() {}
+
+func (*Command_Transaction) isCommand_Command() {}
+
+func (*Command_Raw) isCommand_Command() {}
+
+// Response is the response to the command of the same type
+type Response struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Response:
+	//
+	//	*Response_AddItem
+	//	*Response_DeleteItem
+	//	*Response_GetItem
+	//	*Response_GetAllItems
+	//	*Response_CasItem
+	//	*Response_AddIfAbsent
+	//	*Response_Snapshot
+	//	*Response_Transaction
+	//	*Response_Raw
+	Response      isResponse_Response `protobuf_oneof:"response"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	mi := &file_executor_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Response) GetResponse() isResponse_Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *Response) GetAddItem() *AddItemResponse {
+	if x != nil {
+		if x, ok := x.Response.(*Response_AddItem); ok {
+			return x.AddItem
+		}
+	}
+	return nil
+}
+
+func (x *Response) GetDeleteItem() *DeleteItemResponse {
+	if x != nil {
+		if x, ok := x.Response.(*Response_DeleteItem); ok {
+			return x.DeleteItem
+		}
+	}
+	return nil
+}
+
+func (x *Response) GetGetItem() *GetItemResponse {
+	if x != nil {
+		if x, ok := x.Response.(*Response_GetItem); ok {
+			return x.GetItem
+		}
+	}
+	return nil
+}
+
+func (x *Response) GetGetAllItems() *GetAllItemsResponse {
+	if x != nil {
+		if x, ok := x.Response.(*Response_GetAllItems); ok {
+			return x.GetAllItems
+		}
+	}
+	return nil
+}
+
+func (x *Response) GetCasItem() *CasItemResponse {
+	if x != nil {
+		if x, ok := x.Response.(*Response_CasItem); ok {
+			return x.CasItem
+		}
+	}
+	return nil
+}
+
+func (x *Response) GetAddIfAbsent() *AddIfAbsentResponse {
+	if x != nil {
+		if x, ok := x.Response.(*Response_AddIfAbsent); ok {
+			return x.AddIfAbsent
+		}
+	}
+	return nil
+}
+
+func (x *Response) GetSnapshot() *SnapshotResponse {
+	if x != nil {
+		if x, ok := x.Response.(*Response_Snapshot); ok {
+			return x.Snapshot
+		}
+	}
+	return nil
+}
+
+func (x *Response) GetTransaction() *TransactionResponse {
+	if x != nil {
+		if x, ok := x.Response.(*Response_Transaction); ok {
+			return x.Transaction
+		}
+	}
+	return nil
+}
+
+func (x *Response) GetRaw() string {
+	if x != nil {
+		if x, ok := x.Response.(*Response_Raw); ok {
+			return x.Raw
+		}
+	}
+	return ""
+}
+
+type isResponse_Response interface {
+	isResponse_Response()
+}
+
+type Response_AddItem struct {
+	AddItem *AddItemResponse `protobuf:"bytes,2,opt,name=add_item,json=addItem,proto3,oneof"`
+}
+
+type Response_DeleteItem struct {
+	DeleteItem *DeleteItemResponse `protobuf:"bytes,3,opt,name=delete_item,json=deleteItem,proto3,oneof"`
+}
+
+type Response_GetItem struct {
+	GetItem *GetItemResponse `protobuf:"bytes,4,opt,name=get_item,json=getItem,proto3,oneof"`
+}
+
+type Response_GetAllItems struct {
+	GetAllItems *GetAllItemsResponse `protobuf:"bytes,5,opt,name=get_all_items,json=getAllItems,proto3,oneof"`
+}
+
+type Response_CasItem struct {
+	CasItem *CasItemResponse `protobuf:"bytes,6,opt,name=cas_item,json=casItem,proto3,oneof"`
+}
+
+type Response_AddIfAbsent struct {
+	AddIfAbsent *AddIfAbsentResponse `protobuf:"bytes,7,opt,name=add_if_absent,json=addIfAbsent,proto3,oneof"`
+}
+
+type Response_Snapshot struct {
+	Snapshot *SnapshotResponse `protobuf:"bytes,8,opt,name=snapshot,proto3,oneof"`
+}
+
+type Response_Transaction struct {
+	Transaction *TransactionResponse `protobuf:"bytes,9,opt,name=transaction,proto3,oneof"`
+}
+
+type Response_Raw struct {
+	// The serialized response to a raw command
+	Raw string `protobuf:"bytes,15,opt,name=raw,proto3,oneof"`
+}
+
+func (*Response_AddItem) isResponse_Response() {}
+
+func (*Response_DeleteItem) isResponse_Response() {}
+
+func (*Response_GetItem) isResponse_Response() {}
+
+func (*Response_GetAllItems) isResponse_Response() {}
+
+func (*Response_CasItem) isResponse_Response() {}
+
+func (*Response_AddIfAbsent) isResponse_Response() {}
+
+func (*Response_Snapshot) isResponse_Response() {}
+
+func (*Response_Transaction) isResponse_Response() {}
+
+func (*Response_Raw) isResponse_Response() {}
+
+type AddItemRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	TtlMs         int64                  `protobuf:"varint,3,opt,name=ttl_ms,json=ttlMs,proto3" json:"ttl_ms,omitempty"` // Item expires after this many milliseconds, never if not set
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddItemRequest) Reset() {
+	*x = AddItemRequest{}
+	mi := &file_executor_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddItemRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddItemRequest) ProtoMessage() {}
+
+func (x *AddItemRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddItemRequest.ProtoReflect.Descriptor instead.
+func (*AddItemRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AddItemRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *AddItemRequest) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *AddItemRequest) GetTtlMs() int64 {
+	if x != nil {
+		return x.TtlMs
+	}
+	return 0
+}
+
+type AddItemResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddItemResponse) Reset() {
+	*x = AddItemResponse{}
+	mi := &file_executor_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddItemResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddItemResponse) ProtoMessage() {}
+
+func (x *AddItemResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddItemResponse.ProtoReflect.Descriptor instead.
+func (*AddItemResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AddItemResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *AddItemResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type DeleteItemRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	IgnoreMissing bool                   `protobuf:"varint,2,opt,name=ignore_missing,json=ignoreMissing,proto3" json:"ignore_missing,omitempty"` // A missing key doesn't abort the transaction of the request
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteItemRequest) Reset() {
+	*x = DeleteItemRequest{}
+	mi := &file_executor_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteItemRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteItemRequest) ProtoMessage() {}
+
+func (x *DeleteItemRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteItemRequest.ProtoReflect.Descriptor instead.
+func (*DeleteItemRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteItemRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *DeleteItemRequest) GetIgnoreMissing() bool {
+	if x != nil {
+		return x.IgnoreMissing
+	}
+	return false
+}
+
+type DeleteItemResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteItemResponse) Reset() {
+	*x = DeleteItemResponse{}
+	mi := &file_executor_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteItemResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteItemResponse) ProtoMessage() {}
+
+func (x *DeleteItemResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteItemResponse.ProtoReflect.Descriptor instead.
+func (*DeleteItemResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DeleteItemResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *DeleteItemResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type GetItemRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	IgnoreMissing bool                   `protobuf:"varint,2,opt,name=ignore_missing,json=ignoreMissing,proto3" json:"ignore_missing,omitempty"` // A missing key doesn't abort the transaction of the request
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetItemRequest) Reset() {
+	*x = GetItemRequest{}
+	mi := &file_executor_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetItemRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetItemRequest) ProtoMessage() {}
+
+func (x *GetItemRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetItemRequest.ProtoReflect.Descriptor instead.
+func (*GetItemRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetItemRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *GetItemRequest) GetIgnoreMissing() bool {
+	if x != nil {
+		return x.IgnoreMissing
+	}
+	return false
+}
+
+type GetItemResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Version       uint64                 `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"` // Current version of the item, for CasItemRequest
+	Message       string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetItemResponse) Reset() {
+	*x = GetItemResponse{}
+	mi := &file_executor_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetItemResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetItemResponse) ProtoMessage() {}
+
+func (x *GetItemResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetItemResponse.ProtoReflect.Descriptor instead.
+func (*GetItemResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetItemResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *GetItemResponse) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *GetItemResponse) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *GetItemResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type GetAllItemsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Limit         int64                  `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`  // Maximum number of items in the page, server default if not set
+	Cursor        string                 `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"` // Opaque cursor from the previous response, empty for the first page
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAllItemsRequest) Reset() {
+	*x = GetAllItemsRequest{}
+	mi := &file_executor_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAllItemsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAllItemsRequest) ProtoMessage() {}
+
+func (x *GetAllItemsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAllItemsRequest.ProtoReflect.Descriptor instead.
+func (*GetAllItemsRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetAllItemsRequest) GetLimit() int64 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *GetAllItemsRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type KeyValuePair struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyValuePair) Reset() {
+	*x = KeyValuePair{}
+	mi := &file_executor_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyValuePair) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyValuePair) ProtoMessage() {}
+
+func (x *KeyValuePair) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyValuePair.ProtoReflect.Descriptor instead.
+func (*KeyValuePair) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *KeyValuePair) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KeyValuePair) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type GetAllItemsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         []*KeyValuePair        `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"` // Empty if it's the last page
+	Success       bool                   `protobuf:"varint,3,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAllItemsResponse) Reset() {
+	*x = GetAllItemsResponse{}
+	mi := &file_executor_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAllItemsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAllItemsResponse) ProtoMessage() {}
+
+func (x *GetAllItemsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAllItemsResponse.ProtoReflect.Descriptor instead.
+func (*GetAllItemsResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *GetAllItemsResponse) GetItems() []*KeyValuePair {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *GetAllItemsResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+func (x *GetAllItemsResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *GetAllItemsResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type CasItemRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Version       uint64                 `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"` // Expected current version of the item
+	TtlMs         int64                  `protobuf:"varint,4,opt,name=ttl_ms,json=ttlMs,proto3" json:"ttl_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CasItemRequest) Reset() {
+	*x = CasItemRequest{}
+	mi := &file_executor_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CasItemRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CasItemRequest) ProtoMessage() {}
+
+func (x *CasItemRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CasItemRequest.ProtoReflect.Descriptor instead.
+func (*CasItemRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *CasItemRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *CasItemRequest) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *CasItemRequest) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *CasItemRequest) GetTtlMs() int64 {
+	if x != nil {
+		return x.TtlMs
+	}
+	return 0
+}
+
+type CasItemResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Version       uint64                 `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"` // New version on success, current version on mismatch
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CasItemResponse) Reset() {
+	*x = CasItemResponse{}
+	mi := &file_executor_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CasItemResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CasItemResponse) ProtoMessage() {}
+
+func (x *CasItemResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CasItemResponse.ProtoReflect.Descriptor instead.
+func (*CasItemResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *CasItemResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *CasItemResponse) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *CasItemResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type AddIfAbsentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	TtlMs         int64                  `protobuf:"varint,3,opt,name=ttl_ms,json=ttlMs,proto3" json:"ttl_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddIfAbsentRequest) Reset() {
+	*x = AddIfAbsentRequest{}
+	mi := &file_executor_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddIfAbsentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddIfAbsentRequest) ProtoMessage() {}
+
+func (x *AddIfAbsentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddIfAbsentRequest.ProtoReflect.Descriptor instead.
+func (*AddIfAbsentRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *AddIfAbsentRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *AddIfAbsentRequest) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *AddIfAbsentRequest) GetTtlMs() int64 {
+	if x != nil {
+		return x.TtlMs
+	}
+	return 0
+}
+
+type AddIfAbsentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Version       uint64                 `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"` // New version on success, current version if the key exists
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddIfAbsentResponse) Reset() {
+	*x = AddIfAbsentResponse{}
+	mi := &file_executor_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddIfAbsentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddIfAbsentResponse) ProtoMessage() {}
+
+func (x *AddIfAbsentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddIfAbsentResponse.ProtoReflect.Descriptor instead.
+func (*AddIfAbsentResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *AddIfAbsentResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *AddIfAbsentResponse) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *AddIfAbsentResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type SnapshotRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SnapshotRequest) Reset() {
+	*x = SnapshotRequest{}
+	mi := &file_executor_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotRequest) ProtoMessage() {}
+
+func (x *SnapshotRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotRequest.ProtoReflect.Descriptor instead.
+func (*SnapshotRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{19}
+}
+
+type SnapshotResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Items         int64                  `protobuf:"varint,2,opt,name=items,proto3" json:"items,omitempty"` // Number of items captured by the snapshot
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SnapshotResponse) Reset() {
+	*x = SnapshotResponse{}
+	mi := &file_executor_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotResponse) ProtoMessage() {}
+
+func (x *SnapshotResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotResponse.ProtoReflect.Descriptor instead.
+func (*SnapshotResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *SnapshotResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *SnapshotResponse) GetItems() int64 {
+	if x != nil {
+		return x.Items
+	}
+	return 0
+}
+
+func (x *SnapshotResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// TransactionRequest executes the commands with all-or-nothing semantics,
+// only add_item, delete_item, get_item, cas_item and add_if_absent commands are allowed
+type TransactionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Commands      []*Command             `protobuf:"bytes,1,rep,name=commands,proto3" json:"commands,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransactionRequest) Reset() {
+	*x = TransactionRequest{}
+	mi := &file_executor_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransactionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransactionRequest) ProtoMessage() {}
+
+func (x *TransactionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransactionRequest.ProtoReflect.Descriptor instead.
+func (*TransactionRequest) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *TransactionRequest) GetCommands() []*Command {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+type TransactionResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Success bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	// Responses to the commands in order. If a command fails, nothing is applied
+	// and the results end with the response of the failed command.
+	Results       []*Response `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	Message       string      `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransactionResponse) Reset() {
+	*x = TransactionResponse{}
+	mi := &file_executor_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransactionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransactionResponse) ProtoMessage() {}
+
+func (x *TransactionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_executor_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransactionResponse.ProtoReflect.Descriptor instead.
+func (*TransactionResponse) Descriptor() ([]byte, []int) {
+	return file_executor_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *TransactionResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *TransactionResponse) GetResults() []*Response {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *TransactionResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_executor_proto protoreflect.FileDescriptor
+
+const file_executor_proto_rawDesc = "" +
+	"\n" +
+	"\x0eexecutor.proto\x12\bexecutor\"\x98\x01\n" +
+	"\x0fExchangeRequest\x12%\n" +
+	"\x0ecorrelation_id\x18\x01 \x01(\tR\rcorrelationId\x12-\n" +
+	"\acommand\x18\x02 \x01(\v2\x11.executor.CommandH\x00R\acommand\x12'\n" +
+	"\x05batch\x18\x03 \x01(\v2\x0f.executor.BatchH\x00R\x05batchB\x06\n" +
+	"\x04body\"\xb9\x01\n" +
+	"\rExchangeReply\x12%\n" +
+	"\x0ecorrelation_id\x18\x01 \x01(\tR\rcorrelationId\x120\n" +
+	"\bresponse\x18\x02 \x01(\v2\x12.executor.ResponseH\x00R\bresponse\x12/\n" +
+	"\x05batch\x18\x03 \x01(\v2\x17.executor.BatchResponseH\x00R\x05batch\x12\x16\n" +
+	"\x05error\x18\x04 \x01(\tH\x00R\x05errorB\x06\n" +
+	"\x04body\"6\n" +
+	"\x05Batch\x12-\n" +
+	"\bcommands\x18\x01 \x03(\v2\x11.executor.CommandR\bcommands\"A\n" +
+	"\rBatchResponse\x120\n" +
+	"\tresponses\x18\x01 \x03(\v2\x12.executor.ResponseR\tresponses\"\xaf\x04\n" +
+	"\aCommand\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x125\n" +
+	"\badd_item\x18\x02 \x01(\v2\x18.executor.AddItemRequestH\x00R\aaddItem\x12>\n" +
+	"\vdelete_item\x18\x03 \x01(\v2\x1b.executor.DeleteItemRequestH\x00R\n" +
+	"deleteItem\x125\n" +
+	"\bget_item\x18\x04 \x01(\v2\x18.executor.GetItemRequestH\x00R\agetItem\x12B\n" +
+	"\rget_all_items\x18\x05 \x01(\v2\x1c.executor.GetAllItemsRequestH\x00R\vgetAllItems\x125\n" +
+	"\bcas_item\x18\x06 \x01(\v2\x18.executor.CasItemRequestH\x00R\acasItem\x12B\n" +
+	"\radd_if_absent\x18\a \x01(\v2\x1c.executor.AddIfAbsentRequestH\x00R\vaddIfAbsent\x127\n" +
+	"\bsnapshot\x18\b \x01(\v2\x19.executor.SnapshotRequestH\x00R\bsnapshot\x12@\n" +
+	"\vtransaction\x18\t \x01(\v2\x1c.executor.TransactionRequestH\x00R\vtransaction\x12\x12\n" +
+	"\x03raw\x18\x0f \x01(\tH\x00R\x03rawB\t\n" +
+	"\acommand\"\x9a\x04\n" +
+	"\bResponse\x126\n" +
+	"\badd_item\x18\x02 \x01(\v2\x19.executor.AddItemResponseH\x00R\aaddItem\x12?\n" +
+	"\vdelete_item\x18\x03 \x01(\v2\x1c.executor.DeleteItemResponseH\x00R\n" +
+	"deleteItem\x126\n" +
+	"\bget_item\x18\x04 \x01(\v2\x19.executor.GetItemResponseH\x00R\agetItem\x12C\n" +
+	"\rget_all_items\x18\x05 \x01(\v2\x1d.executor.GetAllItemsResponseH\x00R\vgetAllItems\x126\n" +
+	"\bcas_item\x18\x06 \x01(\v2\x19.executor.CasItemResponseH\x00R\acasItem\x12C\n" +
+	"\radd_if_absent\x18\a \x01(\v2\x1d.executor.AddIfAbsentResponseH\x00R\vaddIfAbsent\x128\n" +
+	"\bsnapshot\x18\b \x01(\v2\x1a.executor.SnapshotResponseH\x00R\bsnapshot\x12A\n" +
+	"\vtransaction\x18\t \x01(\v2\x1d.executor.TransactionResponseH\x00R\vtransaction\x12\x12\n" +
+	"\x03raw\x18\x0f \x01(\tH\x00R\x03rawB\n" +
+	"\n" +
+	"\bresponse\"O\n" +
+	"\x0eAddItemRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x15\n" +
+	"\x06ttl_ms\x18\x03 \x01(\x03R\x05ttlMs\"E\n" +
+	"\x0fAddItemResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"L\n" +
+	"\x11DeleteItemRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12%\n" +
+	"\x0eignore_missing\x18\x02 \x01(\bR\rignoreMissing\"H\n" +
+	"\x12DeleteItemResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"I\n" +
+	"\x0eGetItemRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12%\n" +
+	"\x0eignore_missing\x18\x02 \x01(\bR\rignoreMissing\"u\n" +
+	"\x0fGetItemResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x04R\aversion\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\"B\n" +
+	"\x12GetAllItemsRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x03R\x05limit\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\tR\x06cursor\"6\n" +
+	"\fKeyValuePair\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"\x98\x01\n" +
+	"\x13GetAllItemsResponse\x12,\n" +
+	"\x05items\x18\x01 \x03(\v2\x16.executor.KeyValuePairR\x05items\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\x12\x18\n" +
+	"\asuccess\x18\x03 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\"i\n" +
+	"\x0eCasItemRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x04R\aversion\x12\x15\n" +
+	"\x06ttl_ms\x18\x04 \x01(\x03R\x05ttlMs\"_\n" +
+	"\x0fCasItemResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x04R\aversion\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"S\n" +
+	"\x12AddIfAbsentRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x15\n" +
+	"\x06ttl_ms\x18\x03 \x01(\x03R\x05ttlMs\"c\n" +
+	"\x13AddIfAbsentResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x04R\aversion\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"\x11\n" +
+	"\x0fSnapshotRequest\"\\\n" +
+	"\x10SnapshotResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05items\x18\x02 \x01(\x03R\x05items\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"C\n" +
+	"\x12TransactionRequest\x12-\n" +
+	"\bcommands\x18\x01 \x03(\v2\x11.executor.CommandR\bcommands\"w\n" +
+	"\x13TransactionResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12,\n" +
+	"\aresults\x18\x02 \x03(\v2\x12.executor.ResponseR\aresults\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage2N\n" +
+	"\bExecutor\x12B\n" +
+	"\bExchange\x12\x19.executor.ExchangeRequest\x1a\x17.executor.ExchangeReply(\x010\x01BDZBgithub.com/MishkaRogachev/command-queue-executor/pkg/mq/executorpbb\x06proto3"
+
+var (
+	file_executor_proto_rawDescOnce sync.Once
+	file_executor_proto_rawDescData []byte
+)
+
+func file_executor_proto_rawDescGZIP() []byte {
+	file_executor_proto_rawDescOnce.Do(func() {
+		file_executor_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_executor_proto_rawDesc), len(file_executor_proto_rawDesc)))
+	})
+	return file_executor_proto_rawDescData
+}
+
+var file_executor_proto_msgTypes = make([]protoimpl.MessageInfo, 23)
+var file_executor_proto_goTypes = []any{
+	(*ExchangeRequest)(nil),     // 0: executor.ExchangeRequest
+	(*ExchangeReply)(nil),       // 1: executor.ExchangeReply
+	(*Batch)(nil),               // 2: executor.Batch
+	(*BatchResponse)(nil),       // 3: executor.BatchResponse
+	(*Command)(nil),             // 4: executor.Command
+	(*Response)(nil),            // 5: executor.Response
+	(*AddItemRequest)(nil),      // 6: executor.AddItemRequest
+	(*AddItemResponse)(nil),     // 7: executor.AddItemResponse
+	(*DeleteItemRequest)(nil),   // 8: executor.DeleteItemRequest
+	(*DeleteItemResponse)(nil),  // 9: executor.DeleteItemResponse
+	(*GetItemRequest)(nil),      // 10: executor.GetItemRequest
+	(*GetItemResponse)(nil),     // 11: executor.GetItemResponse
+	(*GetAllItemsRequest)(nil),  // 12: executor.GetAllItemsRequest
+	(*KeyValuePair)(nil),        // 13: executor.KeyValuePair
+	(*GetAllItemsResponse)(nil), // 14: executor.GetAllItemsResponse
+	(*CasItemRequest)(nil),      // 15: executor.CasItemRequest
+	(*CasItemResponse)(nil),     // 16: executor.CasItemResponse
+	(*AddIfAbsentRequest)(nil),  // 17: executor.AddIfAbsentRequest
+	(*AddIfAbsentResponse)(nil), // 18: executor.AddIfAbsentResponse
+	(*SnapshotRequest)(nil),     // 19: executor.SnapshotRequest
+	(*SnapshotResponse)(nil),    // 20: executor.SnapshotResponse
+	(*TransactionRequest)(nil),  // 21: executor.TransactionRequest
+	(*TransactionResponse)(nil), // 22: executor.TransactionResponse
+}
+var file_executor_proto_depIdxs = []int32{
+	4,  // 0: executor.ExchangeRequest.command:type_name -> executor.Command
+	2,  // 1: executor.ExchangeRequest.batch:type_name -> executor.Batch
+	5,  // 2: executor.ExchangeReply.response:type_name -> executor.Response
+	3,  // 3: executor.ExchangeReply.batch:type_name -> executor.BatchResponse
+	4,  // 4: executor.Batch.commands:type_name -> executor.Command
+	5,  // 5: executor.BatchResponse.responses:type_name -> executor.Response
+	6,  // 6: executor.Command.add_item:type_name -> executor.AddItemRequest
+	8,  // 7: executor.Command.delete_item:type_name -> executor.DeleteItemRequest
+	10, // 8: executor.Command.get_item:type_name -> executor.GetItemRequest
+	12, // 9: executor.Command.get_all_items:type_name -> executor.GetAllItemsRequest
+	15, // 10: executor.Command.cas_item:type_name -> executor.CasItemRequest
+	17, // 11: executor.Command.add_if_absent:type_name -> executor.AddIfAbsentRequest
+	19, // 12: executor.Command.snapshot:type_name -> executor.SnapshotRequest
+	21, // 13: executor.Command.transaction:type_name -> executor.TransactionRequest
+	7,  // 14: executor.Response.add_item:type_name -> executor.AddItemResponse
+	9,  // 15: executor.Response.delete_item:type_name -> executor.DeleteItemResponse
+	11, // 16: executor.Response.get_item:type_name -> executor.GetItemResponse
+	14, // 17: executor.Response.get_all_items:type_name -> executor.GetAllItemsResponse
+	16, // 18: executor.Response.cas_item:type_name -> executor.CasItemResponse
+	18, // 19: executor.Response.add_if_absent:type_name -> executor.AddIfAbsentResponse
+	20, // 20: executor.Response.snapshot:type_name -> executor.SnapshotResponse
+	22, // 21: executor.Response.transaction:type_name -> executor.TransactionResponse
+	13, // 22: executor.GetAllItemsResponse.items:type_name -> executor.KeyValuePair
+	4,  // 23: executor.TransactionRequest.commands:type_name -> executor.Command
+	5,  // 24: executor.TransactionResponse.results:type_name -> executor.Response
+	0,  // 25: executor.Executor.Exchange:input_type -> executor.ExchangeRequest
+	1,  // 26: executor.Executor.Exchange:output_type -> executor.ExchangeReply
+	26, // [26:27] is the sub-list for method output_type
+	25, // [25:26] is the sub-list for method input_type
+	25, // [25:25] is the sub-list for extension type_name
+	25, // [25:25] is the sub-list for extension extendee
+	0,  // [0:25] is the sub-list for field type_name
+}
+
+func init() { file_executor_proto_init() }
+func file_executor_proto_init() {
+	if File_executor_proto != nil {
+		return
+	}
+	file_executor_proto_msgTypes[0].OneofWrappers = []any{
+		(*ExchangeRequest_Command)(nil),
+		(*ExchangeRequest_Batch)(nil),
+	}
+	file_executor_proto_msgTypes[1].OneofWrappers = []any{
+		(*ExchangeReply_Response)(nil),
+		(*ExchangeReply_Batch)(nil),
+		(*ExchangeReply_Error)(nil),
+	}
+	file_executor_proto_msgTypes[4].OneofWrappers = []any{
+		(*Command_AddItem)(nil),
+		(*Command_DeleteItem)(nil),
+		(*Command_GetItem)(nil),
+		(*Command_GetAllItems)(nil),
+		(*Command_CasItem)(nil),
+		(*Command_AddIfAbsent)(nil),
+		(*Command_Snapshot)(nil),
+		(*Command_Transaction)(nil),
+		(*Command_Raw)(nil),
+	}
+	file_executor_proto_msgTypes[5].OneofWrappers = []any{
+		(*Response_AddItem)(nil),
+		(*Response_DeleteItem)(nil),
+		(*Response_GetItem)(nil),
+		(*Response_GetAllItems)(nil),
+		(*Response_CasItem)(nil),
+		(*Response_AddIfAbsent)(nil),
+		(*Response_Snapshot)(nil),
+		(*Response_Transaction)(nil),
+		(*Response_Raw)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_executor_proto_rawDesc), len(file_executor_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   23,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_executor_proto_goTypes,
+		DependencyIndexes: file_executor_proto_depIdxs,
+		MessageInfos:      file_executor_proto_msgTypes,
+	}.Build()
+	File_executor_proto = out.File
+	file_executor_proto_goTypes = nil
+	file_executor_proto_depIdxs = nil
+}
@@ -0,0 +1,4 @@
+// Package executorpb holds the protobuf messages and the gRPC service of the executor, generated from executor.proto
+package executorpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative executor.proto
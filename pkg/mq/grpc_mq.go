@@ -0,0 +1,337 @@
+package mq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq/executorpb"
+)
+
+// The gRPC service of the executor is defined in executorpb/executor.proto: one bidirectional stream per client,
+// requests go up and replies come down in any order, matched by correlation IDs. Commands and responses
+// are typed messages, ServerGRPC and ClientGRPC translate them from and to the serialized models
+// which ServerMQ and ClientMQ carry. Data which isn't a valid command is passed raw,
+// so the executor answers it with an error response as over any other transport.
+
+// errInvalidCommand is the reply error of a typed command the server can't pass to the executor
+var errInvalidCommand = errors.New("invalid command")
+
+// commandFromData types a serialized models.RequestWrapper, it's passed raw if it isn't a valid command
+func commandFromData(data string) *executorpb.Command {
+	var wrapper models.RequestWrapper
+	if err := json.Unmarshal([]byte(data), &wrapper); err == nil {
+		if command, err := commandFromWrapper(wrapper); err == nil {
+			return command
+		}
+	}
+	return &executorpb.Command{Command: &executorpb.Command_Raw{Raw: data}}
+}
+
+// commandFromWrapper types a command, it fails if the type is unknown or the payload doesn't match it
+func commandFromWrapper(wrapper models.RequestWrapper) (*executorpb.Command, error) {
+	command := &executorpb.Command{RequestId: wrapper.RequestID}
+	switch wrapper.Type {
+	case models.AddItem:
+		req, err := decodeModel[models.AddItemRequest](wrapper.Payload)
+		if err != nil {
+			return nil, err
+		}
+		command.Command = &executorpb.Command_AddItem{AddItem: &executorpb.AddItemRequest{
+			Key: req.Key, Value: req.Value, TtlMs: req.TTLMs,
+		}}
+	case models.DeleteItem:
+		req, err := decodeModel[models.DeleteItemRequest](wrapper.Payload)
+		if err != nil {
+			return nil, err
+		}
+		command.Command = &executorpb.Command_DeleteItem{DeleteItem: &executorpb.DeleteItemRequest{
+			Key: req.Key, IgnoreMissing: req.IgnoreMissing,
+		}}
+	case models.GetItem:
+		req, err := decodeModel[models.GetItemRequest](wrapper.Payload)
+		if err != nil {
+			return nil, err
+		}
+		command.Command = &executorpb.Command_GetItem{GetItem: &executorpb.GetItemRequest{
+			Key: req.Key, IgnoreMissing: req.IgnoreMissing,
+		}}
+	case models.GetAll:
+		req, err := decodeModel[models.GetAllItemsRequest](wrapper.Payload)
+		if err != nil {
+			return nil, err
+		}
+		command.Command = &executorpb.Command_GetAllItems{GetAllItems: &executorpb.GetAllItemsRequest{
+			Limit: int64(req.Limit), Cursor: req.Cursor,
+		}}
+	case models.CasItem:
+		req, err := decodeModel[models.CasItemRequest](wrapper.Payload)
+		if err != nil {
+			return nil, err
+		}
+		command.Command = &executorpb.Command_CasItem{CasItem: &executorpb.CasItemRequest{
+			Key: req.Key, Value: req.Value, Version: req.Version, TtlMs: req.TTLMs,
+		}}
+	case models.AddIfAbsent:
+		req, err := decodeModel[models.AddIfAbsentRequest](wrapper.Payload)
+		if err != nil {
+			return nil, err
+		}
+		command.Command = &executorpb.Command_AddIfAbsent{AddIfAbsent: &executorpb.AddIfAbsentRequest{
+			Key: req.Key, Value: req.Value, TtlMs: req.TTLMs,
+		}}
+	case models.Snapshot:
+		if _, err := decodeModel[models.SnapshotRequest](wrapper.Payload); err != nil {
+			return nil, err
+		}
+		command.Command = &executorpb.Command_Snapshot{Snapshot: &executorpb.SnapshotRequest{}}
+	case models.Transaction:
+		req, err := decodeModel[models.TransactionRequest](wrapper.Payload)
+		if err != nil {
+			return nil, err
+		}
+		tx := &executorpb.TransactionRequest{}
+		for _, request := range req.Requests {
+			nested, err := commandFromWrapper(request)
+			if err != nil {
+				return nil, err
+			}
+			tx.Commands = append(tx.Commands, nested)
+		}
+		command.Command = &executorpb.Command_Transaction{Transaction: tx}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", errInvalidCommand, wrapper.Type)
+	}
+	return command, nil
+}
+
+// commandData serializes a typed command as the models.RequestWrapper the executor takes
+func commandData(command *executorpb.Command) (string, error) {
+	if raw, ok := command.GetCommand().(*executorpb.Command_Raw); ok {
+		return raw.Raw, nil
+	}
+	wrapper, err := commandWrapper(command)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(wrapper)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize command: %w", err)
+	}
+	return string(data), nil
+}
+
+func commandWrapper(command *executorpb.Command) (models.RequestWrapper, error) {
+	var requestType models.RequestType
+	var payload any
+	switch c := command.GetCommand().(type) {
+	case *executorpb.Command_AddItem:
+		requestType, payload = models.AddItem, models.AddItemRequest{
+			Key: c.AddItem.GetKey(), Value: c.AddItem.GetValue(), TTLMs: c.AddItem.GetTtlMs(),
+		}
+	case *executorpb.Command_DeleteItem:
+		requestType, payload = models.DeleteItem, models.DeleteItemRequest{
+			Key: c.DeleteItem.GetKey(), IgnoreMissing: c.DeleteItem.GetIgnoreMissing(),
+		}
+	case *executorpb.Command_GetItem:
+		requestType, payload = models.GetItem, models.GetItemRequest{
+			Key: c.GetItem.GetKey(), IgnoreMissing: c.GetItem.GetIgnoreMissing(),
+		}
+	case *executorpb.Command_GetAllItems:
+		requestType, payload = models.GetAll, models.GetAllItemsRequest{
+			Limit: int(c.GetAllItems.GetLimit()), Cursor: c.GetAllItems.GetCursor(),
+		}
+	case *executorpb.Command_CasItem:
+		requestType, payload = models.CasItem, models.CasItemRequest{
+			Key: c.CasItem.GetKey(), Value: c.CasItem.GetValue(), Version: c.CasItem.GetVersion(), TTLMs: c.CasItem.GetTtlMs(),
+		}
+	case *executorpb.Command_AddIfAbsent:
+		requestType, payload = models.AddIfAbsent, models.AddIfAbsentRequest{
+			Key: c.AddIfAbsent.GetKey(), Value: c.AddIfAbsent.GetValue(), TTLMs: c.AddIfAbsent.GetTtlMs(),
+		}
+	case *executorpb.Command_Snapshot:
+		requestType, payload = models.Snapshot, models.SnapshotRequest{}
+	case *executorpb.Command_Transaction:
+		var tx models.TransactionRequest
+		for _, nested := range c.Transaction.GetCommands() {
+			wrapper, err := commandWrapper(nested)
+			if err != nil {
+				return models.RequestWrapper{}, err
+			}
+			tx.Requests = append(tx.Requests, wrapper)
+		}
+		requestType, payload = models.Transaction, tx
+	case *executorpb.Command_Raw:
+		// A raw command of a transaction, it must be a wrapper to be a part of it
+		var wrapper models.RequestWrapper
+		if err := json.Unmarshal([]byte(c.Raw), &wrapper); err != nil {
+			return models.RequestWrapper{}, fmt.Errorf("%w: %v", errInvalidCommand, err)
+		}
+		return wrapper, nil
+	default:
+		return models.RequestWrapper{}, fmt.Errorf("%w: no command set", errInvalidCommand)
+	}
+
+	wrapper, err := models.NewRequestWrapper(requestType, payload)
+	if err != nil {
+		return models.RequestWrapper{}, err
+	}
+	wrapper.RequestID = command.GetRequestId()
+	return wrapper, nil
+}
+
+// typedResponse types the executor's response to the command, a response it can't type is passed raw
+func typedResponse(command *executorpb.Command, data string) *executorpb.Response {
+	response, err := responseFor(command, data)
+	if err != nil {
+		return &executorpb.Response{Response: &executorpb.Response_Raw{Raw: data}}
+	}
+	return response
+}
+
+func responseFor(command *executorpb.Command, data string) (*executorpb.Response, error) {
+	raw := json.RawMessage(data)
+	switch c := command.GetCommand().(type) {
+	case *executorpb.Command_AddItem:
+		resp, err := decodeModel[models.AddItemResponse](raw)
+		if err != nil {
+			return nil, err
+		}
+		return &executorpb.Response{Response: &executorpb.Response_AddItem{AddItem: &executorpb.AddItemResponse{
+			Success: resp.Success, Message: resp.Message,
+		}}}, nil
+	case *executorpb.Command_DeleteItem:
+		resp, err := decodeModel[models.DeleteItemResponse](raw)
+		if err != nil {
+			return nil, err
+		}
+		return &executorpb.Response{Response: &executorpb.Response_DeleteItem{DeleteItem: &executorpb.DeleteItemResponse{
+			Success: resp.Success, Message: resp.Message,
+		}}}, nil
+	case *executorpb.Command_GetItem:
+		resp, err := decodeModel[models.GetItemResponse](raw)
+		if err != nil {
+			return nil, err
+		}
+		return &executorpb.Response{Response: &executorpb.Response_GetItem{GetItem: &executorpb.GetItemResponse{
+			Success: resp.Success, Value: resp.Value, Version: resp.Version, Message: resp.Message,
+		}}}, nil
+	case *executorpb.Command_GetAllItems:
+		resp, err := decodeModel[models.GetAllItemsResponse](raw)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]*executorpb.KeyValuePair, len(resp.Items))
+		for i, item := range resp.Items {
+			items[i] = &executorpb.KeyValuePair{Key: item.Key, Value: item.Value}
+		}
+		return &executorpb.Response{Response: &executorpb.Response_GetAllItems{GetAllItems: &executorpb.GetAllItemsResponse{
+			Items: items, NextCursor: resp.NextCursor, Success: resp.Success, Message: resp.Message,
+		}}}, nil
+	case *executorpb.Command_CasItem:
+		resp, err := decodeModel[models.CasItemResponse](raw)
+		if err != nil {
+			return nil, err
+		}
+		return &executorpb.Response{Response: &executorpb.Response_CasItem{CasItem: &executorpb.CasItemResponse{
+			Success: resp.Success, Version: resp.Version, Message: resp.Message,
+		}}}, nil
+	case *executorpb.Command_AddIfAbsent:
+		resp, err := decodeModel[models.AddIfAbsentResponse](raw)
+		if err != nil {
+			return nil, err
+		}
+		return &executorpb.Response{Response: &executorpb.Response_AddIfAbsent{AddIfAbsent: &executorpb.AddIfAbsentResponse{
+			Success: resp.Success, Version: resp.Version, Message: resp.Message,
+		}}}, nil
+	case *executorpb.Command_Snapshot:
+		resp, err := decodeModel[models.SnapshotResponse](raw)
+		if err != nil {
+			return nil, err
+		}
+		return &executorpb.Response{Response: &executorpb.Response_Snapshot{Snapshot: &executorpb.SnapshotResponse{
+			Success: resp.Success, Items: int64(resp.Items), Message: resp.Message,
+		}}}, nil
+	case *executorpb.Command_Transaction:
+		resp, err := decodeModel[models.TransactionResponse](raw)
+		if err != nil {
+			return nil, err
+		}
+		// Results follow the commands, the last one may answer a command the transaction doesn't allow
+		commands := c.Transaction.GetCommands()
+		results := make([]*executorpb.Response, len(resp.Results))
+		for i, result := range resp.Results {
+			var nested *executorpb.Command
+			if i < len(commands) {
+				nested = commands[i]
+			}
+			results[i] = typedResponse(nested, string(result))
+		}
+		return &executorpb.Response{Response: &executorpb.Response_Transaction{Transaction: &executorpb.TransactionResponse{
+			Success: resp.Success, Results: results, Message: resp.Message,
+		}}}, nil
+	default:
+		return nil, fmt.Errorf("%w: untyped command", errInvalidCommand)
+	}
+}
+
+// responseData serializes a typed response as the models response the executor replied with
+func responseData(response *executorpb.Response) (string, error) {
+	var resp any
+	switch r := response.GetResponse().(type) {
+	case *executorpb.Response_Raw:
+		return r.Raw, nil
+	case *executorpb.Response_AddItem:
+		resp = models.AddItemResponse{Success: r.AddItem.GetSuccess(), Message: r.AddItem.GetMessage()}
+	case *executorpb.Response_DeleteItem:
+		resp = models.DeleteItemResponse{Success: r.DeleteItem.GetSuccess(), Message: r.DeleteItem.GetMessage()}
+	case *executorpb.Response_GetItem:
+		resp = models.GetItemResponse{
+			Success: r.GetItem.GetSuccess(), Value: r.GetItem.GetValue(), Version: r.GetItem.GetVersion(), Message: r.GetItem.GetMessage(),
+		}
+	case *executorpb.Response_GetAllItems:
+		items := make([]models.KeyValuePair, len(r.GetAllItems.GetItems()))
+		for i, item := range r.GetAllItems.GetItems() {
+			items[i] = models.KeyValuePair{Key: item.GetKey(), Value: item.GetValue()}
+		}
+		resp = models.GetAllItemsResponse{
+			Items: items, NextCursor: r.GetAllItems.GetNextCursor(), Success: r.GetAllItems.GetSuccess(), Message: r.GetAllItems.GetMessage(),
+		}
+	case *executorpb.Response_CasItem:
+		resp = models.CasItemResponse{Success: r.CasItem.GetSuccess(), Version: r.CasItem.GetVersion(), Message: r.CasItem.GetMessage()}
+	case *executorpb.Response_AddIfAbsent:
+		resp = models.AddIfAbsentResponse{
+			Success: r.AddIfAbsent.GetSuccess(), Version: r.AddIfAbsent.GetVersion(), Message: r.AddIfAbsent.GetMessage(),
+		}
+	case *executorpb.Response_Snapshot:
+		resp = models.SnapshotResponse{Success: r.Snapshot.GetSuccess(), Items: int(r.Snapshot.GetItems()), Message: r.Snapshot.GetMessage()}
+	case *executorpb.Response_Transaction:
+		results := make([]json.RawMessage, 0, len(r.Transaction.GetResults()))
+		for _, result := range r.Transaction.GetResults() {
+			data, err := responseData(result)
+			if err != nil {
+				return "", err
+			}
+			results = append(results, json.RawMessage(data))
+		}
+		resp = models.TransactionResponse{Success: r.Transaction.GetSuccess(), Results: results, Message: r.Transaction.GetMessage()}
+	default:
+		return "", errors.New("no response set")
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize response: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeModel deserializes a JSON model, e.g. a request payload or a response
+func decodeModel[T any](data json.RawMessage) (T, error) {
+	var model T
+	if err := json.Unmarshal(data, &model); err != nil {
+		return model, fmt.Errorf("failed to deserialize %T: %w", model, err)
+	}
+	return model, nil
+}
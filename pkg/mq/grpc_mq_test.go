@@ -0,0 +1,266 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq/executorpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newBufconnClient creates a gRPC client of the server listening on the in-memory listener
+func newBufconnClient(t *testing.T, listener *bufconn.Listener) *ClientGRPC {
+	client, err := NewClientGRPC("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to initialize gRPC client: %v", err)
+	}
+	return client
+}
+
+func TestGRPCMQ(t *testing.T) {
+	var listener *bufconn.Listener
+
+	serverFactory := func() ServerMQ {
+		listener = bufconn.Listen(1 << 20)
+		return NewServerGRPC(listener)
+	}
+
+	clientFactory := func() ClientMQ {
+		return newBufconnClient(t, listener) // connect to the current server
+	}
+
+	runMessageQueueTests(t, clientFactory, serverFactory)
+}
+
+func TestGRPCMQServerStopped(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServerGRPC(listener)
+
+	// The server takes requests, but never replies
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	go func() {
+		for range reqCh {
+		}
+	}()
+
+	client := newBufconnClient(t, listener)
+	defer client.Close()
+
+	replyChan, err := client.Request("Message")
+	assert.NoError(t, err)
+
+	// Test requests in flight fail once the server is gone
+	assert.NoError(t, server.Close())
+
+	select {
+	case reply := <-replyChan:
+		assert.ErrorIs(t, reply.Err, ErrConnectionLost)
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the stream loss")
+	}
+	assert.Equal(t, 0, client.corrMap.len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.RequestContext(ctx, "Message")
+	assert.ErrorIs(t, err, ErrNotConnected)
+
+	// Test requests fail once the client is closed
+	assert.NoError(t, client.Close())
+	_, err = client.Request("Message")
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestGRPCMQCorrelationIDsPerStream(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServerGRPC(listener)
+	defer server.Close()
+
+	// Reply once both requests are taken, so they are in the correlation map together
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	go func() {
+		first, second := <-reqCh, <-reqCh
+		for _, req := range []Request{first, second} {
+			assert.NoError(t, server.Reply(req.CorrelationID, "Reply: "+req.Data))
+		}
+	}()
+
+	client := newBufconnClient(t, listener)
+	defer client.Close()
+
+	// Two streams choose the same correlation ID, e.g. both count requests from one
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var streams []grpcExchangeStream
+	for _, data := range []string{"first", "second"} {
+		stream, err := client.executor.Exchange(ctx)
+		assert.NoError(t, err)
+		streams = append(streams, stream)
+
+		assert.NoError(t, stream.Send(&executorpb.ExchangeRequest{
+			CorrelationId: "1",
+			Body:          &executorpb.ExchangeRequest_Command{Command: commandFromData(data)},
+		}))
+	}
+
+	// Test each stream gets the reply to its own request
+	for i, data := range []string{"first", "second"} {
+		reply, err := streams[i].Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, "1", reply.GetCorrelationId())
+		assert.Equal(t, "Reply: "+data, reply.GetResponse().GetRaw())
+	}
+}
+
+func TestGRPCMQTypedMessages(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServerGRPC(listener)
+	defer server.Close()
+
+	// The executor replies with a response for every request type it gets
+	replies := map[models.RequestType]any{
+		models.AddItem: models.AddItemResponse{Success: true, Message: "item added"},
+		models.GetAll: models.GetAllItemsResponse{
+			Items: []models.KeyValuePair{{Key: "a", Value: "1"}}, NextCursor: "next", Success: true,
+		},
+		models.Transaction: models.TransactionResponse{Success: false, Results: []json.RawMessage{
+			json.RawMessage(`{"success":true,"value":"1","version":3}`),
+			json.RawMessage(`{"success":false,"version":3,"message":"version mismatch"}`),
+		}},
+	}
+	respond := func(data string) string {
+		var wrapper models.RequestWrapper
+		if err := json.Unmarshal([]byte(data), &wrapper); err != nil || replies[wrapper.Type] == nil {
+			return "Reply: " + data
+		}
+		reply, _ := json.Marshal(replies[wrapper.Type])
+		return string(reply)
+	}
+	received := make(chan string, 10)
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	go func() {
+		for req := range reqCh {
+			if !req.Batch {
+				received <- req.Data
+				_ = server.Reply(req.CorrelationID, respond(req.Data))
+				continue
+			}
+			requests, _ := DecodeBatch(req.Data)
+			responses := make([]string, len(requests))
+			for i, request := range requests {
+				received <- request
+				responses[i] = respond(request)
+			}
+			batch, _ := EncodeBatch(responses)
+			_ = server.Reply(req.CorrelationID, batch)
+		}
+	}()
+
+	client := newBufconnClient(t, listener)
+	defer client.Close()
+
+	// Test a typed command reaches the executor as a serialized model and the response comes back typed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := client.executor.Exchange(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&executorpb.ExchangeRequest{
+		CorrelationId: "1",
+		Body: &executorpb.ExchangeRequest_Command{Command: &executorpb.Command{
+			RequestId: "request",
+			Command:   &executorpb.Command_AddItem{AddItem: &executorpb.AddItemRequest{Key: "a", Value: "1", TtlMs: 100}},
+		}},
+	}))
+	expected, err := models.NewRequestWrapper(models.AddItem, models.AddItemRequest{Key: "a", Value: "1", TTLMs: 100})
+	assert.NoError(t, err)
+	expected.RequestID = "request"
+	assertRequestData(t, expected, <-received)
+
+	reply, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.True(t, reply.GetResponse().GetAddItem().GetSuccess())
+	assert.Equal(t, "item added", reply.GetResponse().GetAddItem().GetMessage())
+
+	// Test the client sends serialized models typed and gets the same responses back
+	getAll, err := models.SerializeRequest(models.GetAll, models.GetAllItemsRequest{Limit: 1})
+	assert.NoError(t, err)
+	get, err := models.NewRequestWrapper(models.GetItem, models.GetItemRequest{Key: "a"})
+	assert.NoError(t, err)
+	cas, err := models.NewRequestWrapper(models.CasItem, models.CasItemRequest{Key: "a", Value: "2", Version: 2})
+	assert.NoError(t, err)
+	transaction, err := models.SerializeRequest(models.Transaction, models.TransactionRequest{Requests: []models.RequestWrapper{get, cas}})
+	assert.NoError(t, err)
+
+	for _, request := range []string{getAll, transaction} {
+		replyChan, err := client.Request(request)
+		assert.NoError(t, err)
+		var wrapper models.RequestWrapper
+		assert.NoError(t, json.Unmarshal([]byte(request), &wrapper))
+		assertRequestData(t, wrapper, <-received)
+
+		expectedReply, err := json.Marshal(replies[wrapper.Type])
+		assert.NoError(t, err)
+		assert.Equal(t, Reply{Data: string(expectedReply)}, <-replyChan)
+	}
+
+	// Test data which isn't a valid command is passed raw, also in a batch with typed commands
+	const unknown = `{"type":"unknown"}`
+	replyChans, err := client.RequestBatch(context.Background(), []string{unknown, getAll})
+	assert.NoError(t, err)
+	assert.Equal(t, unknown, <-received)
+	assert.Equal(t, getAll, <-received)
+
+	assert.Equal(t, Reply{Data: "Reply: " + unknown}, <-replyChans[0])
+	getAllReply, err := json.Marshal(replies[models.GetAll])
+	assert.NoError(t, err)
+	assert.Equal(t, Reply{Data: string(getAllReply)}, <-replyChans[1])
+}
+
+// assertRequestData checks the executor got the command, payloads are compared as JSON
+func assertRequestData(t *testing.T, expected models.RequestWrapper, data string) {
+	var actual models.RequestWrapper
+	assert.NoError(t, json.Unmarshal([]byte(data), &actual))
+	assert.Equal(t, expected.Type, actual.Type)
+	assert.Equal(t, expected.RequestID, actual.RequestID)
+	assert.JSONEq(t, string(expected.Payload), string(actual.Payload))
+}
+
+func TestGRPCMQStoppedRequests(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServerGRPC(listener)
+	defer server.Close()
+
+	client := newBufconnClient(t, listener)
+	defer client.Close()
+
+	_, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	assert.NoError(t, server.StopRequests())
+
+	// Test a request sent after StopRequests fails right away instead of waiting forever
+	replyChan, err := client.Request("Late")
+	assert.NoError(t, err)
+
+	select {
+	case reply := <-replyChan:
+		assert.ErrorIs(t, reply.Err, ErrStopped)
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the request to fail")
+	}
+	assert.Equal(t, 0, client.corrMap.len())
+}
@@ -1,23 +1,67 @@
 package mq
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 )
 
+// inprocDeadLetterBuffer is how many dead letters InprocServer keeps until they are read
+const inprocDeadLetterBuffer = 100
+
+// replyReceiver takes replies to the requests it sent to an InprocServer
+type replyReceiver interface {
+	deliverReply(corrID, data string) error
+}
+
+// clientCorrelationIDs maps the correlation IDs a networked server assigns to requests of a client
+// to the IDs the client chose. Clients choose IDs on their own, so they can't be keys of the server-wide map.
+type clientCorrelationIDs struct {
+	ids sync.Map // Server correlation ID -> client correlation ID
+}
+
+// assign returns a new server correlation ID for the request of the client
+func (m *clientCorrelationIDs) assign(clientID string) string {
+	serverID := uuid.New().String()
+	m.ids.Store(serverID, clientID)
+	return serverID
+}
+
+// take returns the client correlation ID of the request and forgets it
+func (m *clientCorrelationIDs) take(serverID string) (string, bool) {
+	clientID, ok := m.ids.LoadAndDelete(serverID)
+	if !ok {
+		return "", false
+	}
+	return clientID.(string), true
+}
+
 // InprocServer is an in-process message queue server
 type InprocServer struct {
 	mu            sync.RWMutex
 	requests      chan Request
-	corrClientMap sync.Map
+	deadLetters   chan DeadLetter
+	corrClientMap sync.Map       // correlationID -> replyReceiver
+	delivering    sync.WaitGroup // Requests taken, but not yet read from requests
+	waiting       atomic.Int64   // Number of requests in delivering
+
+	stopped      chan struct{}
+	stopOnce     sync.Once
+	closed       chan struct{}
+	closeOnce    sync.Once
+	requestsOnce sync.Once
 }
 
 // NewInprocServer is an in-process message queue client
 func NewInprocServer() *InprocServer {
 	return &InprocServer{
-		requests: make(chan Request),
+		requests:    make(chan Request),
+		deadLetters: make(chan DeadLetter, inprocDeadLetterBuffer),
+		stopped:     make(chan struct{}),
+		closed:      make(chan struct{}),
 	}
 }
 
@@ -30,29 +74,155 @@ func (s *InprocServer) ListenForRequests() (<-chan Request, error) {
 
 // Reply sends a reply message to the client
 func (s *InprocServer) Reply(corrID, data string) error {
-	v, ok := s.corrClientMap.Load(corrID)
+	v, ok := s.corrClientMap.LoadAndDelete(corrID)
 	if !ok {
 		return fmt.Errorf("no client for correlation ID %s", corrID)
 	}
-	client := v.(*InprocClient)
-	return client.deliverReply(corrID, data)
+	return v.(replyReceiver).deliverReply(corrID, data)
+}
+
+// DeadLetter passes a copy of the request to the dead-letter channel, it fails if the channel is full
+func (s *InprocServer) DeadLetter(req Request, reason string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	select {
+	case <-s.closed:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case s.deadLetters <- newDeadLetter(req, reason):
+		return nil
+	default:
+		return fmt.Errorf("dead-letter channel is full, dropped request %s", req.CorrelationID)
+	}
+}
+
+// DeadLetters returns the side channel of dead letters, it's closed by Close
+func (s *InprocServer) DeadLetters() <-chan DeadLetter {
+	return s.deadLetters
+}
+
+// Backlog returns the number of requests waiting for a worker
+func (s *InprocServer) Backlog() (int, error) {
+	return int(s.waiting.Load()), nil
+}
+
+// StopRequests makes the server refuse new requests with ErrStopped,
+// the requests channel is closed once the requests already taken are read
+func (s *InprocServer) StopRequests() error {
+	s.stopOnce.Do(func() {
+		s.mu.Lock()
+		close(s.stopped)
+		s.mu.Unlock()
+
+		go func() {
+			s.delivering.Wait()
+			s.closeRequests()
+		}()
+	})
+	return nil
 }
 
 // Close closes the server
 func (s *InprocServer) Close() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.closeOnce.Do(func() {
+		// Unblock senders first
+		close(s.closed)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.delivering.Wait()
+		s.closeRequests()
+		close(s.deadLetters)
+	})
+	return nil
+}
+
+func (s *InprocServer) closeRequests() {
+	s.requestsOnce.Do(func() {
+		close(s.requests)
+	})
+}
+
+func (s *InprocServer) acceptRequest(ctx context.Context, r Request, c replyReceiver) error {
+	s.corrClientMap.Store(r.CorrelationID, c)
+	r.acker = inprocAcker{server: s, request: r}
 
-	close(s.requests)
+	if err := s.deliver(ctx, r); err != nil {
+		s.corrClientMap.Delete(r.CorrelationID)
+		return err
+	}
 	return nil
 }
 
-func (s *InprocServer) acceptRequest(r Request, c *InprocClient) error {
+// deliver passes a request to the workers
+func (s *InprocServer) deliver(ctx context.Context, r Request) error {
+	if err := s.takeRequest(); err != nil {
+		return err
+	}
+	defer func() {
+		s.waiting.Add(-1)
+		s.delivering.Done()
+	}()
+
+	select {
+	case s.requests <- r:
+		return nil
+	case <-s.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// takeRequest registers a request to deliver, unless the server is stopped or closed
+func (s *InprocServer) takeRequest() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	s.corrClientMap.Store(r.CorrelationID, c)
-	s.requests <- r
+	select {
+	case <-s.closed:
+		return ErrClosed
+	default:
+	}
+	select {
+	case <-s.stopped:
+		return ErrStopped
+	default:
+	}
+	s.delivering.Add(1)
+	s.waiting.Add(1)
+	return nil
+}
+
+// inprocAcker puts a rejected request back to the server or dead-letters it, as a broker would
+type inprocAcker struct {
+	server  *InprocServer
+	request Request
+}
+
+func (a inprocAcker) ack() error {
+	return nil
+}
+
+func (a inprocAcker) nack(requeue bool) error {
+	if !requeue {
+		a.server.corrClientMap.Delete(a.request.CorrelationID)
+		return a.server.DeadLetter(a.request, DeadLetterRejected)
+	}
+
+	// Asynchronously, the caller may be the only one reading requests
+	r := a.request
+	r.Redelivered = true
+	r.acker = inprocAcker{server: a.server, request: r}
+	go func() {
+		if err := a.server.deliver(context.Background(), r); err != nil {
+			a.server.corrClientMap.Delete(r.CorrelationID)
+		}
+	}()
 	return nil
 }
 
@@ -60,7 +230,7 @@ func (s *InprocServer) acceptRequest(r Request, c *InprocClient) error {
 type InprocClient struct {
 	mu      sync.RWMutex
 	server  *InprocServer
-	corrMap sync.Map
+	corrMap pendingReplies
 }
 
 // NewInprocClient creates a new in-process client
@@ -69,19 +239,50 @@ func NewInprocClient(server *InprocServer) *InprocClient {
 }
 
 // Request sends a request message to the server
-func (c *InprocClient) Request(data string) (<-chan string, error) {
+func (c *InprocClient) Request(data string) (<-chan Reply, error) {
+	return c.RequestContext(context.Background(), data)
+}
+
+// RequestContext sends a request message to the server, waiting for the reply until ctx is done
+func (c *InprocClient) RequestContext(ctx context.Context, data string) (<-chan Reply, error) {
+	replyChan, deliver := singleReply()
+	if err := c.send(ctx, Request{Data: data}, deliver); err != nil {
+		return nil, err
+	}
+	return replyChan, nil
+}
+
+// RequestBatch sends several requests to the server in one message
+func (c *InprocClient) RequestBatch(ctx context.Context, data []string) ([]<-chan Reply, error) {
+	batch, err := EncodeBatch(data)
+	if err != nil {
+		return nil, err
+	}
+
+	replyChans, deliver := batchReply(len(data))
+	if err := c.send(ctx, Request{Data: batch, Batch: true}, deliver); err != nil {
+		return nil, err
+	}
+	return replyChans, nil
+}
+
+func (c *InprocClient) send(ctx context.Context, req Request, deliver pendingReply) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	corrID := uuid.New().String()
-	replyChan := make(chan string, 1)
-	c.corrMap.Store(corrID, replyChan)
-	req := Request{Data: data, CorrelationID: corrID, ReplyTo: corrID}
-	if err := c.server.acceptRequest(req, c); err != nil {
-		c.corrMap.Delete(corrID)
-		return nil, err
+	c.corrMap.add(ctx, corrID, deliver)
+	req.CorrelationID = corrID
+	req.ReplyTo = corrID
+	if err := c.server.acceptRequest(ctx, req, c); err != nil {
+		c.corrMap.remove(corrID)
+		return err
 	}
-	return replyChan, nil
+	return nil
 }
 
 // Close closes the client
@@ -93,13 +294,6 @@ func (c *InprocClient) Close() error {
 }
 
 func (c *InprocClient) deliverReply(corrID, data string) error {
-	v, ok := c.corrMap.Load(corrID)
-	if !ok {
-		return nil
-	}
-	replyChan := v.(chan string)
-	replyChan <- data
-	close(replyChan)
-	c.corrMap.Delete(corrID)
+	c.corrMap.deliver(corrID, data)
 	return nil
 }
@@ -1,21 +1,92 @@
 package mq
 
 import (
+	"context"
+	"errors"
 	"os"
 )
 
+var (
+	// ErrConnectionLost is the reply error of requests in flight when the connection to the broker is lost
+	ErrConnectionLost = errors.New("connection lost")
+	// ErrNotConnected is returned when a message can't be sent while the connection is being restored
+	ErrNotConnected = errors.New("not connected")
+	// ErrClosed is returned when a message is sent through a closed server or client
+	ErrClosed = errors.New("closed")
+	// ErrStopped is returned when a request is sent to a server which stopped taking requests
+	ErrStopped = errors.New("server stopped taking requests")
+	// ErrUnroutable is the reply error of requests the broker couldn't route to the server queue
+	ErrUnroutable = errors.New("request unroutable")
+	// ErrPublishRejected is the reply error of requests the broker refused to take
+	ErrPublishRejected = errors.New("request rejected by the broker")
+	// ErrInvalidOptions is returned when a server or client is created with inconsistent options
+	ErrInvalidOptions = errors.New("invalid options")
+	// ErrInvalidBatchReply is the reply error of batch requests if the reply doesn't match the batch
+	ErrInvalidBatchReply = errors.New("invalid batch reply")
+	// ErrQueueMismatch is returned when the server queue exists with other arguments, it must be deleted first
+	ErrQueueMismatch = errors.New("queue exists with other arguments")
+)
+
+// replyError is the error of a request failed by a networked server, known errors keep their identity
+func replyError(reason string) error {
+	for _, err := range []error{ErrStopped, ErrClosed} {
+		if reason == err.Error() {
+			return err
+		}
+	}
+	return errors.New(reason)
+}
+
 // Request is the server's view of an incoming message: what data arrived,
 // plus correlation info so we can reply back to the correct client.
 type Request struct {
 	Data          string
 	CorrelationID string
 	ReplyTo       string
+	Batch         bool // Data holds several requests packed by EncodeBatch, the reply must be packed the same way
+	Redelivered   bool // The request was delivered before but not acknowledged
+
+	acker acknowledger // nil if the server doesn't need acknowledgements
+}
+
+// acknowledger settles a delivered request
+type acknowledger interface {
+	ack() error
+	nack(requeue bool) error
+}
+
+// Ack confirms the request is processed, so it's never delivered again
+func (r Request) Ack() error {
+	if r.acker == nil {
+		return nil
+	}
+	return r.acker.ack()
+}
+
+// Nack rejects the request, it's delivered again if requeue is set and dead-lettered otherwise
+func (r Request) Nack(requeue bool) error {
+	if r.acker == nil {
+		return nil
+	}
+	return r.acker.nack(requeue)
+}
+
+// Reply is the client's view of a reply: the data or the reason why the request failed without it
+type Reply struct {
+	Data string
+	Err  error
 }
 
 // ClientMQ is the interface for any message queue client implementation.
 type ClientMQ interface {
 	// Request sends the given data as a request and returns a channel to receive the reply.
-	Request(data string) (<-chan string, error)
+	// The channel receives exactly one Reply and is closed.
+	Request(data string) (<-chan Reply, error)
+	// RequestContext is Request which stops waiting for the reply when ctx is done:
+	// the reply fails with the context error and a late reply is dropped.
+	RequestContext(ctx context.Context, data string) (<-chan Reply, error)
+	// RequestBatch sends several requests in one message and returns a channel per request to receive its reply.
+	RequestBatch(ctx context.Context, data []string) ([]<-chan Reply, error)
 	// Close should close any underlying network connections, channels, etc.
 	Close() error
 }
@@ -23,13 +94,36 @@ type ClientMQ interface {
 // ServerMQ is the interface for any message queue server implementation.
 type ServerMQ interface {
 	// ListenForRequests returns a channel on which the server can read incoming requests.
+	// Every request must be settled with Ack or Nack once it's replied to.
 	ListenForRequests() (<-chan Request, error)
 	// Reply allows the server to send a response for the given correlation ID.
 	Reply(corrID, data string) error
+	// DeadLetter moves a copy of the request which can't be executed to the dead-letter queue.
+	// The request itself still has to be replied to and settled.
+	DeadLetter(req Request, reason string) error
 	// Close closes underlying resources like channels/connections.
 	Close() error
 }
 
+// Prefetcher is implemented by servers which can limit the number of unacknowledged requests
+type Prefetcher interface {
+	// SetPrefetch limits unacknowledged requests delivered at once, it must be called before ListenForRequests
+	SetPrefetch(count int) error
+}
+
+// Backlogger is implemented by servers which can tell how many requests wait to be taken by workers
+type Backlogger interface {
+	// Backlog returns the number of requests waiting to be taken
+	Backlog() (int, error)
+}
+
+// Drainer is implemented by servers which can stop taking requests before they are closed
+type Drainer interface {
+	// StopRequests stops taking new requests. Requests already taken are still passed
+	// to the requests channel, then it's closed, so workers can finish them and exit.
+	StopRequests() error
+}
+
 // GetRabbitMQURL returns the RabbitMQ URL from the environment (RABBITMQ_URL) or a default.
 func GetRabbitMQURL() string {
 	if url := os.Getenv("RABBITMQ_URL"); url != "" {
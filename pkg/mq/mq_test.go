@@ -1,14 +1,34 @@
 package mq
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/MishkaRogachev/command-queue-executor/pkg/amqpfake"
 	"github.com/stretchr/testify/assert"
 )
 
+// pendingRequests returns the number of requests the client still waits replies for
+func pendingRequests(client ClientMQ) int {
+	switch c := client.(type) {
+	case *InprocClient:
+		return c.corrMap.len()
+	case *ClientRabbitMQ:
+		return c.corrMap.len()
+	case *ClientTCP:
+		return c.corrMap.len()
+	case *ClientGRPC:
+		return c.corrMap.len()
+	default:
+		return -1
+	}
+}
+
 func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFactory func() ServerMQ) {
 	t.Run("Single Request-Reply", func(t *testing.T) {
 		server := serverFactory()
@@ -23,6 +43,7 @@ func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFac
 			for req := range reqCh {
 				// The server replies with "Reply: <data>"
 				_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+				_ = req.Ack()
 			}
 		}()
 
@@ -37,7 +58,8 @@ func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFac
 		// Expect "Reply: Test Message"
 		select {
 		case reply := <-replyChan:
-			assert.Equal(t, "Reply: Test Message", reply)
+			assert.NoError(t, reply.Err)
+			assert.Equal(t, "Reply: Test Message", reply.Data)
 		case <-time.After(time.Second):
 			t.Error("Timed out waiting for reply")
 		}
@@ -57,6 +79,7 @@ func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFac
 				for req := range reqCh {
 					// Always respond with "Reply: <data>"
 					_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+					_ = req.Ack()
 				}
 			}(i)
 		}
@@ -80,7 +103,7 @@ func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFac
 				select {
 				case reply := <-replyChan:
 					expected := "Reply: " + message
-					assert.Equal(t, expected, reply)
+					assert.Equal(t, Reply{Data: expected}, reply)
 				case <-time.After(time.Second):
 					t.Errorf("Timed out waiting for reply to %s", message)
 				}
@@ -89,6 +112,252 @@ func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFac
 		wg.Wait()
 	})
 
+	t.Run("Batch Request-Reply", func(t *testing.T) {
+		server := serverFactory()
+		defer server.Close()
+
+		reqCh, err := server.ListenForRequests()
+		assert.NoError(t, err)
+
+		go func() {
+			for req := range reqCh {
+				if !req.Batch {
+					_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+					_ = req.Ack()
+					continue
+				}
+
+				// Unpack the batch and reply to every request in one message
+				messages, err := DecodeBatch(req.Data)
+				assert.NoError(t, err)
+				replies := make([]string, len(messages))
+				for i, message := range messages {
+					replies[i] = "Reply: " + message
+				}
+				reply, err := EncodeBatch(replies)
+				assert.NoError(t, err)
+				_ = server.Reply(req.CorrelationID, reply)
+				_ = req.Ack()
+			}
+		}()
+
+		client := clientFactory()
+		defer client.Close()
+
+		messages := []string{"Message 0", "Message 1", "Message 2"}
+		replyChans, err := client.RequestBatch(context.Background(), messages)
+		assert.NoError(t, err)
+		assert.Len(t, replyChans, len(messages))
+
+		for i, replyChan := range replyChans {
+			select {
+			case reply := <-replyChan:
+				assert.Equal(t, Reply{Data: "Reply: " + messages[i]}, reply)
+			case <-time.After(time.Second):
+				t.Errorf("Timed out waiting for reply to %s", messages[i])
+			}
+		}
+	})
+
+	t.Run("Timed Out Requests", func(t *testing.T) {
+		server := serverFactory()
+		defer server.Close()
+
+		reqCh, err := server.ListenForRequests()
+		assert.NoError(t, err)
+
+		// Reply to every other request too late, ignore the rest.
+		// Networked servers get requests after the client sent them, so they are counted on both sides.
+		var replies sync.WaitGroup
+		var sent, received atomic.Int64
+		go func() {
+			ignore := false
+			for req := range reqCh {
+				ignore = !ignore
+				if ignore {
+					_ = req.Ack()
+					received.Add(1)
+					continue
+				}
+				reply := "Reply: " + req.Data
+				if req.Batch {
+					reply, _ = EncodeBatch([]string{"Reply: Message", "Reply: Message"})
+				}
+				replies.Add(1)
+				received.Add(1)
+				time.AfterFunc(10*time.Millisecond, func() {
+					defer replies.Done()
+					_ = server.Reply(req.CorrelationID, reply)
+					_ = req.Ack()
+				})
+			}
+		}()
+
+		client := clientFactory()
+		defer client.Close()
+
+		const requestCount = 2000
+		var wg sync.WaitGroup
+		for i := 0; i < requestCount; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+				defer cancel()
+
+				var replyChans []<-chan Reply
+				var err error
+				if i%2 == 0 {
+					var replyChan <-chan Reply
+					replyChan, err = client.RequestContext(ctx, "Message")
+					replyChans = append(replyChans, replyChan)
+				} else {
+					replyChans, err = client.RequestBatch(ctx, []string{"Message", "Message"})
+				}
+				if err != nil {
+					assert.ErrorIs(t, err, context.DeadlineExceeded)
+					return
+				}
+				sent.Add(1)
+
+				// The requests fail once the deadline passes, unless the reply wins the race
+				for _, replyChan := range replyChans {
+					select {
+					case reply := <-replyChan:
+						if reply.Err != nil {
+							assert.ErrorIs(t, reply.Err, context.DeadlineExceeded)
+						} else {
+							assert.Equal(t, "Reply: Message", reply.Data)
+						}
+					case <-time.After(time.Second):
+						t.Error("Reply channel was not closed on deadline")
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		assert.Equal(t, 0, pendingRequests(client))
+
+		// Late replies are dropped
+		assert.Eventually(t, func() bool {
+			return received.Load() == sent.Load()
+		}, time.Second, time.Millisecond)
+		replies.Wait()
+		assert.Equal(t, 0, pendingRequests(client))
+
+		// Test a cancelled context
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = client.RequestContext(ctx, "Message")
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 0, pendingRequests(client))
+	})
+
+	t.Run("Requeue", func(t *testing.T) {
+		server := serverFactory()
+		defer server.Close()
+
+		reqCh, err := server.ListenForRequests()
+		assert.NoError(t, err)
+
+		// Reject the first delivery of every request, reply to the redelivered one
+		go func() {
+			for req := range reqCh {
+				if !req.Redelivered {
+					assert.NoError(t, req.Nack(true))
+					continue
+				}
+				_ = server.Reply(req.CorrelationID, "Redelivered: "+req.Data)
+				assert.NoError(t, req.Ack())
+			}
+		}()
+
+		client := clientFactory()
+		defer client.Close()
+
+		replyChan, err := client.Request("Message")
+		assert.NoError(t, err)
+
+		select {
+		case reply := <-replyChan:
+			assert.Equal(t, Reply{Data: "Redelivered: Message"}, reply)
+		case <-time.After(time.Second):
+			t.Error("Timed out waiting for reply")
+		}
+	})
+
+	t.Run("Stop Requests", func(t *testing.T) {
+		server := serverFactory()
+		defer server.Close()
+
+		reqCh, err := server.ListenForRequests()
+		assert.NoError(t, err)
+
+		// Take one request and hold it, in-process clients send until a worker takes the request
+		taken := make(chan Request, 1)
+		go func() {
+			taken <- <-reqCh
+		}()
+
+		client := clientFactory()
+		defer client.Close()
+
+		replyChan, err := client.Request("Taken")
+		assert.NoError(t, err)
+
+		var req Request
+		select {
+		case req = <-taken:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for request")
+		}
+
+		// Test the requests channel is closed, but the request taken before can still be replied to
+		assert.NoError(t, server.(Drainer).StopRequests())
+		assert.NoError(t, server.(Drainer).StopRequests())
+		select {
+		case _, ok := <-reqCh:
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			t.Error("Requests channel wasn't closed")
+		}
+
+		assert.NoError(t, server.Reply(req.CorrelationID, "Reply: "+req.Data))
+		assert.NoError(t, req.Ack())
+		select {
+		case reply := <-replyChan:
+			assert.Equal(t, Reply{Data: "Reply: Taken"}, reply)
+		case <-time.After(time.Second):
+			t.Error("Timed out waiting for reply")
+		}
+	})
+
+	t.Run("Backlog", func(t *testing.T) {
+		server := serverFactory()
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Nothing reads the requests, some transports take one request per client at a time
+		for i := 0; i < 3; i++ {
+			client := clientFactory()
+			defer client.Close()
+			go func() {
+				_, _ = client.RequestContext(ctx, "Waiting")
+			}()
+		}
+
+		assert.Eventually(t, func() bool {
+			backlog, err := server.(Backlogger).Backlog()
+			return err == nil && backlog >= 3
+		}, 2*time.Second, 10*time.Millisecond)
+
+		// Give up the requests before the server is closed
+		cancel()
+	})
+
 	t.Run("Multiple Clients", func(t *testing.T) {
 		server := serverFactory()
 		defer server.Close()
@@ -101,6 +370,7 @@ func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFac
 			for req := range reqCh {
 				// Reply with "Reply: <data>"
 				_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+				_ = req.Ack()
 			}
 		}()
 
@@ -128,7 +398,7 @@ func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFac
 				select {
 				case reply := <-replyChan:
 					expected := "Reply: " + message
-					assert.Equal(t, expected, reply)
+					assert.Equal(t, Reply{Data: expected}, reply)
 				case <-time.After(time.Second):
 					t.Errorf("Timed out waiting for reply from Client %d", clientID)
 				}
@@ -138,9 +408,25 @@ func runMessageQueueTests(t *testing.T, clientFactory func() ClientMQ, serverFac
 	})
 }
 
+// testRabbitMQURL returns RABBITMQ_URL if it's set, otherwise starts a fake broker for the test
+func testRabbitMQURL(t *testing.T) string {
+	if url := os.Getenv("RABBITMQ_URL"); url != "" {
+		return url
+	}
+
+	broker, err := amqpfake.NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start fake broker: %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return broker.URL()
+}
+
 func TestRabbitMQ(t *testing.T) {
+	url := testRabbitMQURL(t)
+
 	serverFactory := func() ServerMQ {
-		server, err := NewServerRabbitMQ(GetRabbitMQURL(), "test-exchange")
+		server, err := NewServerRabbitMQ(url, "test-exchange")
 		if err != nil {
 			t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
 		}
@@ -148,7 +434,7 @@ func TestRabbitMQ(t *testing.T) {
 	}
 
 	clientFactory := func() ClientMQ {
-		client, err := NewClientRabbitMQ(GetRabbitMQURL(), "test-exchange")
+		client, err := NewClientRabbitMQ(url, "test-exchange")
 		if err != nil {
 			t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
 		}
@@ -172,3 +458,36 @@ func TestInprocMQ(t *testing.T) {
 
 	runMessageQueueTests(t, clientFactory, serverFactory)
 }
+
+func TestInprocMQRepliesReleaseRequests(t *testing.T) {
+	server := NewInprocServer()
+	defer server.Close()
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+
+	go func() {
+		for req := range reqCh {
+			_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+			_ = req.Ack()
+		}
+	}()
+
+	client := NewInprocClient(server)
+	defer client.Close()
+
+	for i := 0; i < 100; i++ {
+		replyChan, err := client.Request(fmt.Sprintf("Message %d", i))
+		assert.NoError(t, err)
+		assert.Equal(t, Reply{Data: fmt.Sprintf("Reply: Message %d", i)}, <-replyChan)
+	}
+
+	// Test neither the client nor the server keep replied requests
+	assert.Equal(t, 0, client.corrMap.len())
+	serverEntries := 0
+	server.corrClientMap.Range(func(_, _ any) bool {
+		serverEntries++
+		return true
+	})
+	assert.Equal(t, 0, serverEntries)
+}
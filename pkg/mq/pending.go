@@ -0,0 +1,94 @@
+package mq
+
+import (
+	"context"
+	"sync"
+)
+
+// pendingReply delivers a reply to whoever waits for it, or the error if the request failed without a reply
+type pendingReply func(data string, err error)
+
+// singleReply creates a reply channel for one request
+func singleReply() (<-chan Reply, pendingReply) {
+	replyChan := make(chan Reply, 1)
+	return replyChan, func(data string, err error) {
+		replyChan <- Reply{Data: data, Err: err}
+		close(replyChan)
+	}
+}
+
+type pendingEntry struct {
+	deliver pendingReply
+
+	mu   sync.Mutex // Guards stop, which is set after the entry is visible to deliver
+	stop func() bool
+}
+
+// pendingReplies tracks requests waiting for replies by correlation ID.
+// A request is dropped once its context is done, so late replies are ignored.
+type pendingReplies struct {
+	entries sync.Map // correlationID -> *pendingEntry
+}
+
+// add registers a request, it fails with the context error when ctx is done
+func (p *pendingReplies) add(ctx context.Context, corrID string, deliver pendingReply) {
+	entry := &pendingEntry{deliver: deliver}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	p.entries.Store(corrID, entry)
+	entry.stop = context.AfterFunc(ctx, func() {
+		if _, ok := p.entries.LoadAndDelete(corrID); ok {
+			deliver("", context.Cause(ctx))
+		}
+	})
+}
+
+// deliver passes the reply to the request waiting for it, if any
+func (p *pendingReplies) deliver(corrID, data string) {
+	p.settle(corrID, data, nil)
+}
+
+// fail fails the request waiting for a reply with err, if any
+func (p *pendingReplies) fail(corrID string, err error) {
+	p.settle(corrID, "", err)
+}
+
+// failAll fails all pending requests with err
+func (p *pendingReplies) failAll(err error) {
+	p.entries.Range(func(corrID, _ any) bool {
+		p.settle(corrID.(string), "", err)
+		return true
+	})
+}
+
+func (p *pendingReplies) settle(corrID, data string, err error) {
+	if v, ok := p.entries.LoadAndDelete(corrID); ok {
+		entry := v.(*pendingEntry)
+		entry.stopWatching()
+		entry.deliver(data, err)
+	}
+}
+
+// remove drops a request which couldn't be sent
+func (p *pendingReplies) remove(corrID string) {
+	if v, ok := p.entries.LoadAndDelete(corrID); ok {
+		v.(*pendingEntry).stopWatching()
+	}
+}
+
+// len returns the number of requests waiting for replies
+func (p *pendingReplies) len() int {
+	count := 0
+	p.entries.Range(func(_, _ any) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+func (e *pendingEntry) stopWatching() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stop()
+}
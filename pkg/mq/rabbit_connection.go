@@ -0,0 +1,188 @@
+package mq
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Delays between reconnection attempts, they grow exponentially from the min to the max
+const (
+	reconnectMinDelay = 100 * time.Millisecond
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// rabbitSetup prepares a fresh connection: opens channels, declares queues and subscribes.
+// Closing any of the returned channels restarts the connection.
+type rabbitSetup func(conn *amqp091.Connection) ([]*amqp091.Channel, error)
+
+// rabbitConnection keeps a connection to RabbitMQ. When the connection or one of its channels is lost,
+// it reconnects with exponential backoff and jitter and runs the setup again.
+type rabbitConnection struct {
+	url    string
+	config amqp091.Config
+	setup  rabbitSetup
+	onLost func(err error) // Called when the connection is lost, before reconnecting
+
+	mu   sync.Mutex
+	conn *amqp091.Connection
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// defaultRabbitConfig is the config amqp091.Dial uses
+func defaultRabbitConfig() amqp091.Config {
+	return amqp091.Config{Locale: "en_US"}
+}
+
+// dialRabbitMQ connects to RabbitMQ and runs the setup, then keeps the connection until Close
+func dialRabbitMQ(url string, config amqp091.Config, setup rabbitSetup, onLost func(err error)) (*rabbitConnection, error) {
+	rc := &rabbitConnection{
+		url:    url,
+		config: config,
+		setup:  setup,
+		onLost: onLost,
+		closed: make(chan struct{}),
+	}
+
+	conn, channels, err := rc.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	rc.wg.Add(1)
+	go rc.supervise(conn, channels)
+	return rc, nil
+}
+
+// Close closes the connection and stops reconnecting
+func (rc *rabbitConnection) Close() error {
+	rc.closeOnce.Do(func() {
+		close(rc.closed)
+	})
+
+	rc.mu.Lock()
+	conn := rc.conn
+	rc.conn = nil
+	rc.mu.Unlock()
+
+	var err error
+	if conn != nil {
+		err = conn.Close()
+	}
+	rc.wg.Wait()
+	return err
+}
+
+func (rc *rabbitConnection) connect() (*amqp091.Connection, []*amqp091.Channel, error) {
+	conn, err := amqp091.DialConfig(rc.url, rc.config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	channels, err := rc.setup(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	select {
+	case <-rc.closed:
+		conn.Close()
+		return nil, nil, ErrNotConnected
+	default:
+	}
+	rc.conn = conn
+	return conn, channels, nil
+}
+
+func (rc *rabbitConnection) supervise(conn *amqp091.Connection, channels []*amqp091.Channel) {
+	defer rc.wg.Done()
+
+	for {
+		err := rc.waitForLoss(conn, channels)
+		if err == nil {
+			return
+		}
+
+		log.Printf("RabbitMQ connection lost: %v", err)
+		rc.onLost(err)
+
+		conn, channels = rc.reconnect()
+		if conn == nil {
+			return
+		}
+	}
+}
+
+// waitForLoss blocks until the connection or one of the channels is closed.
+// Returns nil if the connection was closed by Close.
+func (rc *rabbitConnection) waitForLoss(conn *amqp091.Connection, channels []*amqp091.Channel) error {
+	connClosed := conn.NotifyClose(make(chan *amqp091.Error, 1))
+	channelClosed := make(chan *amqp091.Error, len(channels))
+	for _, ch := range channels {
+		notify := ch.NotifyClose(make(chan *amqp091.Error, 1))
+		go func() {
+			channelClosed <- <-notify
+		}()
+	}
+
+	var amqpErr *amqp091.Error
+	select {
+	case amqpErr = <-connClosed:
+	case amqpErr = <-channelClosed:
+	case <-rc.closed:
+		return nil
+	}
+
+	select {
+	case <-rc.closed:
+		return nil
+	default:
+	}
+
+	// A failed channel restarts the whole connection, so the setup runs from scratch
+	conn.Close()
+	if amqpErr != nil {
+		return amqpErr
+	}
+	return ErrConnectionLost
+}
+
+// reconnect connects again until it succeeds, returns nil if the connection was closed meanwhile
+func (rc *rabbitConnection) reconnect() (*amqp091.Connection, []*amqp091.Channel) {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-time.After(reconnectDelay(attempt, reconnectMinDelay, reconnectMaxDelay)):
+		case <-rc.closed:
+			return nil, nil
+		}
+
+		conn, channels, err := rc.connect()
+		if err == nil {
+			log.Printf("Reconnected to RabbitMQ after %d attempts", attempt+1)
+			return conn, channels
+		}
+		log.Printf("Failed to reconnect to RabbitMQ: %v", err)
+	}
+}
+
+// reconnectDelay returns the delay before an attempt: it doubles every attempt up to maxDelay,
+// then a random half of it is taken off, so clients don't reconnect all at once
+func reconnectDelay(attempt int, minDelay, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if attempt < 32 && minDelay<<attempt < maxDelay {
+		delay = minDelay << attempt
+	}
+	half := delay / 2
+	return delay - half + rand.N(half+1)
+}
@@ -0,0 +1,326 @@
+package mq
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/amqpfake"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// killableDialer records network connections made by amqp091, so tests can break them
+type killableDialer struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (d *killableDialer) config() amqp091.Config {
+	config := defaultRabbitConfig()
+	config.Dial = func(network, addr string) (net.Conn, error) {
+		conn, err := amqp091.DefaultDial(time.Second)(network, addr)
+		if err == nil {
+			d.mu.Lock()
+			d.conns = append(d.conns, conn)
+			d.mu.Unlock()
+		}
+		return conn, err
+	}
+	return config
+}
+
+// kill breaks all recorded connections as if the network went down
+func (d *killableDialer) kill() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+	d.conns = nil
+}
+
+func TestReconnectDelay(t *testing.T) {
+	minDelay, maxDelay := 100*time.Millisecond, 2*time.Second
+	for attempt := 0; attempt < 100; attempt++ {
+		expected := maxDelay
+		if attempt < 5 {
+			expected = minDelay << attempt
+		}
+
+		delay := reconnectDelay(attempt, minDelay, maxDelay)
+		assert.GreaterOrEqual(t, delay, expected/2, attempt)
+		assert.LessOrEqual(t, delay, expected, attempt)
+	}
+}
+
+func TestRabbitMQReconnect(t *testing.T) {
+	const queue = "test-reconnect"
+
+	url := testRabbitMQURL(t)
+	var serverDialer, clientDialer killableDialer
+	server, err := newServerRabbitMQ(url, queue, RabbitMQOptions{}, serverDialer.config())
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+	}
+	defer server.Close()
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+
+	// Requests named "hold" are never answered
+	go func() {
+		for req := range reqCh {
+			if req.Data != "hold" {
+				_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+				_ = req.Ack()
+			}
+		}
+	}()
+
+	client, err := newClientRabbitMQ(url, queue, RabbitMQOptions{}, clientDialer.config())
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+	}
+	defer client.Close()
+
+	// awaitReply retries the request until the connection is restored
+	awaitReply := func(data string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			replyChan, err := client.Request(data)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrNotConnected)
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+
+			select {
+			case reply := <-replyChan:
+				if reply.Err == nil {
+					assert.Equal(t, "Reply: "+data, reply.Data)
+					return
+				}
+			case <-time.After(time.Second):
+			}
+		}
+		t.Errorf("No reply to %s after reconnection", data)
+	}
+
+	awaitReply("before")
+
+	// Test requests in flight fail right away when the client connection is lost
+	replyChan, err := client.Request("hold")
+	assert.NoError(t, err)
+	clientDialer.kill()
+
+	select {
+	case reply := <-replyChan:
+		assert.ErrorIs(t, reply.Err, ErrConnectionLost)
+	case <-time.After(time.Second):
+		t.Error("Request in flight didn't fail on connection loss")
+	}
+	awaitReply("after client reconnection")
+
+	// Test the server consumes its queue again after reconnection
+	serverDialer.kill()
+	awaitReply("after server reconnection")
+}
+
+func TestRabbitMQBrokerFaults(t *testing.T) {
+	const queue = "test-broker-faults"
+
+	broker, err := amqpfake.NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start fake broker: %v", err)
+	}
+	defer broker.Close()
+
+	server, err := NewServerRabbitMQ(broker.URL(), queue)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+	}
+	defer server.Close()
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+
+	// Requests named "hold" are never answered
+	go func() {
+		for req := range reqCh {
+			if req.Data != "hold" {
+				_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+			}
+			_ = req.Ack()
+		}
+	}()
+
+	client, err := NewClientRabbitMQ(broker.URL(), queue)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+	}
+	defer client.Close()
+
+	// Test a request whose reply is lost times out and is forgotten
+	broker.DropFrames(func(f amqpfake.FrameInfo) bool {
+		return f.Direction == amqpfake.ToClient && f.Method == "basic.deliver"
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	replyChan, err := client.RequestContext(ctx, "lost")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, (<-replyChan).Err, context.DeadlineExceeded)
+	assert.Equal(t, 0, pendingRequests(client))
+	broker.DropFrames(nil)
+
+	// Test requests in flight fail when the broker drops connections, then both sides reconnect
+	replyChan, err = client.Request("hold")
+	assert.NoError(t, err)
+	assert.Positive(t, broker.KillConnections())
+
+	select {
+	case reply := <-replyChan:
+		assert.ErrorIs(t, reply.Err, ErrConnectionLost)
+	case <-time.After(time.Second):
+		t.Error("Request in flight didn't fail on connection loss")
+	}
+
+	assert.Eventually(t, func() bool {
+		replyChan, err := client.Request("after reconnection")
+		if err != nil {
+			return false
+		}
+		select {
+		case reply := <-replyChan:
+			return reply.Err == nil && reply.Data == "Reply: after reconnection"
+		case <-time.After(time.Second):
+			return false
+		}
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestRabbitMQServerForgetsUnansweredRequests(t *testing.T) {
+	const queue = "test-unanswered"
+
+	broker, err := amqpfake.NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start fake broker: %v", err)
+	}
+	defer broker.Close()
+
+	server, err := NewServerRabbitMQ(broker.URL(), queue)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+	}
+	defer server.Close()
+
+	replyToQueues := func() int {
+		count := 0
+		server.replyToMap.Range(func(_, _ any) bool {
+			count++
+			return true
+		})
+		return count
+	}
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+
+	// Requests named "reject" are dead-lettered, the others are held without an answer
+	received := make(chan string)
+	go func() {
+		for req := range reqCh {
+			if req.Data == "reject" {
+				assert.NoError(t, req.Nack(false))
+			}
+			received <- req.Data
+		}
+	}()
+
+	client, err := NewClientRabbitMQ(broker.URL(), queue)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+	}
+	defer client.Close()
+
+	// Test a rejected request doesn't keep its reply-to queue
+	_, err = client.Request("reject")
+	assert.NoError(t, err)
+	assert.Equal(t, "reject", <-received)
+	assert.Equal(t, 0, replyToQueues())
+
+	// Test the reply-to queues of unacknowledged requests are forgotten on connection loss
+	_, err = client.Request("hold")
+	assert.NoError(t, err)
+	assert.Equal(t, "hold", <-received)
+	assert.Equal(t, 1, replyToQueues())
+
+	// Stop consuming first, so the held request isn't redelivered to the server after reconnection
+	assert.NoError(t, server.StopRequests())
+	assert.Positive(t, broker.KillConnections())
+	assert.Eventually(t, func() bool {
+		return replyToQueues() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRabbitMQServerBacklogChannel(t *testing.T) {
+	const queue = "test-backlog-channel"
+
+	broker, err := amqpfake.NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start fake broker: %v", err)
+	}
+	defer broker.Close()
+
+	server, err := NewServerRabbitMQ(broker.URL(), queue)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+	}
+	defer server.Close()
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	go func() {
+		for req := range reqCh {
+			_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+			_ = req.Ack()
+		}
+	}()
+
+	backlog, err := server.Backlog()
+	assert.NoError(t, err)
+	assert.Zero(t, backlog)
+
+	// Test the backlog is polled on its own channel, which is reopened once it's closed
+	server.mu.RLock()
+	consumed := server.channel
+	server.mu.RUnlock()
+	assert.NotSame(t, consumed, server.backlogChannel)
+	assert.NoError(t, server.backlogChannel.Close())
+
+	_, err = server.Backlog()
+	assert.NoError(t, err)
+
+	client, err := NewClientRabbitMQ(broker.URL(), queue)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+	}
+	defer client.Close()
+
+	// Test requests are still consumed on the same channel
+	replyChan, err := client.Request("Message")
+	assert.NoError(t, err)
+	select {
+	case reply := <-replyChan:
+		assert.Equal(t, Reply{Data: "Reply: Message"}, reply)
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for reply")
+	}
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	assert.Same(t, consumed, server.channel)
+}
@@ -0,0 +1,68 @@
+package mq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Queue types of the server queue
+const (
+	QueueTypeClassic = "classic"
+	QueueTypeQuorum  = "quorum" // Replicated queue, it must be durable
+)
+
+// RabbitMQOptions configure the server queue and the requests published to it.
+// The zero value is a transient classic queue with transient requests.
+// Servers and clients of a queue should use the same options: the broker refuses to declare
+// an existing queue with different ones.
+type RabbitMQOptions struct {
+	Durable    bool          // The server queue and its dead-letter queue survive broker restarts
+	Persistent bool          // Requests are stored on disk, so pending ones survive restarts of a durable queue
+	MaxLength  int           // Requests waiting in the queue, the oldest are dead-lettered over it, unlimited if zero
+	MessageTTL time.Duration // Requests waiting longer are dead-lettered, no limit if zero
+	QueueType  string        // QueueTypeClassic or QueueTypeQuorum, the broker default if empty
+}
+
+func (o RabbitMQOptions) validate() error {
+	switch o.QueueType {
+	case "", QueueTypeClassic:
+	case QueueTypeQuorum:
+		if !o.Durable {
+			return fmt.Errorf("%w: quorum queues must be durable", ErrInvalidOptions)
+		}
+	default:
+		return fmt.Errorf("%w: unknown queue type %q", ErrInvalidOptions, o.QueueType)
+	}
+	if o.MaxLength < 0 {
+		return fmt.Errorf("%w: negative max length", ErrInvalidOptions)
+	}
+	if o.MessageTTL < 0 {
+		return fmt.Errorf("%w: negative message TTL", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// queueArgs are the arguments of the server queue
+func (o RabbitMQOptions) queueArgs(routingKey string) amqp091.Table {
+	args := amqp091.Table{"x-dead-letter-exchange": deadLetterExchangeName(routingKey)}
+	if o.MaxLength > 0 {
+		args["x-max-length"] = int64(o.MaxLength)
+	}
+	if o.MessageTTL > 0 {
+		args["x-message-ttl"] = o.MessageTTL.Milliseconds()
+	}
+	if o.QueueType != "" {
+		args["x-queue-type"] = o.QueueType
+	}
+	return args
+}
+
+// deliveryMode is the delivery mode of requests
+func (o RabbitMQOptions) deliveryMode() uint8 {
+	if o.Persistent {
+		return amqp091.Persistent
+	}
+	return amqp091.Transient
+}
@@ -0,0 +1,173 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/amqpfake"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRabbitMQOptionsValidate(t *testing.T) {
+	assert.NoError(t, RabbitMQOptions{}.validate())
+	assert.NoError(t, RabbitMQOptions{Durable: true, QueueType: QueueTypeQuorum}.validate())
+	assert.ErrorIs(t, RabbitMQOptions{QueueType: QueueTypeQuorum}.validate(), ErrInvalidOptions)
+	assert.ErrorIs(t, RabbitMQOptions{QueueType: "stream"}.validate(), ErrInvalidOptions)
+	assert.ErrorIs(t, RabbitMQOptions{MaxLength: -1}.validate(), ErrInvalidOptions)
+	assert.ErrorIs(t, RabbitMQOptions{MessageTTL: -time.Second}.validate(), ErrInvalidOptions)
+
+	assert.Equal(t, amqp091.Table{
+		"x-dead-letter-exchange": "rpc.dlx",
+		"x-max-length":           int64(10),
+		"x-message-ttl":          int64(1500),
+		"x-queue-type":           QueueTypeQuorum,
+	}, RabbitMQOptions{MaxLength: 10, MessageTTL: 1500 * time.Millisecond, QueueType: QueueTypeQuorum}.queueArgs("rpc"))
+}
+
+func TestRabbitMQDurableQueue(t *testing.T) {
+	const queue = "test-durable"
+
+	broker, err := amqpfake.NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start fake broker: %v", err)
+	}
+	defer broker.Close()
+
+	options := RabbitMQOptions{Durable: true, Persistent: true, MaxLength: 2, QueueType: QueueTypeQuorum}
+
+	// The server declares the queue, but doesn't consume it
+	server, err := NewServerRabbitMQWithOptions(broker.URL(), queue, options)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+	}
+	defer server.Close()
+
+	client, err := NewClientRabbitMQWithOptions(broker.URL(), queue, options)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	for _, data := range []string{"first", "second", "third"} {
+		_, err := client.RequestContext(ctx, data)
+		assert.NoError(t, err)
+	}
+
+	conn, err := amqp091.Dial(broker.URL())
+	if err != nil {
+		t.Fatalf("Failed to connect to fake broker: %v", err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatalf("Failed to open channel: %v", err)
+	}
+
+	// Test the queue keeps the newest requests as persistent messages
+	for _, data := range []string{"second", "third"} {
+		d, ok, err := ch.Get(queue, true)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, data, string(d.Body))
+		assert.Equal(t, amqp091.Persistent, d.DeliveryMode)
+	}
+
+	// Test the oldest request overflowed to the dead-letter queue
+	dlq, err := NewDeadLetterQueueRabbitMQWithOptions(broker.URL(), queue, options)
+	if err != nil {
+		t.Fatalf("Failed to open dead-letter queue: %v", err)
+	}
+	defer dlq.Close()
+
+	letters, err := dlq.List()
+	assert.NoError(t, err)
+	if assert.Len(t, letters, 1) {
+		assert.Equal(t, "first", letters[0].Data)
+		assert.Equal(t, "maxlen", letters[0].Reason)
+	}
+
+	// Test the broker refuses the queue with other options
+	_, err = ch.QueueDeclare(queue, false, false, false, false, nil)
+	assert.Error(t, err)
+}
+
+func TestRabbitMQMessageTTL(t *testing.T) {
+	const queue = "test-ttl"
+
+	broker, err := amqpfake.NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start fake broker: %v", err)
+	}
+	defer broker.Close()
+
+	options := RabbitMQOptions{MessageTTL: 20 * time.Millisecond}
+
+	server, err := NewServerRabbitMQWithOptions(broker.URL(), queue, options)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ server: %v", err)
+	}
+	defer server.Close()
+
+	client, err := NewClientRabbitMQWithOptions(broker.URL(), queue, options)
+	if err != nil {
+		t.Fatalf("Failed to initialize RabbitMQ client: %v", err)
+	}
+	defer client.Close()
+
+	dlq, err := NewDeadLetterQueueRabbitMQWithOptions(broker.URL(), queue, options)
+	if err != nil {
+		t.Fatalf("Failed to open dead-letter queue: %v", err)
+	}
+	defer dlq.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	replyChan, err := client.RequestContext(ctx, "stale")
+	assert.NoError(t, err)
+
+	// Test the request nobody consumed expires to the dead-letter queue
+	assert.Eventually(t, func() bool {
+		letters, err := dlq.List()
+		return err == nil && len(letters) == 1 && letters[0].Data == "stale" && letters[0].Reason == "expired"
+	}, time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, (<-replyChan).Err, context.DeadlineExceeded)
+}
+
+func TestRabbitMQQueueMismatch(t *testing.T) {
+	const queue = "test-legacy"
+
+	broker, err := amqpfake.NewBroker()
+	if err != nil {
+		t.Fatalf("Failed to start fake broker: %v", err)
+	}
+	defer broker.Close()
+
+	// The queue was declared without a dead-letter exchange, as by versions before dead letters
+	conn, err := amqp091.Dial(broker.URL())
+	if err != nil {
+		t.Fatalf("Failed to connect to fake broker: %v", err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatalf("Failed to open channel: %v", err)
+	}
+	_, err = ch.QueueDeclare(queue, false, false, false, false, nil)
+	assert.NoError(t, err)
+
+	// Test the server tells the queue must be deleted
+	_, err = NewServerRabbitMQ(broker.URL(), queue)
+	assert.ErrorIs(t, err, ErrQueueMismatch)
+	assert.ErrorContains(t, err, `delete queue "test-legacy"`)
+
+	// Test the server starts once the queue is deleted
+	_, err = ch.QueueDelete(queue, false, false, false)
+	assert.NoError(t, err)
+	server, err := NewServerRabbitMQ(broker.URL(), queue)
+	assert.NoError(t, err)
+	assert.NoError(t, server.Close())
+}
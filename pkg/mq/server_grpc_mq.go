@@ -0,0 +1,247 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/MishkaRogachev/command-queue-executor/pkg/mq/executorpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// ServerGRPC implements ServerMQ as the gRPC Executor service, so other services call the executor through a typed RPC.
+// Requests of all streams are queued in the process as by InprocServer,
+// so the ones not replied to are lost when the server stops.
+type ServerGRPC struct {
+	server *grpc.Server
+	queue  *InprocServer
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	serving   sync.WaitGroup
+}
+
+// NewServerGRPC creates a server serving the executor service on the listener with the gRPC options
+func NewServerGRPC(listener net.Listener, opts ...grpc.ServerOption) *ServerGRPC {
+	s := &ServerGRPC{
+		server: grpc.NewServer(opts...),
+		queue:  NewInprocServer(),
+		closed: make(chan struct{}),
+	}
+
+	executorpb.RegisterExecutorServer(s.server, grpcExecutor{server: s})
+
+	s.serving.Add(1)
+	go func() {
+		defer s.serving.Done()
+		if err := s.server.Serve(listener); err != nil {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+	return s
+}
+
+// ListenForRequests returns a channel that the user can read from in worker goroutines
+func (s *ServerGRPC) ListenForRequests() (<-chan Request, error) {
+	return s.queue.ListenForRequests()
+}
+
+// Reply sends the response to the stream the request came from
+func (s *ServerGRPC) Reply(corrID, data string) error {
+	return s.queue.Reply(corrID, data)
+}
+
+// DeadLetter passes a copy of the request to the dead-letter channel, it fails if the channel is full
+func (s *ServerGRPC) DeadLetter(req Request, reason string) error {
+	return s.queue.DeadLetter(req, reason)
+}
+
+// Backlog returns the number of requests waiting for a worker
+func (s *ServerGRPC) Backlog() (int, error) {
+	return s.queue.Backlog()
+}
+
+// StopRequests makes the server drop new requests, the requests channel is closed once the ones taken are read
+func (s *ServerGRPC) StopRequests() error {
+	return s.queue.StopRequests()
+}
+
+// DeadLetters returns the side channel of dead letters, it's closed by Close
+func (s *ServerGRPC) DeadLetters() <-chan DeadLetter {
+	return s.queue.DeadLetters()
+}
+
+// Close stops the gRPC server, cancels all streams and closes the requests channel
+func (s *ServerGRPC) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		// Unblock streams waiting for a worker first
+		s.queue.Close()
+		s.server.Stop()
+		s.serving.Wait()
+	})
+	return nil
+}
+
+// grpcExecutor serves the Executor service of a ServerGRPC
+type grpcExecutor struct {
+	executorpb.UnimplementedExecutorServer
+	server *ServerGRPC
+}
+
+func (e grpcExecutor) Exchange(stream grpc.BidiStreamingServer[executorpb.ExchangeRequest, executorpb.ExchangeReply]) error {
+	return e.server.exchange(stream)
+}
+
+// exchange queues requests of the stream, the stream is kept until the client or the server closes it,
+// so the replies can still be sent after the client is done sending
+func (s *ServerGRPC) exchange(stream grpc.BidiStreamingServer[executorpb.ExchangeRequest, executorpb.ExchangeReply]) error {
+	receiver := &grpcStreamReceiver{stream: stream}
+	defer receiver.close()
+
+	var replyTo string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		replyTo = p.Addr.String()
+	}
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+			break
+		}
+
+		req := Request{ReplyTo: replyTo}
+		req.Data, req.Batch, err = requestData(msg)
+		if err == nil {
+			req.CorrelationID = receiver.assign(msg)
+			// Blocks until a worker takes the request, so a busy server slows clients down
+			err = s.queue.acceptRequest(stream.Context(), req, receiver)
+			if err != nil {
+				receiver.take(req.CorrelationID)
+			}
+		}
+		if errors.Is(err, ErrStopped) || errors.Is(err, errInvalidCommand) {
+			// Invalid requests and the ones sent after StopRequests fail right away,
+			// replies to the ones taken before are still sent
+			reply := &executorpb.ExchangeReply{
+				CorrelationId: msg.GetCorrelationId(),
+				Body:          &executorpb.ExchangeReply_Error{Error: err.Error()},
+			}
+			if err := receiver.send(reply); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	case <-s.closed:
+		return ErrClosed
+	}
+}
+
+// requestData serializes the commands of a request as the executor takes them, several ones as a batch
+func requestData(msg *executorpb.ExchangeRequest) (string, bool, error) {
+	switch body := msg.GetBody().(type) {
+	case *executorpb.ExchangeRequest_Command:
+		data, err := commandData(body.Command)
+		return data, false, err
+	case *executorpb.ExchangeRequest_Batch:
+		commands := make([]string, 0, len(body.Batch.GetCommands()))
+		for _, command := range body.Batch.GetCommands() {
+			data, err := commandData(command)
+			if err != nil {
+				return "", true, err
+			}
+			commands = append(commands, data)
+		}
+		data, err := EncodeBatch(commands)
+		return data, true, err
+	default:
+		return "", false, fmt.Errorf("%w: empty request", errInvalidCommand)
+	}
+}
+
+// grpcStreamReceiver sends replies to the stream the requests came from
+type grpcStreamReceiver struct {
+	mu       sync.Mutex // Serializes replies, a stream can't be sent to concurrently
+	stream   grpc.BidiStreamingServer[executorpb.ExchangeRequest, executorpb.ExchangeReply]
+	corrIDs  clientCorrelationIDs
+	requests sync.Map // Server correlation ID -> request, its commands tell how to type the reply
+	closed   bool     // Sending is not allowed once the handler returned
+}
+
+// assign returns a new server correlation ID for the request of the client
+func (r *grpcStreamReceiver) assign(msg *executorpb.ExchangeRequest) string {
+	corrID := r.corrIDs.assign(msg.GetCorrelationId())
+	r.requests.Store(corrID, msg)
+	return corrID
+}
+
+// take returns the request with the server correlation ID and forgets it
+func (r *grpcStreamReceiver) take(corrID string) (*executorpb.ExchangeRequest, bool) {
+	r.corrIDs.take(corrID)
+	msg, ok := r.requests.LoadAndDelete(corrID)
+	if !ok {
+		return nil, false
+	}
+	return msg.(*executorpb.ExchangeRequest), true
+}
+
+func (r *grpcStreamReceiver) deliverReply(corrID, data string) error {
+	msg, ok := r.take(corrID)
+	if !ok {
+		return fmt.Errorf("no request with correlation ID %s", corrID)
+	}
+
+	reply := &executorpb.ExchangeReply{CorrelationId: msg.GetCorrelationId()}
+	if batch := msg.GetBatch(); batch != nil {
+		// A reply which doesn't match the batch fails the batch on the client
+		replies, _ := DecodeBatch(data)
+		responses := make([]*executorpb.Response, len(replies))
+		for i, reply := range replies {
+			var command *executorpb.Command
+			if i < len(batch.GetCommands()) {
+				command = batch.GetCommands()[i]
+			}
+			responses[i] = typedResponse(command, reply)
+		}
+		reply.Body = &executorpb.ExchangeReply_Batch{Batch: &executorpb.BatchResponse{Responses: responses}}
+	} else {
+		reply.Body = &executorpb.ExchangeReply_Response{Response: typedResponse(msg.GetCommand(), data)}
+	}
+	return r.send(reply)
+}
+
+// send sends a reply to the stream unless the handler returned
+func (r *grpcStreamReceiver) send(reply *executorpb.ExchangeReply) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return fmt.Errorf("failed to send response: %w", ErrClosed)
+	}
+	if err := r.stream.Send(reply); err != nil {
+		return fmt.Errorf("failed to send response: %w", err)
+	}
+	return nil
+}
+
+func (r *grpcStreamReceiver) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+}
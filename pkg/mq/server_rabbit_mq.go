@@ -1,112 +1,266 @@
 package mq
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
+	"github.com/google/uuid"
 	"github.com/rabbitmq/amqp091-go"
 )
 
 // ServerRabbitMQ implements ServerMQ for RabbitMQ.
+// The connection is restored automatically, the queue is declared and consumed again.
 type ServerRabbitMQ struct {
-	conn       *amqp091.Connection
-	channel    *amqp091.Channel
+	conn       *rabbitConnection
 	routingKey string
+	options    RabbitMQOptions
 
-	requestsCh chan Request
-	once       sync.Once
+	// Guards the channel and its settings, the channel is replaced on reconnection
+	mu          sync.RWMutex
+	channel     *amqp091.Channel // nil while reconnecting
+	listening   bool
+	stopped     bool // Set by StopRequests, the queue isn't consumed anymore
+	prefetch    int  // Unacknowledged deliveries per consumer, unlimited if 0
+	consumerTag string
 
-	// correlationID -> replyTo queue
+	requestsCh   chan Request
+	closed       chan struct{}
+	closeOnce    sync.Once
+	requestsOnce sync.Once
+	pumps        sync.WaitGroup
+
+	// The backlog is polled on a channel of its own, so a failed inspection can't close the channel
+	// requests are consumed on. It's opened on demand and reopened if the broker closed it.
+	backlogMu      sync.Mutex
+	backlogConn    *amqp091.Connection // nil while reconnecting
+	backlogChannel *amqp091.Channel
+
+	// correlationID -> replyTo queue, entries are removed by Reply, by rejecting the request or on connection loss
 	replyToMap sync.Map
 }
 
 // NewServerRabbitMQ creates a server that listens on the named queue (routingKey).
 func NewServerRabbitMQ(url, routingKey string) (*ServerRabbitMQ, error) {
-	conn, err := amqp091.Dial(url)
+	return NewServerRabbitMQWithOptions(url, routingKey, RabbitMQOptions{})
+}
+
+// NewServerRabbitMQWithOptions creates a server that declares the named queue (routingKey) with the options.
+func NewServerRabbitMQWithOptions(url, routingKey string, options RabbitMQOptions) (*ServerRabbitMQ, error) {
+	return newServerRabbitMQ(url, routingKey, options, defaultRabbitConfig())
+}
+
+func newServerRabbitMQ(url, routingKey string, options RabbitMQOptions, config amqp091.Config) (*ServerRabbitMQ, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	server := &ServerRabbitMQ{
+		routingKey:  routingKey,
+		options:     options,
+		consumerTag: uuid.New().String(),
+		requestsCh:  make(chan Request),
+		closed:      make(chan struct{}),
+	}
+
+	conn, err := dialRabbitMQ(url, config, server.setup, server.onConnectionLost)
 	if err != nil {
 		return nil, err
 	}
+	server.conn = conn
+	return server, nil
+}
 
+// setup declares the server queue and resumes consuming if it was started, it runs on every (re)connection
+func (s *ServerRabbitMQ) setup(conn *amqp091.Connection) ([]*amqp091.Channel, error) {
 	ch, err := conn.Channel()
 	if err != nil {
-		conn.Close()
+		return nil, fmt.Errorf("failed to create channel: %w", err)
+	}
+
+	// Requests rejected without requeue are routed to the dead-letter queue by the broker
+	if err := declareDeadLetterQueue(ch, s.routingKey, s.options.Durable); err != nil {
+		ch.Close()
 		return nil, err
 	}
 
 	// Declare the queue the server will consume from (the "server queue").
 	_, err = ch.QueueDeclare(
-		routingKey,
-		false, // durable
+		s.routingKey,
+		s.options.Durable,
 		false, // auto-delete
 		false, // exclusive
 		false, // no-wait
-		nil,   // args
+		s.options.queueArgs(s.routingKey),
 	)
 	if err != nil {
 		ch.Close()
-		conn.Close()
-		return nil, err
+		var amqpErr *amqp091.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.PreconditionFailed {
+			// E.g. the queue was declared by a version without dead-lettering, the broker can't change its arguments
+			return nil, fmt.Errorf("%w: delete queue %q to declare it with the current options: %v", ErrQueueMismatch, s.routingKey, err)
+		}
+		return nil, fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.prefetch > 0 {
+		if err := ch.Qos(s.prefetch, 0, false); err != nil {
+			ch.Close()
+			return nil, fmt.Errorf("failed to set prefetch: %w", err)
+		}
+	}
+	if s.listening && !s.stopped {
+		if err := s.consume(ch); err != nil {
+			ch.Close()
+			return nil, err
+		}
 	}
+	s.channel = ch
 
-	return &ServerRabbitMQ{
-		conn:       conn,
-		channel:    ch,
-		routingKey: routingKey,
-		requestsCh: make(chan Request),
-	}, nil
+	s.backlogMu.Lock()
+	defer s.backlogMu.Unlock()
+	s.backlogConn = conn
+	s.backlogChannel = nil
+	return []*amqp091.Channel{ch}, nil
 }
 
-// ListenForRequests returns a channel that the user can read from in worker goroutines.
-func (s *ServerRabbitMQ) ListenForRequests() (<-chan Request, error) {
-	var initErr error
-	s.once.Do(func() {
-		deliveries, err := s.channel.Consume(
-			s.routingKey,
-			"",
-			true,  // auto-ack
-			false, // not exclusive
-			false, // no-local
-			false, // no-wait
-			nil,
-		)
+func (s *ServerRabbitMQ) onConnectionLost(error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.channel = nil
+	s.backlogMu.Lock()
+	s.backlogConn = nil
+	s.backlogMu.Unlock()
+	// Unacknowledged requests are redelivered on the next connection, their replies are expected then
+	s.replyToMap.Clear()
+}
+
+// SetPrefetch limits unacknowledged requests delivered at once, it must be called before ListenForRequests.
+// The limit is restored on reconnection.
+func (s *ServerRabbitMQ) SetPrefetch(count int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.channel == nil {
+		return ErrNotConnected
+	}
+	if err := s.channel.Qos(count, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch: %w", err)
+	}
+	s.prefetch = count
+	return nil
+}
+
+// Backlog returns the number of requests ready in the server queue, the ones delivered already aren't counted
+func (s *ServerRabbitMQ) Backlog() (int, error) {
+	s.backlogMu.Lock()
+	defer s.backlogMu.Unlock()
+
+	if s.backlogConn == nil {
+		return 0, ErrNotConnected
+	}
+	if s.backlogChannel == nil || s.backlogChannel.IsClosed() {
+		ch, err := s.backlogConn.Channel()
 		if err != nil {
-			initErr = fmt.Errorf("failed to start consuming: %w", err)
-			return
+			return 0, fmt.Errorf("failed to create channel: %w", err)
 		}
+		s.backlogChannel = ch
+	}
+	queue, err := s.backlogChannel.QueueDeclarePassive(
+		s.routingKey,
+		s.options.Durable,
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		s.options.queueArgs(s.routingKey),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect queue: %w", err)
+	}
+	return queue.Messages, nil
+}
 
-		// Pump deliveries into s.requestsCh
-		go func() {
-			defer close(s.requestsCh)
-			for d := range deliveries {
-				// Store the replyTo so we can respond later
-				s.replyToMap.Store(d.CorrelationId, d.ReplyTo)
-
-				req := Request{
-					Data:          string(d.Body),
-					CorrelationID: d.CorrelationId,
-					ReplyTo:       d.ReplyTo,
-				}
-				s.requestsCh <- req
-			}
-		}()
-	})
+// ListenForRequests returns a channel that the user can read from in worker goroutines.
+// The channel stays the same across reconnections and is closed by Close.
+// Requests are acknowledged manually, unacknowledged ones are redelivered if the connection is lost.
+func (s *ServerRabbitMQ) ListenForRequests() (<-chan Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if initErr != nil {
-		return nil, initErr
+	if !s.listening && !s.stopped {
+		if s.channel == nil {
+			return nil, ErrNotConnected
+		}
+		if err := s.consume(s.channel); err != nil {
+			return nil, err
+		}
+		s.listening = true
 	}
 	return s.requestsCh, nil
 }
 
+// consume starts pumping deliveries of the channel into requestsCh, the caller must hold mu
+func (s *ServerRabbitMQ) consume(ch *amqp091.Channel) error {
+	deliveries, err := ch.Consume(
+		s.routingKey,
+		s.consumerTag,
+		false, // auto-ack
+		false, // not exclusive
+		false, // no-local
+		false, // no-wait
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start consuming: %w", err)
+	}
+
+	s.pumps.Add(1)
+	go s.pump(deliveries)
+	return nil
+}
+
+// pump passes deliveries to requestsCh until the channel is closed
+func (s *ServerRabbitMQ) pump(deliveries <-chan amqp091.Delivery) {
+	defer s.pumps.Done()
+
+	for d := range deliveries {
+		// Store the replyTo so we can respond later
+		s.replyToMap.Store(d.CorrelationId, d.ReplyTo)
+
+		req := Request{
+			Data:          string(d.Body),
+			CorrelationID: d.CorrelationId,
+			ReplyTo:       d.ReplyTo,
+			Batch:         d.ContentType == BatchContentType,
+			Redelivered:   d.Redelivered,
+			acker:         deliveryAcker{delivery: d, replyTo: &s.replyToMap},
+		}
+		select {
+		case s.requestsCh <- req:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
 // Reply uses correlationID to look up the correct replyTo queue and publishes the response there.
 func (s *ServerRabbitMQ) Reply(corrID, data string) error {
-	v, ok := s.replyToMap.Load(corrID)
+	v, ok := s.replyToMap.LoadAndDelete(corrID)
 	if !ok {
 		return fmt.Errorf("no replyTo found for correlation ID %s", corrID)
 	}
 	replyTo, _ := v.(string)
-	// Optionally delete from the map now to avoid memory leaks
-	s.replyToMap.Delete(corrID)
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.channel == nil {
+		return ErrNotConnected
+	}
 	err := s.channel.Publish(
 		"",
 		replyTo,
@@ -124,10 +278,87 @@ func (s *ServerRabbitMQ) Reply(corrID, data string) error {
 	return nil
 }
 
-// Close closes the RabbitMQ channel and connection.
-func (s *ServerRabbitMQ) Close() error {
-	if err := s.channel.Close(); err != nil {
-		return err
+// DeadLetter publishes a copy of the request to the dead-letter queue of the server queue.
+func (s *ServerRabbitMQ) DeadLetter(req Request, reason string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.channel == nil {
+		return ErrNotConnected
+	}
+	msg := deadLetterPublishing(req, reason)
+	msg.DeliveryMode = s.options.deliveryMode()
+	err := s.channel.Publish(
+		deadLetterExchangeName(s.routingKey),
+		s.routingKey,
+		false,
+		false,
+		msg,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+	return nil
+}
+
+// StopRequests cancels consuming the server queue, the requests channel is closed once the deliveries
+// already received are read. Requests left in the queue are taken by other servers or after a restart.
+func (s *ServerRabbitMQ) StopRequests() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return nil
+	}
+	s.stopped = true
+
+	// Deliveries already received are passed on, then the pump exits
+	var err error
+	if s.listening && s.channel != nil {
+		if cancelErr := s.channel.Cancel(s.consumerTag, false); cancelErr != nil {
+			// Deliveries stop with the channel anyway
+			err = fmt.Errorf("failed to cancel consuming: %w", cancelErr)
+		}
 	}
-	return s.conn.Close()
+	go func() {
+		s.pumps.Wait()
+		s.closeRequests()
+	}()
+	return err
+}
+
+// Close closes the RabbitMQ channel and connection, then the requests channel.
+func (s *ServerRabbitMQ) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		err = s.conn.Close()
+		s.pumps.Wait()
+		s.closeRequests()
+	})
+	return err
+}
+
+func (s *ServerRabbitMQ) closeRequests() {
+	s.requestsOnce.Do(func() {
+		close(s.requestsCh)
+	})
+}
+
+// deliveryAcker settles a RabbitMQ delivery on the channel it came from.
+// If that channel is gone, the broker redelivers the request anyway.
+// A request rejected without requeue goes to the dead-letter queue.
+type deliveryAcker struct {
+	delivery amqp091.Delivery
+	replyTo  *sync.Map // The server's reply-to queues, a rejected request won't be replied to
+}
+
+func (a deliveryAcker) ack() error {
+	return a.delivery.Ack(false)
+}
+
+func (a deliveryAcker) nack(requeue bool) error {
+	// Forget the reply-to queue before the broker can redeliver the request and store it again
+	a.replyTo.Delete(a.delivery.CorrelationId)
+	return a.delivery.Nack(false, requeue)
 }
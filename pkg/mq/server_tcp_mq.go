@@ -0,0 +1,213 @@
+package mq
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// tcpWriteTimeout bounds writes to a connection, so a stuck peer can't block replies forever
+const tcpWriteTimeout = 10 * time.Second
+
+// ServerTCP implements ServerMQ over plain TCP, so small deployments can run without a broker.
+// Clients connect to its listener directly. Requests are queued in the process as by InprocServer,
+// so the ones not replied to are lost when the server stops.
+type ServerTCP struct {
+	listener net.Listener
+	queue    *InprocServer // Requests of all connections
+
+	mu        sync.Mutex
+	conns     map[*tcpServerConn]struct{}
+	closed    bool
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewServerTCP creates a server listening on the address, e.g. ":5673" or "127.0.0.1:0" for a random port.
+func NewServerTCP(addr string) (*ServerTCP, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	server := &ServerTCP{
+		listener: listener,
+		queue:    NewInprocServer(),
+		conns:    make(map[*tcpServerConn]struct{}),
+	}
+	server.wg.Add(1)
+	go server.acceptLoop()
+	return server, nil
+}
+
+// Addr returns the address the server listens on
+func (s *ServerTCP) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// ListenForRequests returns a channel that the user can read from in worker goroutines
+func (s *ServerTCP) ListenForRequests() (<-chan Request, error) {
+	return s.queue.ListenForRequests()
+}
+
+// Reply sends the response to the connection the request came from
+func (s *ServerTCP) Reply(corrID, data string) error {
+	return s.queue.Reply(corrID, data)
+}
+
+// DeadLetter passes a copy of the request to the dead-letter channel, it fails if the channel is full
+func (s *ServerTCP) DeadLetter(req Request, reason string) error {
+	return s.queue.DeadLetter(req, reason)
+}
+
+// Backlog returns the number of requests waiting for a worker
+func (s *ServerTCP) Backlog() (int, error) {
+	return s.queue.Backlog()
+}
+
+// StopRequests makes the server drop new requests, the requests channel is closed once the ones taken are read
+func (s *ServerTCP) StopRequests() error {
+	return s.queue.StopRequests()
+}
+
+// DeadLetters returns the side channel of dead letters, it's closed by Close
+func (s *ServerTCP) DeadLetters() <-chan DeadLetter {
+	return s.queue.DeadLetters()
+}
+
+// Close stops listening, drops all connections and closes the requests channel
+func (s *ServerTCP) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		conns := make([]*tcpServerConn, 0, len(s.conns))
+		for conn := range s.conns {
+			conns = append(conns, conn)
+		}
+		s.mu.Unlock()
+
+		err = s.listener.Close()
+		// Unblock connections waiting for a worker first
+		s.queue.Close()
+		for _, conn := range conns {
+			conn.netConn.Close()
+		}
+		s.wg.Wait()
+	})
+	return err
+}
+
+func (s *ServerTCP) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("TCP server stopped accepting connections: %v", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			netConn.Close()
+			return
+		}
+		conn := &tcpServerConn{netConn: netConn}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+// serve queues requests of the connection until it's closed
+func (s *ServerTCP) serve(conn *tcpServerConn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.netConn.Close()
+	}()
+
+	r := bufio.NewReader(conn.netConn)
+	for {
+		f, err := readTCPFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("TCP connection %s failed: %v", conn.netConn.RemoteAddr(), err)
+			}
+			return
+		}
+		if f.kind != tcpFrameRequest && f.kind != tcpFrameBatchRequest {
+			log.Printf("TCP connection %s sent unexpected frame kind %d", conn.netConn.RemoteAddr(), f.kind)
+			return
+		}
+
+		req := Request{
+			Data:          f.data,
+			CorrelationID: conn.corrIDs.assign(f.corrID),
+			ReplyTo:       conn.netConn.RemoteAddr().String(),
+			Batch:         f.kind == tcpFrameBatchRequest,
+		}
+		// Blocks until a worker takes the request, so a busy server slows clients down
+		err = s.queue.acceptRequest(context.Background(), req, conn)
+		if err != nil {
+			conn.corrIDs.take(req.CorrelationID)
+		}
+		if errors.Is(err, ErrStopped) {
+			// Requests sent after StopRequests fail right away, replies to the ones taken before are still sent
+			if err := conn.send(tcpFrame{kind: tcpFrameError, corrID: f.corrID, data: err.Error()}); err != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// tcpServerConn is a client connection of ServerTCP, it sends replies to the requests it read
+type tcpServerConn struct {
+	netConn net.Conn
+	corrIDs clientCorrelationIDs
+	mu      sync.Mutex // Serializes replies
+}
+
+func (c *tcpServerConn) deliverReply(corrID, data string) error {
+	clientID, ok := c.corrIDs.take(corrID)
+	if !ok {
+		return fmt.Errorf("no request with correlation ID %s", corrID)
+	}
+	return c.send(tcpFrame{kind: tcpFrameReply, corrID: clientID, data: data})
+}
+
+// send writes a frame to the client, the connection is closed if it fails
+func (c *tcpServerConn) send(f tcpFrame) error {
+	buf, err := f.encode()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.netConn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+	if _, err := c.netConn.Write(buf); err != nil {
+		c.netConn.Close()
+		return fmt.Errorf("failed to send response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package mq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Kinds of frames of the TCP transport
+const (
+	tcpFrameRequest      byte = 1 // Client to server
+	tcpFrameBatchRequest byte = 2 // Client to server, the data is packed by EncodeBatch
+	tcpFrameReply        byte = 3 // Server to client
+	tcpFrameError        byte = 4 // Server to client, the request failed without a reply, the data is the reason
+)
+
+// tcpMaxFrameSize limits frames read from the network, so a broken peer can't exhaust the memory
+const tcpMaxFrameSize = 64 << 20
+
+var errMalformedFrame = errors.New("malformed frame")
+
+// tcpFrame is a message of the TCP transport. On the wire it's prefixed with its length:
+//
+//	length uint32 | kind byte | correlation ID length byte | correlation ID | data
+type tcpFrame struct {
+	kind   byte
+	corrID string
+	data   string
+}
+
+// encode returns the frame with its length prefix
+func (f tcpFrame) encode() ([]byte, error) {
+	if len(f.corrID) > math.MaxUint8 {
+		return nil, fmt.Errorf("%w: correlation ID is too long", errMalformedFrame)
+	}
+	size := 2 + len(f.corrID) + len(f.data)
+	if size > tcpMaxFrameSize {
+		return nil, fmt.Errorf("%w: %d bytes exceed the limit", errMalformedFrame, size)
+	}
+
+	buf := make([]byte, 4, 4+size)
+	binary.BigEndian.PutUint32(buf, uint32(size))
+	buf = append(buf, f.kind, byte(len(f.corrID)))
+	buf = append(buf, f.corrID...)
+	return append(buf, f.data...), nil
+}
+
+// readTCPFrame reads one frame
+func readTCPFrame(r io.Reader) (tcpFrame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return tcpFrame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size < 2 || size > tcpMaxFrameSize {
+		return tcpFrame{}, fmt.Errorf("%w: invalid size %d", errMalformedFrame, size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return tcpFrame{}, err
+	}
+
+	corrIDEnd := 2 + int(payload[1])
+	if corrIDEnd > len(payload) {
+		return tcpFrame{}, fmt.Errorf("%w: correlation ID exceeds the frame", errMalformedFrame)
+	}
+	return tcpFrame{
+		kind:   payload[0],
+		corrID: string(payload[2:corrIDEnd]),
+		data:   string(payload[corrIDEnd:]),
+	}, nil
+}
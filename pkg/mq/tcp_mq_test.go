@@ -0,0 +1,255 @@
+package mq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPFrame(t *testing.T) {
+	f := tcpFrame{kind: tcpFrameBatchRequest, corrID: "corr-id", data: "payload"}
+	data, err := f.encode()
+	assert.NoError(t, err)
+
+	read, err := readTCPFrame(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, f, read)
+
+	// Test truncated and broken frames are rejected
+	_, err = readTCPFrame(bytes.NewReader(data[:len(data)-1]))
+	assert.Error(t, err)
+
+	broken := append([]byte(nil), data...)
+	broken[5] = 200 // Correlation ID length beyond the frame
+	_, err = readTCPFrame(bytes.NewReader(broken))
+	assert.ErrorIs(t, err, errMalformedFrame)
+
+	_, err = readTCPFrame(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}))
+	assert.ErrorIs(t, err, errMalformedFrame)
+
+	_, err = tcpFrame{corrID: string(make([]byte, 256))}.encode()
+	assert.ErrorIs(t, err, errMalformedFrame)
+}
+
+func TestTCPMQ(t *testing.T) {
+	var tcpServer *ServerTCP
+
+	serverFactory := func() ServerMQ {
+		server, err := NewServerTCP("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to initialize TCP server: %v", err)
+		}
+		tcpServer = server
+		return server
+	}
+
+	clientFactory := func() ClientMQ {
+		client, err := NewClientTCP(tcpServer.Addr()) // connect to the current server
+		if err != nil {
+			t.Fatalf("Failed to initialize TCP client: %v", err)
+		}
+		return client
+	}
+
+	runMessageQueueTests(t, clientFactory, serverFactory)
+}
+
+func TestTCPMQReconnect(t *testing.T) {
+	server, err := NewServerTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to initialize TCP server: %v", err)
+	}
+	addr := server.Addr()
+
+	// The server takes requests, but never replies
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	go func() {
+		for range reqCh {
+		}
+	}()
+
+	client, err := NewClientTCP(addr)
+	if err != nil {
+		t.Fatalf("Failed to initialize TCP client: %v", err)
+	}
+	defer client.Close()
+
+	// Test requests in flight fail once the server is gone
+	replyChan, err := client.Request("Message")
+	assert.NoError(t, err)
+	assert.NoError(t, server.Close())
+
+	select {
+	case reply := <-replyChan:
+		assert.ErrorIs(t, reply.Err, ErrConnectionLost)
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for connection loss")
+	}
+	assert.Equal(t, 0, client.corrMap.len())
+
+	_, err = client.Request("Message")
+	assert.ErrorIs(t, err, ErrNotConnected)
+
+	// Test the client reconnects to a new server on the same address
+	newServer, err := NewServerTCP(addr)
+	if err != nil {
+		t.Fatalf("Failed to restart TCP server: %v", err)
+	}
+	defer newServer.Close()
+
+	newReqCh, err := newServer.ListenForRequests()
+	assert.NoError(t, err)
+	go func() {
+		for req := range newReqCh {
+			_ = newServer.Reply(req.CorrelationID, "Reply: "+req.Data)
+			_ = req.Ack()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	replyChan, err = client.RequestContext(ctx, "Message")
+	assert.NoError(t, err)
+	assert.Equal(t, Reply{Data: "Reply: Message"}, <-replyChan)
+
+	// Test requests fail once the client is closed
+	assert.NoError(t, client.Close())
+	_, err = client.Request("Message")
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestTCPMQCorrelationIDsPerConnection(t *testing.T) {
+	server, err := NewServerTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to initialize TCP server: %v", err)
+	}
+	defer server.Close()
+
+	// Reply once both requests are taken, so they are in the correlation map together
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	go func() {
+		first, second := <-reqCh, <-reqCh
+		for _, req := range []Request{first, second} {
+			assert.NoError(t, server.Reply(req.CorrelationID, "Reply: "+req.Data))
+		}
+	}()
+
+	// Two clients choose the same correlation ID, e.g. both count requests from one
+	var conns []net.Conn
+	for _, data := range []string{"first", "second"} {
+		conn, err := net.Dial("tcp", server.Addr())
+		assert.NoError(t, err)
+		defer conn.Close()
+		conns = append(conns, conn)
+
+		buf, err := tcpFrame{kind: tcpFrameRequest, corrID: "1", data: data}.encode()
+		assert.NoError(t, err)
+		_, err = conn.Write(buf)
+		assert.NoError(t, err)
+	}
+
+	// Test each connection gets the reply to its own request
+	for i, data := range []string{"first", "second"} {
+		conns[i].SetReadDeadline(time.Now().Add(time.Second))
+		f, err := readTCPFrame(bufio.NewReader(conns[i]))
+		assert.NoError(t, err)
+		assert.Equal(t, tcpFrame{kind: tcpFrameReply, corrID: "1", data: "Reply: " + data}, f)
+	}
+}
+
+func TestTCPMQStoppedRequests(t *testing.T) {
+	server, err := NewServerTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to initialize TCP server: %v", err)
+	}
+	defer server.Close()
+
+	client, err := NewClientTCP(server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to initialize TCP client: %v", err)
+	}
+	defer client.Close()
+
+	_, err = server.ListenForRequests()
+	assert.NoError(t, err)
+	assert.NoError(t, server.StopRequests())
+
+	// Test a request sent after StopRequests fails right away instead of waiting for its timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	replyChan, err := client.RequestContext(ctx, "Late")
+	assert.NoError(t, err)
+
+	select {
+	case reply := <-replyChan:
+		assert.ErrorIs(t, reply.Err, ErrStopped)
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the request to fail")
+	}
+	assert.Equal(t, 0, client.corrMap.len())
+}
+
+// lateContext has a deadline which passed, but it isn't done yet, as between checking it and writing a request
+type lateContext struct {
+	context.Context
+}
+
+func (lateContext) Deadline() (time.Time, bool) {
+	return time.Now().Add(-time.Second), true
+}
+
+func TestTCPMQRequestTimesOutBeforeWritten(t *testing.T) {
+	server, err := NewServerTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to initialize TCP server: %v", err)
+	}
+	defer server.Close()
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+	go func() {
+		for req := range reqCh {
+			_ = server.Reply(req.CorrelationID, "Reply: "+req.Data)
+		}
+	}()
+
+	client, err := NewClientTCP(server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to initialize TCP client: %v", err)
+	}
+	defer client.Close()
+	conn := client.conn
+
+	// Test a request whose deadline passes while other requests are sent
+	client.mu.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	failed := make(chan error)
+	go func() {
+		_, err := client.RequestContext(ctx, "Waiting")
+		failed <- err
+	}()
+	<-ctx.Done()
+	client.mu.Unlock()
+	assert.ErrorIs(t, <-failed, context.DeadlineExceeded)
+
+	// Test a request whose deadline passes right before it's written
+	_, err = client.RequestContext(lateContext{context.Background()}, "Late")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, client.corrMap.len())
+
+	// Test the connection is kept and the next request gets its reply
+	replyCtx, replyCancel := context.WithTimeout(context.Background(), time.Second)
+	defer replyCancel()
+	replyChan, err := client.RequestContext(replyCtx, "Message")
+	assert.NoError(t, err)
+	assert.Equal(t, Reply{Data: "Reply: Message"}, <-replyChan)
+	assert.Same(t, conn, client.conn)
+}
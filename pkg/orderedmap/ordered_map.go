@@ -2,7 +2,9 @@ package orderedmap
 
 import (
 	"errors"
+	"math/rand/v2"
 	"sync"
+	"time"
 )
 
 var (
@@ -10,6 +12,12 @@ var (
 	ErrKeyNotFound = errors.New("key not found")
 	// ErrInvalidOption is returned when an invalid option is passed to New
 	ErrInvalidOption = errors.New("invalid option passed to New")
+	// ErrVersionMismatch is returned when a conditional write expects another version of the key
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrKeyExists is returned when a write expects the key to be absent
+	ErrKeyExists = errors.New("key already exists")
+	// ErrInvalidCursor is returned when paging with a cursor of another map, or of this one before it was restored
+	ErrInvalidCursor = errors.New("invalid cursor")
 )
 
 // Pair is a key-value pair
@@ -19,8 +27,13 @@ type Pair[K comparable, V any] struct {
 }
 
 type initConfig[K comparable, V any] struct {
-	capacity    int
-	initialData []Pair[K, V]
+	capacity      int
+	initialData   []Pair[K, V]
+	sweepInterval time.Duration
+	now           func() time.Time
+	maxSize       int
+	policy        EvictionPolicy
+	onEvict       func(key K, value V)
 }
 
 // InitOption is a function type for configuring the OrderedMap during initialization
@@ -43,12 +56,47 @@ func WithInitialData[K comparable, V any](initialData ...Pair[K, V]) InitOption[
 	}
 }
 
+// entry is a node of the intrusive doubly linked list keeping the insertion order
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	seq       uint64 // Insertion sequence number, grows along the list
+	version   uint64 // Version of the value, changes on every write
+	expiresAt int64  // Unix time in nanoseconds, zero if the key never expires
+	heapIndex int    // Position in the expiry heap, -1 if the key never expires
+	prev      *entry[K, V]
+	next      *entry[K, V]
+
+	// Access order list, maintained only for the LRU eviction policy
+	accessPrev *entry[K, V]
+	accessNext *entry[K, V]
+}
+
+func (e *entry[K, V]) expired(now int64) bool {
+	return e.expiresAt != 0 && e.expiresAt <= now
+}
+
 // OrderedMap is a map that maintains the order of keys
 type OrderedMap[K comparable, V any] struct {
-	mu       sync.RWMutex
-	items    map[K]V
-	order    []K
-	indexMap map[K]int // Tracks the position of each key in the 'order' slice
+	mu    sync.RWMutex
+	items map[K]*entry[K, V]
+	root  entry[K, V] // Sentinel: root.next is the oldest entry, root.prev is the newest one
+	seq   uint64      // Last assigned insertion sequence number
+	epoch uint64      // Random, changes whenever sequence numbers start over, so cursors from before are rejected
+	// Last assigned version, shared by all keys, so a re-created key never gets a version it had before
+	version uint64
+	expiry  expiryHeap[K, V] // Keys with TTL, the soonest to expire on top
+	now     func() time.Time
+
+	maxSize    int // Zero if the map is unbounded
+	policy     EvictionPolicy
+	accessRoot entry[K, V] // Sentinel of the access order list: accessRoot.accessNext is the least recently used
+	onEvict    func(key K, value V)
+	evicted    []Pair[K, V] // Evicted under the lock, reported to onEvict after unlocking
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
 // New creates a new OrderedMap instance
@@ -76,44 +124,66 @@ func New[K comparable, V any](options ...any) (*OrderedMap[K, V], error) {
 	if config.capacity < 0 {
 		config.capacity = 0
 	}
+	if config.now == nil {
+		config.now = time.Now
+	}
 
-	om := &OrderedMap[K, V]{}
+	if config.maxSize < 0 {
+		return nil, ErrInvalidOption
+	}
+
+	om := &OrderedMap[K, V]{
+		now:      config.now,
+		maxSize:  config.maxSize,
+		policy:   config.policy,
+		onEvict:  config.onEvict,
+		stopChan: make(chan struct{}),
+	}
 	om.initialize(config.capacity)
 	om.StorePairs(config.initialData...)
 
+	if config.sweepInterval > 0 {
+		om.wg.Add(1)
+		go om.sweepLoop(config.sweepInterval)
+	}
+
 	return om, nil
 }
 
 func (om *OrderedMap[K, V]) initialize(capacity int) {
-	om.items = make(map[K]V, capacity)
-	om.order = make([]K, 0, capacity)
-	om.indexMap = make(map[K]int, capacity)
+	om.items = make(map[K]*entry[K, V], capacity)
+	om.root.prev = &om.root
+	om.root.next = &om.root
+	om.accessRoot.accessPrev = &om.accessRoot
+	om.accessRoot.accessNext = &om.accessRoot
+	om.expiry = nil
+	om.epoch = rand.Uint64() | 1 // Never zero, so a cursor without an epoch is rejected
+}
+
+// Close stops the background sweeper, if any. The map stays usable afterwards.
+func (om *OrderedMap[K, V]) Close() {
+	om.closeOnce.Do(func() {
+		close(om.stopChan)
+	})
+	om.wg.Wait()
 }
 
-// Store stores a key-value pair in the map
-func (om *OrderedMap[K, V]) Store(key K, value V) {
+// Store stores a key-value pair in the map, the key never expires. Returns the new version of the key.
+func (om *OrderedMap[K, V]) Store(key K, value V) uint64 {
 	om.mu.Lock()
-	defer om.mu.Unlock()
+	defer om.unlock()
 
-	if _, exists := om.items[key]; !exists {
-		// New key: insert it into the end of the order slice
-		om.order = append(om.order, key)
-		om.indexMap[key] = len(om.order) - 1
-	}
-	om.items[key] = value
+	return om.store(key, value, 0, om.nowNano())
 }
 
 // StorePairs stores multiple key-value pairs in the map
 func (om *OrderedMap[K, V]) StorePairs(pairs ...Pair[K, V]) {
 	om.mu.Lock()
-	defer om.mu.Unlock()
+	defer om.unlock()
 
+	now := om.nowNano()
 	for _, pair := range pairs {
-		if _, exists := om.items[pair.Key]; !exists {
-			om.order = append(om.order, pair.Key)
-			om.indexMap[pair.Key] = len(om.order) - 1
-		}
-		om.items[pair.Key] = pair.Value
+		om.store(pair.Key, pair.Value, 0, now)
 	}
 }
 
@@ -122,37 +192,42 @@ func (om *OrderedMap[K, V]) Delete(key K) error {
 	om.mu.Lock()
 	defer om.mu.Unlock()
 
-	if _, exists := om.items[key]; !exists {
+	e, exists := om.items[key]
+	if !exists {
 		return ErrKeyNotFound
 	}
-	delete(om.items, key)
+	expired := e.expired(om.nowNano())
+	om.remove(e)
 
-	// Swap-and-pop removal from the order slice
-	index := om.indexMap[key]
-	lastIndex := len(om.order) - 1
-	if index != lastIndex {
-		// Move the last key into the deleted key's position
-		lastKey := om.order[lastIndex]
-		om.order[index] = lastKey
-		om.indexMap[lastKey] = index
+	if expired {
+		return ErrKeyNotFound
 	}
-	om.order = om.order[:lastIndex]
-	delete(om.indexMap, key)
-
 	return nil
 }
 
 // Get retrieves a value from the map
 func (om *OrderedMap[K, V]) Get(key K) (V, error) {
 	om.mu.RLock()
-	defer om.mu.RUnlock()
+	if om.tracksAccess() {
+		om.mu.RUnlock()
+		value, _, err := om.getAndTouch(key)
+		return value, err
+	}
 
-	val, exists := om.items[key]
-	if !exists {
-		var zero V
-		return zero, ErrKeyNotFound
+	e, exists := om.items[key]
+	if exists && !e.expired(om.nowNano()) {
+		value := e.value
+		om.mu.RUnlock()
+		return value, nil
 	}
-	return val, nil
+	om.mu.RUnlock()
+
+	if exists {
+		// Lazy expiration: remove the key right away instead of waiting for the sweeper
+		om.removeExpired(key)
+	}
+	var zero V
+	return zero, ErrKeyNotFound
 }
 
 // GetAll retrieves all key-value pairs from the map
@@ -160,12 +235,77 @@ func (om *OrderedMap[K, V]) GetAll() []Pair[K, V] {
 	om.mu.RLock()
 	defer om.mu.RUnlock()
 
-	result := make([]Pair[K, V], 0, len(om.order))
-	for _, key := range om.order {
+	now := om.nowNano()
+	result := make([]Pair[K, V], 0, len(om.items))
+	for e := om.root.next; e != &om.root; e = e.next {
+		if e.expired(now) {
+			continue
+		}
 		result = append(result, Pair[K, V]{
-			Key:   key,
-			Value: om.items[key],
+			Key:   e.key,
+			Value: e.value,
 		})
 	}
 	return result
 }
+
+// Len returns the number of keys in the map, including expired keys which are not removed yet
+func (om *OrderedMap[K, V]) Len() int {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+
+	return len(om.items)
+}
+
+// store inserts or overwrites a key with an optional expiration time, evicts keys over maxSize
+// and returns the new version of the key, the caller must hold the write lock
+func (om *OrderedMap[K, V]) store(key K, value V, expiresAt int64, now int64) uint64 {
+	version := om.insert(key, value, expiresAt, now)
+	om.evictOverflow(now)
+	return version
+}
+
+// insert is store without eviction, the caller must hold the write lock
+func (om *OrderedMap[K, V]) insert(key K, value V, expiresAt int64, now int64) uint64 {
+	om.version++
+	if e, exists := om.items[key]; exists {
+		if !e.expired(now) {
+			// Overwriting keeps the original position
+			e.value = value
+			e.version = om.version
+			om.setExpiry(e, expiresAt)
+			om.touch(e)
+			return e.version
+		}
+		// The expired key is gone logically, so the new one goes to the end
+		om.remove(e)
+	}
+
+	// New key: link it at the end of the list
+	om.seq++
+	e := &entry[K, V]{key: key, value: value, seq: om.seq, version: om.version, heapIndex: -1}
+	e.prev = om.root.prev
+	e.next = &om.root
+	om.root.prev.next = e
+	om.root.prev = e
+	om.items[key] = e
+	om.setExpiry(e, expiresAt)
+	om.touch(e)
+	return e.version
+}
+
+// remove deletes an entry from the map, the caller must hold the write lock
+func (om *OrderedMap[K, V]) remove(e *entry[K, V]) {
+	delete(om.items, e.key)
+	om.unlink(e)
+	om.unlinkAccess(e)
+	om.setExpiry(e, 0)
+}
+
+// unlink removes an entry from the list in O(1), the caller must hold the write lock
+func (om *OrderedMap[K, V]) unlink(e *entry[K, V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev = nil
+	e.next = nil
+}
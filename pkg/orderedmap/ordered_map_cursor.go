@@ -0,0 +1,66 @@
+package orderedmap
+
+// Cursor is a position in the insertion order of an OrderedMap.
+// Sequence numbers are not persisted, so a cursor is valid only for the map that returned it
+// until the map is restored from a snapshot, e.g. on restart.
+type Cursor[K comparable] struct {
+	Key   K      // Key of the next pair to return
+	Seq   uint64 // Insertion sequence number of that key, used to resume if the key was deleted
+	Epoch uint64 // Epoch of the map which returned the cursor
+}
+
+// Page returns up to limit pairs in insertion order starting at the cursor,
+// and the cursor for the next page, which is nil when there are no more pairs.
+// A nil cursor starts from the beginning and a non-positive limit returns all remaining pairs.
+// Keys deleted or expired between pages are skipped and keys added between pages are returned at the end.
+// It fails with ErrInvalidCursor if the cursor wasn't returned by this map since it was created or restored.
+func (om *OrderedMap[K, V]) Page(cursor *Cursor[K], limit int) ([]Pair[K, V], *Cursor[K], error) {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+
+	if cursor != nil && cursor.Epoch != om.epoch {
+		return nil, nil, ErrInvalidCursor
+	}
+	e := om.seek(cursor)
+
+	capacity := len(om.items)
+	if limit > 0 && limit < capacity {
+		capacity = limit
+	}
+	now := om.nowNano()
+	result := make([]Pair[K, V], 0, capacity)
+	for ; e != &om.root; e = e.next {
+		if e.expired(now) {
+			continue
+		}
+		if limit > 0 && len(result) == limit {
+			return result, &Cursor[K]{Key: e.key, Seq: e.seq, Epoch: om.epoch}, nil
+		}
+		result = append(result, Pair[K, V]{
+			Key:   e.key,
+			Value: e.value,
+		})
+	}
+	return result, nil, nil
+}
+
+// seek finds the first entry at or after the cursor, the caller must hold the read lock.
+// It's O(1) while the cursor key stays in place, otherwise the list is scanned from the start in O(n).
+func (om *OrderedMap[K, V]) seek(cursor *Cursor[K]) *entry[K, V] {
+	if cursor == nil {
+		return om.root.next
+	}
+
+	// Fast path: the key is still at the same position
+	if e, exists := om.items[cursor.Key]; exists && e.seq == cursor.Seq {
+		return e
+	}
+
+	// The key was deleted or re-inserted, sequence numbers grow along the list,
+	// so the next entry is the first one which was inserted after the cursor
+	e := om.root.next
+	for e != &om.root && e.seq < cursor.Seq {
+		e = e.next
+	}
+	return e
+}
@@ -0,0 +1,118 @@
+package orderedmap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedMapPage(t *testing.T) {
+	om, err := New[int, int]()
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		om.Store(i, i*10)
+	}
+
+	// Test walking all pages
+	var all []Pair[int, int]
+	var cursor *Cursor[int]
+	pages := 0
+	for {
+		page, next, err := om.Page(cursor, 3)
+		assert.NoError(t, err)
+		all = append(all, page...)
+		pages++
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 4, pages)
+	assert.Equal(t, om.GetAll(), all)
+
+	// Test non-positive limit returns everything
+	page, next, err := om.Page(nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, om.GetAll(), page)
+	assert.Nil(t, next)
+
+	// Test exact fit does not return a cursor to an empty page
+	page, next, err = om.Page(nil, 10)
+	assert.NoError(t, err)
+	assert.Len(t, page, 10)
+	assert.Nil(t, next)
+
+	// Test resuming after the cursor key was deleted
+	page, next, err = om.Page(nil, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3}, pairKeys(page))
+	assert.Equal(t, 4, next.Key)
+
+	assert.NoError(t, om.Delete(4))
+	assert.NoError(t, om.Delete(5))
+	page, next, err = om.Page(next, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{6, 7}, pairKeys(page))
+
+	// Test resuming after the cursor key was re-inserted at the end
+	assert.NoError(t, om.Delete(8))
+	om.Store(8, 80)
+	om.Store(10, 100)
+	page, next, err = om.Page(next, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{9, 8, 10}, pairKeys(page))
+	assert.Nil(t, next)
+
+	// Test cursor past the end
+	page, next, err = om.Page(&Cursor[int]{Key: 42, Seq: 1000, Epoch: om.epoch}, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+	assert.Nil(t, next)
+
+	// Test cursor without an epoch
+	_, _, err = om.Page(&Cursor[int]{Key: 0, Seq: 1}, 5)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestOrderedMapPageAcrossRestore(t *testing.T) {
+	om, err := New[int, int]()
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		om.Store(i, i*10)
+	}
+	_, cursor, err := om.Page(nil, 4)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, om.Snapshot(&buf))
+
+	// Test a cursor of the map before it was restored is rejected, sequence numbers start over
+	restored, err := New[int, int]()
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+	_, _, err = restored.Page(cursor, 4)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	assert.NoError(t, om.Restore(bytes.NewReader(buf.Bytes())))
+	_, _, err = om.Page(cursor, 4)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// Test paging starts over with a new cursor
+	page, next, err := restored.Page(nil, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3}, pairKeys(page))
+	page, _, err = restored.Page(next, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 5, 6, 7}, pairKeys(page))
+}
+
+func pairKeys[K comparable, V any](pairs []Pair[K, V]) []K {
+	keys := make([]K, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+	return keys
+}
@@ -0,0 +1,147 @@
+package orderedmap
+
+import "fmt"
+
+// EvictionPolicy defines which key is evicted when a bounded map is full
+type EvictionPolicy int
+
+const (
+	// EvictFIFO evicts the oldest key in insertion order
+	EvictFIFO EvictionPolicy = iota
+	// EvictLRU evicts the least recently used key, both Get and Store count as a use.
+	// Get takes the write lock to track the access order.
+	EvictLRU
+)
+
+// ParseEvictionPolicy parses an eviction policy name: "fifo" or "lru"
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "fifo", "":
+		return EvictFIFO, nil
+	case "lru":
+		return EvictLRU, nil
+	default:
+		return EvictFIFO, fmt.Errorf("%w: unknown eviction policy %q", ErrInvalidOption, name)
+	}
+}
+
+// WithMaxSize bounds the number of keys in the OrderedMap, adding a key to a full map evicts another one.
+// Zero means the map is unbounded.
+func WithMaxSize[K comparable, V any](maxSize int) InitOption[K, V] {
+	return func(c *initConfig[K, V]) {
+		c.maxSize = maxSize
+	}
+}
+
+// WithEvictionPolicy sets which key is evicted from a full map, EvictFIFO by default
+func WithEvictionPolicy[K comparable, V any](policy EvictionPolicy) InitOption[K, V] {
+	return func(c *initConfig[K, V]) {
+		c.policy = policy
+	}
+}
+
+// WithEvictionCallback sets a function called for every evicted pair.
+// It's called after the lock is released, so it may use the map.
+func WithEvictionCallback[K comparable, V any](onEvict func(key K, value V)) InitOption[K, V] {
+	return func(c *initConfig[K, V]) {
+		c.onEvict = onEvict
+	}
+}
+
+// SetMaxSize changes the bound of the map, evicting keys if it holds more than maxSize.
+// Zero makes the map unbounded.
+func (om *OrderedMap[K, V]) SetMaxSize(maxSize int) error {
+	if maxSize < 0 {
+		return ErrInvalidOption
+	}
+
+	om.mu.Lock()
+	defer om.unlock()
+
+	wasTracking := om.tracksAccess()
+	om.maxSize = maxSize
+	if om.tracksAccess() && !wasTracking {
+		// The access order was not tracked while unbounded, start with the insertion order
+		for e := om.root.next; e != &om.root; e = e.next {
+			om.touch(e)
+		}
+	}
+	om.evictOverflow(om.nowNano())
+	return nil
+}
+
+// tracksAccess reports whether reads must update the access order
+func (om *OrderedMap[K, V]) tracksAccess() bool {
+	return om.policy == EvictLRU && om.maxSize > 0
+}
+
+// getAndTouch is Get for the LRU policy, which has to update the access order under the write lock
+func (om *OrderedMap[K, V]) getAndTouch(key K) (V, uint64, error) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+
+	e, exists := om.items[key]
+	if !exists || e.expired(om.nowNano()) {
+		if exists {
+			om.remove(e)
+		}
+		var zero V
+		return zero, 0, ErrKeyNotFound
+	}
+	om.touch(e)
+	return e.value, e.version, nil
+}
+
+// touch moves an entry to the most recently used end of the access list, the caller must hold the write lock
+func (om *OrderedMap[K, V]) touch(e *entry[K, V]) {
+	if !om.tracksAccess() {
+		return
+	}
+	om.unlinkAccess(e)
+	e.accessPrev = om.accessRoot.accessPrev
+	e.accessNext = &om.accessRoot
+	om.accessRoot.accessPrev.accessNext = e
+	om.accessRoot.accessPrev = e
+}
+
+// unlinkAccess removes an entry from the access list if it's there, the caller must hold the write lock
+func (om *OrderedMap[K, V]) unlinkAccess(e *entry[K, V]) {
+	if e.accessNext == nil {
+		return
+	}
+	e.accessPrev.accessNext = e.accessNext
+	e.accessNext.accessPrev = e.accessPrev
+	e.accessPrev = nil
+	e.accessNext = nil
+}
+
+// evictOverflow evicts keys until the map fits into maxSize, the caller must hold the write lock
+func (om *OrderedMap[K, V]) evictOverflow(now int64) {
+	for om.maxSize > 0 && len(om.items) > om.maxSize {
+		// Expired keys go first, they are not reported as evicted
+		if len(om.expiry) > 0 && om.expiry[0].expired(now) {
+			om.remove(om.expiry[0])
+			continue
+		}
+
+		victim := om.root.next
+		if om.policy == EvictLRU {
+			victim = om.accessRoot.accessNext
+		}
+		om.remove(victim)
+		if om.onEvict != nil {
+			om.evicted = append(om.evicted, Pair[K, V]{Key: victim.key, Value: victim.value})
+		}
+	}
+}
+
+// unlock releases the write lock and then reports evicted pairs to the callback
+func (om *OrderedMap[K, V]) unlock() {
+	evicted := om.evicted
+	om.evicted = nil
+	om.mu.Unlock()
+
+	for _, pair := range evicted {
+		om.onEvict(pair.Key, pair.Value)
+	}
+}
@@ -0,0 +1,163 @@
+package orderedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedMapEvictionFIFO(t *testing.T) {
+	var evicted []Pair[string, int]
+	om, err := New[string, int](
+		WithMaxSize[string, int](3),
+		WithEvictionCallback(func(key string, value int) {
+			evicted = append(evicted, Pair[string, int]{Key: key, Value: value})
+		}),
+	)
+	assert.NoError(t, err)
+
+	om.Store("a", 1)
+	om.Store("b", 2)
+	om.Store("c", 3)
+	_, _ = om.Get("a") // Reads don't matter for FIFO
+	om.Store("b", 20)  // Overwrites don't evict
+	assert.Empty(t, evicted)
+
+	om.Store("d", 4)
+	om.StoreWithTTL("e", 5, time.Hour)
+	assert.Equal(t, []Pair[string, int]{{Key: "a", Value: 1}, {Key: "b", Value: 20}}, evicted)
+	assert.Equal(t, []string{"c", "d", "e"}, pairKeys(om.GetAll()))
+	assert.Equal(t, 3, om.Len())
+}
+
+func TestOrderedMapEvictionLRU(t *testing.T) {
+	var evicted []string
+	om, err := New[string, int](
+		WithMaxSize[string, int](3),
+		WithEvictionPolicy[string, int](EvictLRU),
+		WithEvictionCallback(func(key string, _ int) {
+			evicted = append(evicted, key)
+		}),
+	)
+	assert.NoError(t, err)
+
+	om.Store("a", 1)
+	om.Store("b", 2)
+	om.Store("c", 3)
+
+	_, err = om.Get("a") // b is the least recently used now
+	assert.NoError(t, err)
+	om.Store("d", 4)
+	assert.Equal(t, []string{"b"}, evicted)
+
+	om.Store("c", 30) // a is the least recently used now
+	om.Store("e", 5)
+	assert.Equal(t, []string{"b", "a"}, evicted)
+
+	// Deleted keys leave the access order too
+	assert.NoError(t, om.Delete("d"))
+	om.Store("f", 6)
+	om.Store("g", 7)
+	assert.Equal(t, []string{"b", "a", "c"}, evicted)
+
+	// Insertion order is still kept for reads
+	assert.Equal(t, []string{"e", "f", "g"}, pairKeys(om.GetAll()))
+}
+
+func TestOrderedMapEvictionPrefersExpired(t *testing.T) {
+	clock := newFakeClock()
+	var evicted []string
+	om, err := New[string, int](
+		WithClock[string, int](clock.Now),
+		WithMaxSize[string, int](2),
+		WithEvictionCallback(func(key string, _ int) {
+			evicted = append(evicted, key)
+		}),
+	)
+	assert.NoError(t, err)
+
+	om.Store("a", 1)
+	om.StoreWithTTL("b", 2, time.Second)
+	clock.Advance(time.Second)
+	om.Store("c", 3)
+
+	assert.Empty(t, evicted)
+	assert.Equal(t, []string{"a", "c"}, pairKeys(om.GetAll()))
+}
+
+func TestOrderedMapSetMaxSize(t *testing.T) {
+	var evicted []int
+	om, err := New[int, int](
+		WithEvictionPolicy[int, int](EvictLRU),
+		WithEvictionCallback(func(key int, _ int) {
+			evicted = append(evicted, key)
+		}),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		om.Store(i, i)
+	}
+	_, _ = om.Get(0) // Not tracked while unbounded
+
+	assert.NoError(t, om.SetMaxSize(5))
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, evicted)
+	assert.Equal(t, 5, om.Len())
+
+	_, err = om.Get(5)
+	assert.NoError(t, err)
+	om.Store(10, 10)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 6}, evicted)
+
+	assert.NoError(t, om.SetMaxSize(0))
+	om.Store(11, 11)
+	assert.Equal(t, 6, om.Len())
+
+	assert.ErrorIs(t, om.SetMaxSize(-1), ErrInvalidOption)
+}
+
+func TestOrderedMapEvictionCallbackMayUseMap(t *testing.T) {
+	var om *OrderedMap[int, int]
+	om, err := New[int, int](
+		WithMaxSize[int, int](2),
+		WithEvictionCallback(func(key int, _ int) {
+			_, err := om.Get(key)
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+			assert.Equal(t, 2, om.Len())
+		}),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		om.Store(i, i)
+	}
+	assert.Equal(t, []int{3, 4}, pairKeys(om.GetAll()))
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	policy, err := ParseEvictionPolicy("lru")
+	assert.NoError(t, err)
+	assert.Equal(t, EvictLRU, policy)
+
+	policy, err = ParseEvictionPolicy("fifo")
+	assert.NoError(t, err)
+	assert.Equal(t, EvictFIFO, policy)
+
+	_, err = ParseEvictionPolicy("random")
+	assert.ErrorIs(t, err, ErrInvalidOption)
+}
+
+func BenchmarkOrderedMapBounded(b *testing.B) {
+	for _, policy := range []EvictionPolicy{EvictFIFO, EvictLRU} {
+		b.Run([]string{"FIFO", "LRU"}[policy], func(b *testing.B) {
+			om, err := New[int, int](WithMaxSize[int, int](1000), WithEvictionPolicy[int, int](policy))
+			assert.NoError(b, err)
+
+			for i := 0; i < b.N; i++ {
+				om.Store(i, i)
+				_, _ = om.Get(i - 500)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package orderedmap
+
+import "iter"
+
+// Iterators hold the read lock for the whole traversal,
+// so the map must not be modified from within the loop body. Expired keys are skipped.
+
+// All returns an iterator over key-value pairs in insertion order
+func (om *OrderedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		om.mu.RLock()
+		defer om.mu.RUnlock()
+
+		om.forward(om.root.next, yield)
+	}
+}
+
+// Backward returns an iterator over key-value pairs in reverse insertion order
+func (om *OrderedMap[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		om.mu.RLock()
+		defer om.mu.RUnlock()
+
+		now := om.nowNano()
+		for e := om.root.prev; e != &om.root; e = e.prev {
+			if e.expired(now) {
+				continue
+			}
+			if !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// From returns an iterator over key-value pairs in insertion order starting at the given key (inclusive).
+// The iterator yields nothing if the key is not in the map.
+func (om *OrderedMap[K, V]) From(key K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		om.mu.RLock()
+		defer om.mu.RUnlock()
+
+		if e, exists := om.items[key]; exists && !e.expired(om.nowNano()) {
+			om.forward(e, yield)
+		}
+	}
+}
+
+// Keys returns an iterator over keys in insertion order
+func (om *OrderedMap[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range om.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns an iterator over values in insertion order
+func (om *OrderedMap[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, value := range om.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// forward yields entries starting at e until the end of the list, the caller must hold the read lock
+func (om *OrderedMap[K, V]) forward(e *entry[K, V], yield func(K, V) bool) {
+	now := om.nowNano()
+	for ; e != &om.root; e = e.next {
+		if e.expired(now) {
+			continue
+		}
+		if !yield(e.key, e.value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package orderedmap
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedMapIterators(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		om.Store(key, i)
+	}
+	assert.NoError(t, om.Delete("c"))
+
+	// Test All
+	var keys []string
+	var values []int
+	for key, value := range om.All() {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	assert.Equal(t, []string{"a", "b", "d", "e"}, keys)
+	assert.Equal(t, []int{0, 1, 3, 4}, values)
+
+	// Test Backward
+	keys = keys[:0]
+	for key := range om.Backward() {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"e", "d", "b", "a"}, keys)
+
+	// Test From
+	keys = keys[:0]
+	for key := range om.From("b") {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"b", "d", "e"}, keys)
+
+	keys = keys[:0]
+	for key := range om.From("c") {
+		keys = append(keys, key)
+	}
+	assert.Empty(t, keys)
+
+	// Test Keys and Values
+	assert.Equal(t, []string{"a", "b", "d", "e"}, slices.Collect(om.Keys()))
+	assert.Equal(t, []int{0, 1, 3, 4}, slices.Collect(om.Values()))
+	assert.Equal(t, map[string]int{"a": 0, "b": 1, "d": 3, "e": 4}, maps.Collect(om.All()))
+
+	// Test early break releases the lock
+	for key := range om.All() {
+		if key == "b" {
+			break
+		}
+	}
+	om.Store("f", 5)
+	assert.Equal(t, []string{"a", "b", "d", "e", "f"}, slices.Collect(om.Keys()))
+}
+
+func BenchmarkOrderedMapIterate(b *testing.B) {
+	om, err := New[int, int](WithCapacity[int, int](100000))
+	assert.NoError(b, err)
+	for i := 0; i < 100000; i++ {
+		om.Store(i, i)
+	}
+
+	b.Run("GetAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			for _, pair := range om.GetAll() {
+				sum += pair.Value
+			}
+		}
+	})
+
+	b.Run("All", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			for _, value := range om.All() {
+				sum += value
+			}
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package orderedmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Snapshot layout: magic, format version (uint16), number of entries (uint64),
+// followed by gob-encoded entries in insertion order.
+// Version 1 entries are plain pairs, version 2 adds the expiration time,
+// version 3 adds key versions and the last assigned version before the entries.
+const (
+	snapshotVersionPairs    uint16 = 1
+	snapshotVersionExpiry   uint16 = 2
+	snapshotVersionVersions uint16 = 3
+	snapshotVersion                = snapshotVersionVersions
+)
+
+var snapshotMagic = [4]byte{'O', 'M', 'A', 'P'}
+
+var (
+	// ErrInvalidSnapshot is returned when restoring from data which is not a snapshot
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	// ErrUnsupportedSnapshotVersion is returned when restoring a snapshot written by an unknown format version
+	ErrUnsupportedSnapshotVersion = errors.New("unsupported snapshot version")
+)
+
+type snapshotHeader struct {
+	Magic   [4]byte
+	Version uint16
+	Count   uint64
+}
+
+type snapshotEntry[K comparable, V any] struct {
+	Key       K
+	Value     V
+	ExpiresAt int64 // Unix time in nanoseconds, zero if the key never expires
+	Version   uint64
+}
+
+// Snapshot writes a point-in-time copy of the map to w, preserving the insertion order
+// and expiration times. Expired keys are skipped. Writers are blocked until the snapshot is written.
+func (om *OrderedMap[K, V]) Snapshot(w io.Writer) error {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+
+	now := om.nowNano()
+	count := 0
+	for e := om.root.next; e != &om.root; e = e.next {
+		if !e.expired(now) {
+			count++
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	header := snapshotHeader{
+		Magic:   snapshotMagic,
+		Version: snapshotVersion,
+		Count:   uint64(count),
+	}
+	if err := binary.Write(bw, binary.BigEndian, header); err != nil {
+		return fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+
+	encoder := gob.NewEncoder(bw)
+	if err := encoder.Encode(om.version); err != nil {
+		return fmt.Errorf("failed to write snapshot version counter: %w", err)
+	}
+	for e := om.root.next; e != &om.root; e = e.next {
+		if e.expired(now) {
+			continue
+		}
+		entry := snapshotEntry[K, V]{Key: e.key, Value: e.value, ExpiresAt: e.expiresAt, Version: e.version}
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write snapshot entry: %w", err)
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore replaces the contents of the map with a snapshot read from r, keys expired since
+// the snapshot was taken are dropped. The map is left unchanged if the snapshot can't be read.
+func (om *OrderedMap[K, V]) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	var header snapshotHeader
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("%w: failed to read header: %v", ErrInvalidSnapshot, err)
+	}
+	if header.Magic != snapshotMagic {
+		return ErrInvalidSnapshot
+	}
+	if header.Version < snapshotVersionPairs || header.Version > snapshotVersionVersions {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSnapshotVersion, header.Version)
+	}
+
+	// Decode everything before touching the map
+	entries := make([]snapshotEntry[K, V], 0, min(header.Count, 1<<16))
+	decoder := gob.NewDecoder(br)
+	var lastVersion uint64
+	if header.Version >= snapshotVersionVersions {
+		if err := decoder.Decode(&lastVersion); err != nil {
+			return fmt.Errorf("%w: failed to read version counter: %v", ErrInvalidSnapshot, err)
+		}
+	}
+	for i := uint64(0); i < header.Count; i++ {
+		var entry snapshotEntry[K, V]
+		var err error
+		if header.Version == snapshotVersionPairs {
+			var pair Pair[K, V]
+			err = decoder.Decode(&pair)
+			entry = snapshotEntry[K, V]{Key: pair.Key, Value: pair.Value}
+		} else {
+			err = decoder.Decode(&entry)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: failed to read entry %d: %v", ErrInvalidSnapshot, i, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	om.mu.Lock()
+	defer om.unlock()
+
+	now := om.nowNano()
+	om.initialize(len(entries))
+	for _, entry := range entries {
+		if entry.ExpiresAt != 0 && entry.ExpiresAt <= now {
+			continue
+		}
+		om.store(entry.Key, entry.Value, entry.ExpiresAt, now)
+		if e, exists := om.items[entry.Key]; exists && entry.Version != 0 {
+			e.version = entry.Version
+		}
+	}
+	// Older formats have no versions, the restored keys got new ones from the current counter
+	om.version = max(om.version, lastVersion)
+	return nil
+}
@@ -0,0 +1,73 @@
+package orderedmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedMapSnapshotRestore(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+
+	for i, key := range []string{"e", "d", "c", "b", "a"} {
+		om.Store(key, i)
+	}
+	assert.NoError(t, om.Delete("c"))
+	om.Store("c", 42)
+
+	var buf bytes.Buffer
+	assert.NoError(t, om.Snapshot(&buf))
+
+	// Test restore into an empty map
+	restored, err := New[string, int]()
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, om.GetAll(), restored.GetAll())
+
+	// Test restore replaces existing data and new keys go after the restored ones
+	other, err := New[string, int](WithInitialData(Pair[string, int]{"z", 0}))
+	assert.NoError(t, err)
+	assert.NoError(t, other.Restore(bytes.NewReader(buf.Bytes())))
+	other.Store("f", 5)
+	assert.Equal(t, []string{"e", "d", "b", "a", "c", "f"}, pairKeys(other.GetAll()))
+
+	// Test empty map snapshot
+	empty, err := New[string, int]()
+	assert.NoError(t, err)
+	buf.Reset()
+	assert.NoError(t, empty.Snapshot(&buf))
+	assert.NoError(t, restored.Restore(&buf))
+	assert.Equal(t, 0, restored.Len())
+}
+
+func TestOrderedMapRestoreInvalid(t *testing.T) {
+	om, err := New[string, int](WithInitialData(Pair[string, int]{"a", 1}))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, om.Snapshot(&buf))
+	valid := buf.Bytes()
+
+	target, err := New[string, int](WithInitialData(Pair[string, int]{"x", 0}))
+	assert.NoError(t, err)
+
+	// Test garbage
+	err = target.Restore(bytes.NewReader([]byte("garbage")))
+	assert.ErrorIs(t, err, ErrInvalidSnapshot)
+
+	// Test unknown version
+	corrupted := bytes.Clone(valid)
+	binary.BigEndian.PutUint16(corrupted[4:6], 999)
+	err = target.Restore(bytes.NewReader(corrupted))
+	assert.ErrorIs(t, err, ErrUnsupportedSnapshotVersion)
+
+	// Test truncated data
+	err = target.Restore(bytes.NewReader(valid[:len(valid)-2]))
+	assert.ErrorIs(t, err, ErrInvalidSnapshot)
+
+	// The map is untouched after failed restores
+	assert.Equal(t, []Pair[string, int]{{Key: "x", Value: 0}}, target.GetAll())
+}
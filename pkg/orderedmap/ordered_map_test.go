@@ -2,6 +2,7 @@ package orderedmap
 
 import (
 	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 
@@ -63,7 +64,50 @@ func TestOrderedMapOperations(t *testing.T) {
 	// Test WithCapacity
 	omWithCapacity, err := New[string, string](WithCapacity[string, string](10))
 	assert.NoError(t, err)
-	assert.Equal(t, 10, cap(omWithCapacity.order))
+	assert.Equal(t, 0, omWithCapacity.Len())
+}
+
+func TestOrderedMapKeepsInsertionOrderAfterDelete(t *testing.T) {
+	om, err := New[int, int]()
+	assert.NoError(t, err)
+
+	const size = 1000
+	expected := make([]int, 0, size)
+	for i := 0; i < size; i++ {
+		om.Store(i, i*2)
+		expected = append(expected, i)
+	}
+
+	// Delete random keys, including the first and the last ones
+	rng := rand.New(rand.NewSource(42))
+	deleted := map[int]bool{0: true, size - 1: true}
+	for len(deleted) < size/2 {
+		deleted[rng.Intn(size)] = true
+	}
+	for key := range deleted {
+		assert.NoError(t, om.Delete(key))
+	}
+	assert.ErrorIs(t, om.Delete(0), ErrKeyNotFound)
+
+	// Overwriting must not move the key, re-adding a deleted key must append it
+	om.Store(1, -1)
+	om.Store(0, 0)
+
+	var want []Pair[int, int]
+	for _, key := range expected {
+		if deleted[key] {
+			continue
+		}
+		value := key * 2
+		if key == 1 {
+			value = -1
+		}
+		want = append(want, Pair[int, int]{Key: key, Value: value})
+	}
+	want = append(want, Pair[int, int]{Key: 0, Value: 0})
+
+	assert.Equal(t, want, om.GetAll())
+	assert.Equal(t, len(want), om.Len())
 }
 
 func BenchmarkOrderedMap(b *testing.B) {
@@ -89,6 +133,25 @@ func BenchmarkOrderedMap(b *testing.B) {
 	})
 }
 
+// BenchmarkOrderedMapDeleteMiddle deletes keys from the middle of maps of growing size,
+// ns/op must stay flat to confirm that Delete is O(1)
+func BenchmarkOrderedMapDeleteMiddle(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("Size_%d", size), func(b *testing.B) {
+			om, err := New[int, int](WithCapacity[int, int](size + b.N))
+			assert.NoError(b, err)
+			for i := 0; i < size+b.N; i++ {
+				om.Store(i, i)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = om.Delete(size/2 + i)
+			}
+		})
+	}
+}
+
 func TestPerformanceOrderedMap(t *testing.T) {
 	sizes := []int{100, 1000, 10000, 100000}
 
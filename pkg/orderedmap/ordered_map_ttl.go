@@ -0,0 +1,154 @@
+package orderedmap
+
+import (
+	"container/heap"
+	"time"
+)
+
+// sweepBatchSize limits how many expired keys the sweeper removes under one write lock
+const sweepBatchSize = 256
+
+// WithSweepInterval starts a background sweeper removing expired keys every interval.
+// Without it expired keys are only hidden from reads and removed lazily. Call Close to stop the sweeper.
+func WithSweepInterval[K comparable, V any](interval time.Duration) InitOption[K, V] {
+	return func(c *initConfig[K, V]) {
+		c.sweepInterval = interval
+	}
+}
+
+// WithClock sets the time source used for expiration, time.Now by default
+func WithClock[K comparable, V any](now func() time.Time) InitOption[K, V] {
+	return func(c *initConfig[K, V]) {
+		c.now = now
+	}
+}
+
+// StoreWithTTL stores a key-value pair in the map which expires after ttl and returns the new version of the key.
+// A non-positive ttl means the key never expires.
+func (om *OrderedMap[K, V]) StoreWithTTL(key K, value V, ttl time.Duration) uint64 {
+	om.mu.Lock()
+	defer om.unlock()
+
+	now := om.nowNano()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = now + int64(ttl)
+	}
+	return om.store(key, value, expiresAt, now)
+}
+
+// StoreWithDeadline stores a key-value pair in the map which expires at the given time and returns
+// the new version of the key. A zero deadline means the key never expires,
+// a deadline in the past makes the key expired right away.
+func (om *OrderedMap[K, V]) StoreWithDeadline(key K, value V, deadline time.Time) uint64 {
+	om.mu.Lock()
+	defer om.unlock()
+
+	return om.store(key, value, deadlineNano(deadline), om.nowNano())
+}
+
+// Sweep removes expired keys and returns how many were removed.
+// The write lock is released between batches, so readers and writers are not blocked for long.
+func (om *OrderedMap[K, V]) Sweep() int {
+	removed := 0
+	for {
+		n := om.sweepBatch()
+		removed += n
+		if n < sweepBatchSize {
+			return removed
+		}
+	}
+}
+
+func (om *OrderedMap[K, V]) sweepBatch() int {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+
+	now := om.nowNano()
+	removed := 0
+	for removed < sweepBatchSize && len(om.expiry) > 0 && om.expiry[0].expired(now) {
+		om.remove(om.expiry[0])
+		removed++
+	}
+	return removed
+}
+
+func (om *OrderedMap[K, V]) sweepLoop(interval time.Duration) {
+	defer om.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			om.Sweep()
+		case <-om.stopChan:
+			return
+		}
+	}
+}
+
+// removeExpired removes the key if it's still expired, used for lazy expiration on reads
+func (om *OrderedMap[K, V]) removeExpired(key K) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+
+	if e, exists := om.items[key]; exists && e.expired(om.nowNano()) {
+		om.remove(e)
+	}
+}
+
+// setExpiry updates the expiration time of an entry and its place in the expiry heap,
+// the caller must hold the write lock
+func (om *OrderedMap[K, V]) setExpiry(e *entry[K, V], expiresAt int64) {
+	e.expiresAt = expiresAt
+	switch {
+	case expiresAt == 0 && e.heapIndex >= 0:
+		heap.Remove(&om.expiry, e.heapIndex)
+	case expiresAt != 0 && e.heapIndex >= 0:
+		heap.Fix(&om.expiry, e.heapIndex)
+	case expiresAt != 0:
+		heap.Push(&om.expiry, e)
+	}
+}
+
+func (om *OrderedMap[K, V]) nowNano() int64 {
+	return om.now().UnixNano()
+}
+
+// deadlineNano converts a deadline to the expiration time of an entry
+func deadlineNano(deadline time.Time) int64 {
+	if deadline.IsZero() {
+		return 0
+	}
+	return deadline.UnixNano()
+}
+
+// expiryHeap is a min-heap of entries by expiration time, implementing heap.Interface
+type expiryHeap[K comparable, V any] []*entry[K, V]
+
+func (h expiryHeap[K, V]) Len() int { return len(h) }
+
+func (h expiryHeap[K, V]) Less(i, j int) bool { return h[i].expiresAt < h[j].expiresAt }
+
+func (h expiryHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *expiryHeap[K, V]) Push(x any) {
+	e := x.(*entry[K, V])
+	e.heapIndex = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap[K, V]) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.heapIndex = -1
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,171 @@
+package orderedmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a manually advanced time source
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestOrderedMapTTL(t *testing.T) {
+	clock := newFakeClock()
+	om, err := New[string, int](WithClock[string, int](clock.Now))
+	assert.NoError(t, err)
+
+	om.Store("persistent", 0)
+	om.StoreWithTTL("short", 1, time.Second)
+	om.StoreWithTTL("long", 2, time.Minute)
+	om.StoreWithTTL("zero", 3, 0)
+
+	val, err := om.Get("short")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, val)
+
+	clock.Advance(2 * time.Second)
+
+	// Test expired key is hidden from all reads
+	_, err = om.Get("short")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Equal(t, []string{"persistent", "long", "zero"}, pairKeys(om.GetAll()))
+	assert.Equal(t, []string{"persistent", "long", "zero"}, slices.Collect(om.Keys()))
+	page, _, err := om.Page(nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"persistent", "long", "zero"}, pairKeys(page))
+	assert.Equal(t, 3, om.Len(), "Get removes expired key lazily")
+
+	// Test overwriting without TTL makes the key persistent
+	om.Store("long", 20)
+	clock.Advance(time.Hour)
+	val, err = om.Get("long")
+	assert.NoError(t, err)
+	assert.Equal(t, 20, val)
+
+	// Test an expired key is re-added to the end
+	om.StoreWithTTL("first", 4, time.Second)
+	om.Store("last", 5)
+	clock.Advance(time.Second)
+	om.Store("first", 6)
+	assert.Equal(t, []string{"persistent", "long", "zero", "last", "first"}, pairKeys(om.GetAll()))
+
+	// Test deleting an expired key
+	om.StoreWithTTL("doomed", 7, time.Second)
+	clock.Advance(time.Second)
+	assert.ErrorIs(t, om.Delete("doomed"), ErrKeyNotFound)
+
+	// Test deadline in the past
+	om.Store("replaced", 8)
+	om.StoreWithDeadline("replaced", 9, clock.Now().Add(-time.Second))
+	_, err = om.Get("replaced")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestOrderedMapSweep(t *testing.T) {
+	clock := newFakeClock()
+	om, err := New[int, int](WithClock[int, int](clock.Now))
+	assert.NoError(t, err)
+
+	const size = 3*sweepBatchSize + 10
+	for i := 0; i < size; i++ {
+		om.StoreWithTTL(i, i, time.Duration(i%3+1)*time.Second)
+	}
+	om.Store(-1, -1)
+
+	clock.Advance(time.Second)
+	assert.Equal(t, (size+2)/3, om.Sweep())
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, size-(size+2)/3, om.Sweep())
+	assert.Equal(t, 1, om.Len())
+	assert.Empty(t, om.expiry)
+	assert.Equal(t, 0, om.Sweep())
+}
+
+func TestOrderedMapBackgroundSweeper(t *testing.T) {
+	om, err := New[int, int](WithSweepInterval[int, int](5 * time.Millisecond))
+	assert.NoError(t, err)
+	defer om.Close()
+
+	for i := 0; i < 100; i++ {
+		om.StoreWithTTL(i, i, 10*time.Millisecond)
+	}
+	om.Store(100, 100)
+
+	assert.Eventually(t, func() bool {
+		return om.Len() == 1
+	}, time.Second, 5*time.Millisecond)
+
+	om.Close()
+	om.Close()
+}
+
+func TestOrderedMapSnapshotTTL(t *testing.T) {
+	clock := newFakeClock()
+	om, err := New[string, int](WithClock[string, int](clock.Now))
+	assert.NoError(t, err)
+
+	om.StoreWithTTL("a", 1, time.Minute)
+	om.StoreWithTTL("b", 2, time.Second)
+	om.Store("c", 3)
+	om.StoreWithTTL("d", 4, time.Hour)
+	om.StoreWithTTL("expired", 5, time.Millisecond)
+	clock.Advance(time.Millisecond)
+
+	var buf bytes.Buffer
+	assert.NoError(t, om.Snapshot(&buf))
+
+	restored, err := New[string, int](WithClock[string, int](clock.Now))
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, pairKeys(restored.GetAll()))
+
+	// Expiration times survive the restore
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, []string{"c", "d"}, pairKeys(restored.GetAll()))
+
+	// Keys expired while the snapshot was stored are dropped
+	late, err := New[string, int](WithClock[string, int](clock.Now))
+	assert.NoError(t, err)
+	assert.NoError(t, late.Restore(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, 2, late.Len())
+}
+
+func TestOrderedMapRestoreVersion1(t *testing.T) {
+	var buf bytes.Buffer
+	header := snapshotHeader{Magic: snapshotMagic, Version: snapshotVersionPairs, Count: 2}
+	assert.NoError(t, binary.Write(&buf, binary.BigEndian, header))
+	encoder := gob.NewEncoder(&buf)
+	assert.NoError(t, encoder.Encode(Pair[string, int]{Key: "b", Value: 2}))
+	assert.NoError(t, encoder.Encode(Pair[string, int]{Key: "a", Value: 1}))
+
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+	assert.NoError(t, om.Restore(&buf))
+	assert.Equal(t, []Pair[string, int]{{Key: "b", Value: 2}, {Key: "a", Value: 1}}, om.GetAll())
+}
@@ -0,0 +1,140 @@
+package orderedmap
+
+import "time"
+
+// Tx stages writes to the map, they are applied by Update all at once or not at all.
+// A Tx is only valid inside the function passed to Update.
+type Tx[K comparable, V any] struct {
+	om      *OrderedMap[K, V]
+	now     int64
+	version uint64 // Last version given to a staged write
+
+	staged map[K]txState[V] // State of the keys written by the transaction
+	ops    []txOp[K, V]
+}
+
+// txState is the value a key has after the staged writes
+type txState[V any] struct {
+	value   V
+	version uint64
+	exists  bool
+}
+
+// txOp is a staged write
+type txOp[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt int64
+	delete    bool
+}
+
+// Update runs fn under the write lock and applies the writes staged on tx if fn returns nil.
+// If fn returns an error, the map is left untouched and the error is returned.
+// Reads through tx see the staged writes, versions match the ones the writes get once applied.
+// Keys over maxSize are evicted only after all writes are applied.
+func (om *OrderedMap[K, V]) Update(fn func(tx *Tx[K, V]) error) error {
+	om.mu.Lock()
+	defer om.unlock()
+
+	tx := &Tx[K, V]{
+		om:      om,
+		now:     om.nowNano(),
+		version: om.version,
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for _, op := range tx.ops {
+		if op.delete {
+			if e, exists := om.items[op.key]; exists {
+				om.remove(e)
+			}
+			continue
+		}
+		om.insert(op.key, op.value, op.expiresAt, tx.now)
+	}
+	om.evictOverflow(tx.now)
+	return nil
+}
+
+// Get retrieves a value as seen by the transaction
+func (tx *Tx[K, V]) Get(key K) (V, error) {
+	value, _, err := tx.GetWithVersion(key)
+	return value, err
+}
+
+// GetWithVersion retrieves a value and its version as seen by the transaction
+func (tx *Tx[K, V]) GetWithVersion(key K) (V, uint64, error) {
+	state := tx.lookup(key)
+	if !state.exists {
+		var zero V
+		return zero, 0, ErrKeyNotFound
+	}
+	return state.value, state.version, nil
+}
+
+// StoreWithDeadline stages a write of a key-value pair which expires at the given time
+// and returns the version the key gets. A zero deadline means the key never expires.
+func (tx *Tx[K, V]) StoreWithDeadline(key K, value V, deadline time.Time) uint64 {
+	expiresAt := deadlineNano(deadline)
+	tx.version++
+	tx.stage(key, txState[V]{
+		value:   value,
+		version: tx.version,
+		exists:  expiresAt == 0 || expiresAt > tx.now,
+	})
+	tx.ops = append(tx.ops, txOp[K, V]{key: key, value: value, expiresAt: expiresAt})
+	return tx.version
+}
+
+// Delete stages a deletion of a key
+func (tx *Tx[K, V]) Delete(key K) error {
+	if !tx.lookup(key).exists {
+		return ErrKeyNotFound
+	}
+	tx.stage(key, txState[V]{})
+	tx.ops = append(tx.ops, txOp[K, V]{key: key, delete: true})
+	return nil
+}
+
+// CompareAndSwap stages a write only if the key exists and has the expected version.
+// Returns the new version, or the current version with ErrVersionMismatch.
+func (tx *Tx[K, V]) CompareAndSwap(key K, expected uint64, value V, deadline time.Time) (uint64, error) {
+	state := tx.lookup(key)
+	if !state.exists {
+		return 0, ErrKeyNotFound
+	}
+	if state.version != expected {
+		return state.version, ErrVersionMismatch
+	}
+	return tx.StoreWithDeadline(key, value, deadline), nil
+}
+
+// StoreIfAbsent stages a write only if the key doesn't exist.
+// Returns the new version, or the current version with ErrKeyExists.
+func (tx *Tx[K, V]) StoreIfAbsent(key K, value V, deadline time.Time) (uint64, error) {
+	if state := tx.lookup(key); state.exists {
+		return state.version, ErrKeyExists
+	}
+	return tx.StoreWithDeadline(key, value, deadline), nil
+}
+
+// lookup returns the state of a key after the staged writes
+func (tx *Tx[K, V]) lookup(key K) txState[V] {
+	if state, staged := tx.staged[key]; staged {
+		return state
+	}
+	e, exists := tx.om.items[key]
+	if !exists || e.expired(tx.now) {
+		return txState[V]{}
+	}
+	return txState[V]{value: e.value, version: e.version, exists: true}
+}
+
+func (tx *Tx[K, V]) stage(key K, state txState[V]) {
+	if tx.staged == nil {
+		tx.staged = make(map[K]txState[V])
+	}
+	tx.staged[key] = state
+}
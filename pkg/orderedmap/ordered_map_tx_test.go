@@ -0,0 +1,127 @@
+package orderedmap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedMapUpdate(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+
+	om.Store("a", 1)
+	versionB := om.Store("b", 2)
+
+	var versions []uint64
+	err = om.Update(func(tx *Tx[string, int]) error {
+		versions = append(versions, tx.StoreWithDeadline("c", 3, time.Time{}))
+		if err := tx.Delete("a"); err != nil {
+			return err
+		}
+		version, err := tx.CompareAndSwap("b", versionB, 20, time.Time{})
+		if err != nil {
+			return err
+		}
+		versions = append(versions, version)
+
+		// Test reads see the staged writes
+		_, err = tx.Get("a")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		value, version, err := tx.GetWithVersion("c")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, value)
+		assert.Equal(t, versions[0], version)
+
+		// Test the map is untouched until fn returns
+		assert.Equal(t, 1, om.items["a"].value)
+		assert.NotContains(t, om.items, "c")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Pair[string, int]{{Key: "b", Value: 20}, {Key: "c", Value: 3}}, om.GetAll())
+
+	// Test the staged versions are the applied ones
+	_, version, err := om.GetWithVersion("c")
+	assert.NoError(t, err)
+	assert.Equal(t, versions[0], version)
+	_, version, err = om.GetWithVersion("b")
+	assert.NoError(t, err)
+	assert.Equal(t, versions[1], version)
+}
+
+func TestOrderedMapUpdateRollback(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+
+	om.Store("a", 1)
+	versionB, _ := om.StoreIfAbsent("b", 2, time.Time{})
+
+	errAbort := errors.New("abort")
+	err = om.Update(func(tx *Tx[string, int]) error {
+		tx.StoreWithDeadline("c", 3, time.Time{})
+		assert.NoError(t, tx.Delete("a"))
+		if _, err := tx.StoreIfAbsent("b", 20, time.Time{}); err != nil {
+			return errAbort
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, errAbort)
+	assert.Equal(t, []Pair[string, int]{{Key: "a", Value: 1}, {Key: "b", Value: 2}}, om.GetAll())
+
+	// Test a discarded transaction doesn't consume versions
+	version := om.Store("d", 4)
+	assert.Equal(t, versionB+1, version)
+}
+
+func TestOrderedMapUpdateStagedConflicts(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+
+	err = om.Update(func(tx *Tx[string, int]) error {
+		version, err := tx.StoreIfAbsent("a", 1, time.Time{})
+		assert.NoError(t, err)
+
+		// Test the staged key is seen as existing
+		current, err := tx.StoreIfAbsent("a", 2, time.Time{})
+		assert.ErrorIs(t, err, ErrKeyExists)
+		assert.Equal(t, version, current)
+
+		_, err = tx.CompareAndSwap("a", version+1, 3, time.Time{})
+		assert.ErrorIs(t, err, ErrVersionMismatch)
+
+		// Test the staged deletion is seen as missing
+		assert.NoError(t, tx.Delete("a"))
+		assert.ErrorIs(t, tx.Delete("a"), ErrKeyNotFound)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, om.Len())
+}
+
+func TestOrderedMapUpdateEvictsAfterApply(t *testing.T) {
+	var evicted []string
+	om, err := New[string, int](
+		WithMaxSize[string, int](2),
+		WithEvictionPolicy[string, int](EvictLRU),
+		WithEvictionCallback(func(key string, _ int) {
+			evicted = append(evicted, key)
+		}),
+	)
+	assert.NoError(t, err)
+
+	versionA := om.Store("a", 1)
+	om.Store("b", 2)
+
+	// Test a key added by the transaction doesn't evict one it writes later
+	err = om.Update(func(tx *Tx[string, int]) error {
+		tx.StoreWithDeadline("c", 3, time.Time{})
+		_, err := tx.CompareAndSwap("a", versionA, 10, time.Time{})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, []Pair[string, int]{{Key: "a", Value: 10}, {Key: "c", Value: 3}}, om.GetAll())
+}
@@ -0,0 +1,52 @@
+package orderedmap
+
+import "time"
+
+// GetWithVersion retrieves a value and its version from the map
+func (om *OrderedMap[K, V]) GetWithVersion(key K) (V, uint64, error) {
+	om.mu.RLock()
+	if om.tracksAccess() {
+		om.mu.RUnlock()
+		return om.getAndTouch(key)
+	}
+	defer om.mu.RUnlock()
+
+	e, exists := om.items[key]
+	if !exists || e.expired(om.nowNano()) {
+		var zero V
+		return zero, 0, ErrKeyNotFound
+	}
+	return e.value, e.version, nil
+}
+
+// CompareAndSwap stores the value only if the key exists and has the expected version.
+// Returns the new version, or the current version with ErrVersionMismatch.
+// A zero deadline means the key never expires.
+func (om *OrderedMap[K, V]) CompareAndSwap(key K, expected uint64, value V, deadline time.Time) (uint64, error) {
+	om.mu.Lock()
+	defer om.unlock()
+
+	now := om.nowNano()
+	e, exists := om.items[key]
+	if !exists || e.expired(now) {
+		return 0, ErrKeyNotFound
+	}
+	if e.version != expected {
+		return e.version, ErrVersionMismatch
+	}
+	return om.store(key, value, deadlineNano(deadline), now), nil
+}
+
+// StoreIfAbsent stores the value only if the key doesn't exist.
+// Returns the new version, or the current version with ErrKeyExists.
+// A zero deadline means the key never expires.
+func (om *OrderedMap[K, V]) StoreIfAbsent(key K, value V, deadline time.Time) (uint64, error) {
+	om.mu.Lock()
+	defer om.unlock()
+
+	now := om.nowNano()
+	if e, exists := om.items[key]; exists && !e.expired(now) {
+		return e.version, ErrKeyExists
+	}
+	return om.store(key, value, deadlineNano(deadline), now), nil
+}
@@ -0,0 +1,149 @@
+package orderedmap
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedMapVersions(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+
+	v1 := om.Store("a", 1)
+	v2 := om.Store("b", 2)
+	assert.Greater(t, v2, v1)
+
+	// Test overwrite bumps the version
+	v3 := om.Store("a", 10)
+	assert.Greater(t, v3, v2)
+
+	value, version, err := om.GetWithVersion("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, value)
+	assert.Equal(t, v3, version)
+
+	// Test re-created key never gets a version it had before
+	assert.NoError(t, om.Delete("a"))
+	v4 := om.Store("a", 1)
+	assert.Greater(t, v4, v3)
+
+	_, _, err = om.GetWithVersion("missing")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestOrderedMapCompareAndSwap(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+
+	version := om.Store("a", 1)
+
+	// Test successful swap
+	newVersion, err := om.CompareAndSwap("a", version, 2, time.Time{})
+	assert.NoError(t, err)
+	assert.Greater(t, newVersion, version)
+
+	// Test stale version
+	current, err := om.CompareAndSwap("a", version, 3, time.Time{})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	assert.Equal(t, newVersion, current)
+
+	value, err := om.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, value)
+
+	// Test missing key
+	_, err = om.CompareAndSwap("b", 1, 1, time.Time{})
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// Test swap with deadline
+	_, err = om.CompareAndSwap("a", newVersion, 4, time.Now().Add(-time.Second))
+	assert.NoError(t, err)
+	_, err = om.Get("a")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestOrderedMapStoreIfAbsent(t *testing.T) {
+	clock := newFakeClock()
+	om, err := New[string, int](WithClock[string, int](clock.Now))
+	assert.NoError(t, err)
+
+	version, err := om.StoreIfAbsent("a", 1, clock.Now().Add(time.Second))
+	assert.NoError(t, err)
+
+	current, err := om.StoreIfAbsent("a", 2, time.Time{})
+	assert.ErrorIs(t, err, ErrKeyExists)
+	assert.Equal(t, version, current)
+
+	// Test expired key counts as absent
+	clock.Advance(time.Second)
+	_, err = om.StoreIfAbsent("a", 3, time.Time{})
+	assert.NoError(t, err)
+
+	value, err := om.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, value)
+}
+
+func TestOrderedMapConcurrentCompareAndSwap(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+	om.Store("counter", 0)
+
+	const goroutines = 8
+	const increments = 200
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				for {
+					value, version, err := om.GetWithVersion("counter")
+					assert.NoError(t, err)
+					if _, err := om.CompareAndSwap("counter", version, value+1, time.Time{}); err == nil {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := om.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, goroutines*increments, value)
+}
+
+func TestOrderedMapSnapshotVersions(t *testing.T) {
+	om, err := New[string, int]()
+	assert.NoError(t, err)
+
+	om.Store("a", 1)
+	om.Store("b", 2)
+	om.Store("a", 3)
+	om.Store("c", 4)
+	assert.NoError(t, om.Delete("c"))
+
+	var buf bytes.Buffer
+	assert.NoError(t, om.Snapshot(&buf))
+
+	restored, err := New[string, int]()
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Restore(&buf))
+
+	for _, key := range []string{"a", "b"} {
+		_, expected, err := om.GetWithVersion(key)
+		assert.NoError(t, err)
+		_, version, err := restored.GetWithVersion(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, version)
+	}
+
+	// The counter is restored too, so the deleted key doesn't get its old version back
+	assert.Equal(t, om.Store("c", 5), restored.Store("c", 5))
+}
@@ -1,6 +1,7 @@
 package producer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
 	"github.com/MishkaRogachev/command-queue-executor/pkg/mq"
+	"github.com/google/uuid"
 )
 
 // ResponseHandlerFunc is a function type that handles a response message
@@ -20,6 +22,21 @@ type RequestFeed interface {
 	Close()
 }
 
+// DefaultBatchLinger is how long an incomplete batch waits for more requests if linger is not set
+const DefaultBatchLinger = 5 * time.Millisecond
+
+// Option is a function type for configuring the Producer
+type Option func(p *Producer)
+
+// WithBatching packs up to maxCount requests into one message.
+// An incomplete batch is sent once its first request waited for linger.
+func WithBatching(maxCount int, linger time.Duration) Option {
+	return func(p *Producer) {
+		p.batchSize = maxCount
+		p.batchLinger = linger
+	}
+}
+
 // Producer responsible for sending requests to the message queue and promoting responses to a handler
 type Producer struct {
 	client             mq.ClientMQ
@@ -27,6 +44,8 @@ type Producer struct {
 	feed               RequestFeed
 	timeout            time.Duration
 	maxPendingRequests int
+	batchSize          int // Requests are sent one by one if less than 2
+	batchLinger        time.Duration
 	stopCh             chan struct{}
 	wg                 sync.WaitGroup
 }
@@ -38,8 +57,9 @@ func NewProducer(
 	feed RequestFeed,
 	timeout time.Duration,
 	maxPendingRequests int,
+	options ...Option,
 ) *Producer {
-	return &Producer{
+	p := &Producer{
 		client:             client,
 		handler:            handler,
 		timeout:            timeout,
@@ -47,11 +67,38 @@ func NewProducer(
 		feed:               feed,
 		stopCh:             make(chan struct{}),
 	}
+	for _, option := range options {
+		option(p)
+	}
+	if p.batchLinger <= 0 {
+		p.batchLinger = DefaultBatchLinger
+	}
+	return p
 }
 
 // Start sends requests to the message queue until the request feed is empty
 func (p *Producer) Start() {
 	pending := make(chan struct{}, p.maxPendingRequests)
+	release := func() {
+		p.wg.Done()
+		<-pending
+	}
+
+	send := func(req models.RequestWrapper) {
+		go p.send(req, release)
+	}
+	flush := func() {}
+	if p.batchSize > 1 {
+		batchCh := make(chan models.RequestWrapper)
+		go p.batchLoop(batchCh, release)
+		send = func(req models.RequestWrapper) {
+			batchCh <- req
+		}
+		// Closing the channel sends the incomplete batch right away
+		flush = func() {
+			close(batchCh)
+		}
+	}
 
 	for {
 		if p.feed.IsEmpty() {
@@ -61,6 +108,7 @@ func (p *Producer) Start() {
 		select {
 		case <-p.stopCh:
 			fmt.Println("Producer shutting down gracefully...")
+			flush()
 			return
 		default:
 			request, err := p.feed.Next()
@@ -68,40 +116,131 @@ func (p *Producer) Start() {
 				fmt.Printf("Failed to get next request: %v\n", err)
 				continue
 			}
+			// Lets the consumer recognize the request if it's redelivered
+			if request.RequestID == "" {
+				request.RequestID = uuid.New().String()
+			}
 
 			p.wg.Add(1)
 			pending <- struct{}{}
-			go func(req models.RequestWrapper) {
-				defer func() {
-					p.wg.Done()
-					<-pending
-				}()
-
-				rawRequest, err := json.Marshal(req)
-				if err != nil {
-					fmt.Printf("Error serializing request: %v\n", err)
-					return
-				}
-
-				responseChan, err := p.client.Request(string(rawRequest))
-				if err != nil {
-					fmt.Printf("Error sending request: %v\n", err)
-					return
-				}
-
-				select {
-				case response := <-responseChan:
-					p.handler(response)
-				case <-time.After(p.timeout):
-					fmt.Println("No response received in time")
-				}
-			}(request)
+			send(request)
 		}
 	}
 
+	flush()
 	p.wg.Wait()
 }
 
+// send sends one request and waits for the response, release is called when it's done
+func (p *Producer) send(req models.RequestWrapper, release func()) {
+	defer release()
+
+	rawRequest, err := json.Marshal(req)
+	if err != nil {
+		fmt.Printf("Error serializing request: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	responseChan, err := p.client.RequestContext(ctx, string(rawRequest))
+	if err != nil {
+		fmt.Printf("Error sending request: %v\n", err)
+		return
+	}
+	p.awaitResponse(ctx, responseChan)
+}
+
+// batchLoop collects requests into batches until batchCh is closed.
+// A batch is sent when it's full or when its first request waited for batchLinger.
+func (p *Producer) batchLoop(batchCh <-chan models.RequestWrapper, release func()) {
+	var batch []models.RequestWrapper
+	linger := time.NewTimer(p.batchLinger)
+	linger.Stop()
+
+	flush := func() {
+		linger.Stop()
+		if len(batch) > 0 {
+			go p.sendBatch(batch, release)
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case req, ok := <-batchCh:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, req)
+			if len(batch) == 1 {
+				linger.Reset(p.batchLinger)
+			}
+			if len(batch) >= p.batchSize {
+				flush()
+			}
+		case <-linger.C:
+			flush()
+		}
+	}
+}
+
+// sendBatch sends requests in one message and waits for the responses, release is called for every request
+func (p *Producer) sendBatch(batch []models.RequestWrapper, release func()) {
+	rawRequests := make([]string, 0, len(batch))
+	for _, req := range batch {
+		rawRequest, err := json.Marshal(req)
+		if err != nil {
+			fmt.Printf("Error serializing request: %v\n", err)
+			release()
+			continue
+		}
+		rawRequests = append(rawRequests, string(rawRequest))
+	}
+	if len(rawRequests) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	responseChans, err := p.client.RequestBatch(ctx, rawRequests)
+	if err != nil {
+		fmt.Printf("Error sending batch: %v\n", err)
+		for range rawRequests {
+			release()
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, responseChan := range responseChans {
+		wg.Add(1)
+		go func(responseChan <-chan mq.Reply) {
+			defer wg.Done()
+			defer release()
+			p.awaitResponse(ctx, responseChan)
+		}(responseChan)
+	}
+	wg.Wait()
+}
+
+// awaitResponse passes the response to the handler, the request fails without it once ctx is done
+func (p *Producer) awaitResponse(ctx context.Context, responseChan <-chan mq.Reply) {
+	reply := <-responseChan
+	if reply.Err != nil {
+		if ctx.Err() != nil {
+			fmt.Println("No response received in time")
+		} else {
+			fmt.Printf("Request failed: %v\n", reply.Err)
+		}
+		return
+	}
+	p.handler(reply.Data)
+}
+
 // Close signals the producer to shut down gracefully.
 func (p *Producer) Close() {
 	close(p.stopCh)
@@ -1,6 +1,7 @@
 package producer
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"testing"
@@ -197,3 +198,109 @@ func TestConcurrentProducersWithMixedFeeds(t *testing.T) {
 	assert.True(t, fileFeed2.IsEmpty())
 	assert.True(t, randomFeed.IsEmpty())
 }
+
+func TestRandomRequestFeedPaging(t *testing.T) {
+	randomFeed := NewRandomRequestFeed(-1)
+
+	response, err := models.SerializeResponse(models.GetAllItemsResponse{
+		Success:    true,
+		NextCursor: "testCursor",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, randomFeed.HandleResponse(response))
+
+	// Responses of other commands must not reset the cursor
+	response, err = models.SerializeResponse(models.AddItemResponse{Success: true})
+	assert.NoError(t, err)
+	assert.NoError(t, randomFeed.HandleResponse(response))
+
+	var cursors []string
+	for len(cursors) < 2 {
+		request, err := randomFeed.Next()
+		assert.NoError(t, err)
+		if request.Type != models.GetAll {
+			continue
+		}
+
+		var getAllRequest models.GetAllItemsRequest
+		assert.NoError(t, json.Unmarshal(request.Payload, &getAllRequest))
+		assert.GreaterOrEqual(t, getAllRequest.Limit, 1)
+		assert.LessOrEqual(t, getAllRequest.Limit, maxRandomPageLimit)
+		cursors = append(cursors, getAllRequest.Cursor)
+	}
+
+	// The cursor continues only the next GetAll request
+	assert.Equal(t, []string{"testCursor", ""}, cursors)
+}
+
+func TestRandomRequestFeedBursts(t *testing.T) {
+	const pause = 50 * time.Millisecond
+	randomFeed := NewRandomRequestFeed(7, WithBursts(3, pause))
+
+	// Test a pause precedes every burst but the first
+	var paused []bool
+	for !randomFeed.IsEmpty() {
+		started := time.Now()
+		_, err := randomFeed.Next()
+		assert.NoError(t, err)
+		paused = append(paused, time.Since(started) >= pause)
+	}
+	assert.Equal(t, []bool{false, false, false, true, false, false, true}, paused)
+}
+
+func TestProducerWithBatching(t *testing.T) {
+	server := mq.NewInprocServer()
+	defer server.Close()
+
+	reqCh, err := server.ListenForRequests()
+	assert.NoError(t, err)
+
+	// Unpack batches with mockServerHandler, counting messages and requests in them
+	var mu sync.Mutex
+	messages, batched := 0, 0
+	go func() {
+		for req := range reqCh {
+			assert.True(t, req.Batch)
+			requests, err := mq.DecodeBatch(req.Data)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			messages++
+			batched += len(requests)
+			mu.Unlock()
+
+			responses := make([]string, len(requests))
+			for i, request := range requests {
+				responses[i] = mockServerHandler(request)
+			}
+			resp, err := mq.EncodeBatch(responses)
+			assert.NoError(t, err)
+			_ = server.Reply(req.CorrelationID, resp)
+		}
+	}()
+
+	client := mq.NewInprocClient(server)
+
+	var responses int
+	responseHandler := func(response string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		responses++
+		return nil
+	}
+
+	const requestCount = 95
+	randomFeed := NewRandomRequestFeed(requestCount)
+	producer := NewProducer(client, responseHandler, randomFeed, 1*time.Second, 40, WithBatching(10, time.Millisecond))
+
+	producer.Start()
+	producer.Close()
+
+	assert.True(t, randomFeed.IsEmpty())
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, requestCount, responses)
+	assert.Equal(t, requestCount, batched)
+	assert.GreaterOrEqual(t, messages, requestCount/10+1)
+	assert.Less(t, messages, requestCount)
+}
@@ -4,22 +4,50 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/MishkaRogachev/command-queue-executor/pkg/models"
 )
 
+// maxRandomPageLimit is the upper bound for the page size of generated GetAll requests
+const maxRandomPageLimit = 100
+
+// RandomFeedOption is a function type for configuring the RandomRequestFeed
+type RandomFeedOption func(r *RandomRequestFeed)
+
+// WithBursts generates requests in bursts of size separated by idle pauses, e.g. to load test autoscaling.
+// Next blocks for the pause before every burst but the first.
+func WithBursts(size int, pause time.Duration) RandomFeedOption {
+	return func(r *RandomRequestFeed) {
+		r.burstSize = size
+		r.burstPause = pause
+	}
+}
+
 // RandomRequestFeed is a request feed that generates random requests
 type RandomRequestFeed struct {
 	maxRequests  int
 	requestCount int
+
+	burstSize  int // Requests are generated without pauses if not positive
+	burstPause time.Duration
+	burstCount int // Requests generated in the current burst
+
+	cursorMu   sync.Mutex
+	nextCursor string // Cursor from the last paged GetAll response, continued by the next GetAll request
 }
 
 // NewRandomRequestFeed creates a new RandomRequestFeed instance
-func NewRandomRequestFeed(maxRequests int) *RandomRequestFeed {
-	return &RandomRequestFeed{
+func NewRandomRequestFeed(maxRequests int, options ...RandomFeedOption) *RandomRequestFeed {
+	r := &RandomRequestFeed{
 		maxRequests:  maxRequests,
 		requestCount: 0,
 	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
 }
 
 // Next returns the next random request
@@ -27,6 +55,13 @@ func (r *RandomRequestFeed) Next() (models.RequestWrapper, error) {
 	if r.maxRequests > 0 {
 		r.requestCount++
 	}
+	if r.burstSize > 0 {
+		if r.burstCount == r.burstSize {
+			time.Sleep(r.burstPause)
+			r.burstCount = 0
+		}
+		r.burstCount++
+	}
 
 	types := []models.RequestType{models.AddItem, models.DeleteItem, models.GetItem, models.GetAll}
 	cmdType := types[rand.Intn(len(types))]
@@ -64,7 +99,11 @@ func (r *RandomRequestFeed) Next() (models.RequestWrapper, error) {
 		}, nil
 
 	case models.GetAll:
-		rawPayload, _ := json.Marshal(models.GetAllItemsRequest{})
+		payload := models.GetAllItemsRequest{
+			Limit:  1 + rand.Intn(maxRandomPageLimit),
+			Cursor: r.takeCursor(),
+		}
+		rawPayload, _ := json.Marshal(payload)
 		return models.RequestWrapper{
 			Type:    models.GetAll,
 			Payload: rawPayload,
@@ -75,6 +114,32 @@ func (r *RandomRequestFeed) Next() (models.RequestWrapper, error) {
 	}
 }
 
+// HandleResponse remembers the cursor of a paged GetAll response, so the next generated GetAll
+// request continues from it. It can be chained into the producer's response handler.
+func (r *RandomRequestFeed) HandleResponse(response string) error {
+	var resp models.GetAllItemsResponse
+	if err := models.DeserializeResponse(response, &resp); err != nil {
+		return err
+	}
+	if resp.NextCursor == "" {
+		return nil
+	}
+
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
+	r.nextCursor = resp.NextCursor
+	return nil
+}
+
+func (r *RandomRequestFeed) takeCursor() string {
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
+
+	cursor := r.nextCursor
+	r.nextCursor = ""
+	return cursor
+}
+
 // IsEmpty returns true if there are no more requests to generate
 func (r *RandomRequestFeed) IsEmpty() bool {
 	return r.maxRequests != -1 && r.requestCount >= r.maxRequests
@@ -0,0 +1,320 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record layout: payload length (uint32), CRC32 of the payload (uint32), payload
+const headerSize = 8
+
+var (
+	// ErrClosed is returned when the log is used after Close
+	ErrClosed = errors.New("write-ahead log is closed")
+	// ErrInvalidSyncPolicy is returned when a sync policy can't be parsed
+	ErrInvalidSyncPolicy = errors.New("invalid sync policy")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// syncFile flushes the file to stable storage, tests replace it to simulate failures
+var syncFile = (*os.File).Sync
+
+// SyncPolicy defines when appended records are flushed to stable storage
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs the file after every appended record
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs the file periodically in the background
+	SyncInterval
+	// SyncNever leaves flushing to the operating system
+	SyncNever
+)
+
+// ParseSyncPolicy parses a sync policy name: "always", "interval" or "never"
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch name {
+	case "always", "":
+		return SyncAlways, nil
+	case "interval":
+		return SyncInterval, nil
+	case "never":
+		return SyncNever, nil
+	default:
+		return SyncAlways, fmt.Errorf("%w: %q", ErrInvalidSyncPolicy, name)
+	}
+}
+
+type config struct {
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+}
+
+// Option is a function type for configuring the Log
+type Option func(config *config)
+
+// WithSyncPolicy sets the sync policy of the Log, SyncAlways by default
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(c *config) {
+		c.syncPolicy = policy
+	}
+}
+
+// WithSyncInterval sets the period of background fsync for the SyncInterval policy, one second by default
+func WithSyncInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.syncInterval = interval
+	}
+}
+
+// Log is an append-only write-ahead log of opaque records
+type Log struct {
+	mu     sync.Mutex
+	file   *os.File
+	size   int64 // Size of the valid part of the file
+	dirty  bool  // Records were appended since the last fsync
+	closed bool
+	config config
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Open opens the log at the given path, creating it if needed.
+// A torn or corrupted tail left by a crash is truncated.
+func Open(path string, options ...Option) (*Log, error) {
+	cfg := config{
+		syncPolicy:   SyncAlways,
+		syncInterval: time.Second,
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	if cfg.syncInterval <= 0 {
+		return nil, fmt.Errorf("invalid sync interval: %v", cfg.syncInterval)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+
+	l := &Log{
+		file:     file,
+		config:   cfg,
+		stopChan: make(chan struct{}),
+	}
+
+	if err := l.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if cfg.syncPolicy == SyncInterval {
+		l.wg.Add(1)
+		go l.syncLoop()
+	}
+	return l, nil
+}
+
+// Append writes a record to the end of the log. If it fails, the record is not in the log.
+func (l *Log) Append(record []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	buf := make([]byte, headerSize+len(record))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(record, crcTable))
+	copy(buf[headerSize:], record)
+
+	if _, err := l.file.WriteAt(buf, l.size); err != nil {
+		// Drop whatever part of the record was written, so the next append starts at a record boundary
+		_ = l.file.Truncate(l.size)
+		return fmt.Errorf("failed to append record: %w", err)
+	}
+	size := l.size
+	l.size += int64(len(buf))
+	l.dirty = true
+
+	if l.config.syncPolicy == SyncAlways {
+		if err := l.sync(); err != nil {
+			// The caller doesn't apply the record, so it must not be replayed either
+			_ = l.file.Truncate(size)
+			l.size = size
+			return err
+		}
+	}
+	return nil
+}
+
+// Replay calls apply for every record in the log in the order they were appended
+func (l *Log) Replay(apply func(record []byte) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	_, err := l.scan(func(record []byte) error {
+		return apply(record)
+	})
+	return err
+}
+
+// Truncate discards all records, e.g. once they are captured by a snapshot
+func (l *Log) Truncate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+	l.size = 0
+	l.dirty = true
+	return l.sync()
+}
+
+// Sync flushes appended records to stable storage
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+	return l.sync()
+}
+
+// Close flushes and closes the log
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.stopChan)
+	l.mu.Unlock()
+
+	l.wg.Wait()
+
+	err := l.sync()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// recover finds the end of the last valid record and truncates everything after it
+func (l *Log) recover() error {
+	validSize, err := l.scan(nil)
+	if err != nil {
+		return err
+	}
+
+	info, err := l.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat write-ahead log: %w", err)
+	}
+	if info.Size() > validSize {
+		log.Printf("Truncating %d bytes of torn write-ahead log tail", info.Size()-validSize)
+		if err := l.file.Truncate(validSize); err != nil {
+			return fmt.Errorf("failed to truncate torn tail: %w", err)
+		}
+	}
+	l.size = validSize
+	return nil
+}
+
+// scan reads records from the beginning of the file until the first invalid one
+// and returns the size of the valid part, the caller must hold the lock or own the log
+func (l *Log) scan(apply func(record []byte) error) (int64, error) {
+	info, err := l.file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat write-ahead log: %w", err)
+	}
+	fileSize := info.Size()
+
+	var offset int64
+	header := make([]byte, headerSize)
+
+	for {
+		if _, err := l.file.ReadAt(header, offset); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("failed to read record header: %w", err)
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		checksum := binary.BigEndian.Uint32(header[4:8])
+		if offset+headerSize+int64(length) > fileSize {
+			// Torn write: the record was not fully written
+			return offset, nil
+		}
+
+		record := make([]byte, length)
+		if _, err := l.file.ReadAt(record, offset+headerSize); err != nil {
+			return offset, fmt.Errorf("failed to read record: %w", err)
+		}
+		if crc32.Checksum(record, crcTable) != checksum {
+			// Corrupted tail, nothing after it can be trusted
+			return offset, nil
+		}
+
+		if apply != nil {
+			if err := apply(record); err != nil {
+				return offset, err
+			}
+		}
+		offset += headerSize + int64(length)
+	}
+}
+
+func (l *Log) sync() error {
+	if !l.dirty {
+		return nil
+	}
+	if err := syncFile(l.file); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	l.dirty = false
+	return nil
+}
+
+func (l *Log) syncLoop() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.config.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			if err := l.sync(); err != nil {
+				log.Printf("Background sync failed: %v", err)
+			}
+			l.mu.Unlock()
+		case <-l.stopChan:
+			return
+		}
+	}
+}
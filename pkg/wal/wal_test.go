@@ -0,0 +1,163 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, l *Log) []string {
+	var records []string
+	err := l.Replay(func(record []byte) error {
+		records = append(records, string(record))
+		return nil
+	})
+	assert.NoError(t, err)
+	return records
+}
+
+func TestLogAppendAndReplay(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		t.Run(fmt.Sprintf("Policy_%d", policy), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+
+			l, err := Open(path, WithSyncPolicy(policy), WithSyncInterval(10*time.Millisecond))
+			assert.NoError(t, err)
+
+			var expected []string
+			for i := 0; i < 100; i++ {
+				record := fmt.Sprintf("record%d", i)
+				assert.NoError(t, l.Append([]byte(record)))
+				expected = append(expected, record)
+			}
+			assert.Equal(t, expected, readAll(t, l))
+			assert.NoError(t, l.Close())
+
+			// Test records survive reopening
+			l, err = Open(path, WithSyncPolicy(policy))
+			assert.NoError(t, err)
+			defer l.Close()
+
+			assert.Equal(t, expected, readAll(t, l))
+			assert.NoError(t, l.Append([]byte("after reopen")))
+			assert.Equal(t, append(expected, "after reopen"), readAll(t, l))
+		})
+	}
+}
+
+func TestLogTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Append([]byte("first")))
+	assert.NoError(t, l.Append([]byte("second")))
+	assert.NoError(t, l.Close())
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	validSize := info.Size()
+
+	// Simulate a crash in the middle of writing a record
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 42, 1, 2, 3, 4, 't', 'o', 'r', 'n'})
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, readAll(t, l))
+
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, validSize, info.Size())
+
+	// New records go right after the last valid one
+	assert.NoError(t, l.Append([]byte("third")))
+	assert.NoError(t, l.Close())
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, []string{"first", "second", "third"}, readAll(t, l))
+}
+
+func TestLogCorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Append([]byte("first")))
+	assert.NoError(t, l.Append([]byte("second")))
+	assert.NoError(t, l.Close())
+
+	// Flip the last payload byte, so the checksum doesn't match
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xFF
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, []string{"first"}, readAll(t, l))
+}
+
+func TestLogTruncateAndClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Append([]byte("first")))
+	assert.NoError(t, l.Truncate())
+	assert.Empty(t, readAll(t, l))
+
+	assert.NoError(t, l.Append([]byte("second")))
+	assert.Equal(t, []string{"second"}, readAll(t, l))
+
+	assert.NoError(t, l.Close())
+	assert.NoError(t, l.Close())
+	assert.ErrorIs(t, l.Append([]byte("third")), ErrClosed)
+}
+
+func TestLogFailedSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	l, err := Open(path)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.NoError(t, l.Append([]byte("first")))
+
+	errSync := errors.New("sync failed")
+	syncFile = func(*os.File) error { return errSync }
+	defer func() { syncFile = (*os.File).Sync }()
+
+	// Test a record which couldn't be synced is dropped
+	assert.ErrorIs(t, l.Append([]byte("unsynced")), errSync)
+	syncFile = (*os.File).Sync
+
+	assert.NoError(t, l.Append([]byte("second")))
+	assert.Equal(t, []string{"first", "second"}, readAll(t, l))
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	for name, expected := range map[string]SyncPolicy{
+		"":         SyncAlways,
+		"always":   SyncAlways,
+		"interval": SyncInterval,
+		"never":    SyncNever,
+	} {
+		policy, err := ParseSyncPolicy(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, policy)
+	}
+
+	_, err := ParseSyncPolicy("sometimes")
+	assert.ErrorIs(t, err, ErrInvalidSyncPolicy)
+}